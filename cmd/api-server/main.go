@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -23,8 +24,10 @@ import (
 
 	"enhanced_video_transcoder/internal/api"
 	"enhanced_video_transcoder/internal/config"
+	"enhanced_video_transcoder/internal/ingest"
 	"enhanced_video_transcoder/internal/llm"
 	"enhanced_video_transcoder/internal/queue"
+	"enhanced_video_transcoder/internal/storage"
 	"enhanced_video_transcoder/internal/task"
 	"enhanced_video_transcoder/internal/transcode"
 	"enhanced_video_transcoder/internal/user"
@@ -37,9 +40,12 @@ func main() {
 	cfg := config.LoadConfig()
 
 	// 验证必要的配置
-	if cfg.SQSQueueURL == "" {
+	if (cfg.QueueBackend == "" || cfg.QueueBackend == queue.BackendSQS) && cfg.SQSQueueURL == "" {
 		log.Fatal("❌ SQS_QUEUE_URL 环境变量未设置")
 	}
+	if cfg.QueueBackend == queue.BackendMemory {
+		log.Printf("⚠️ 使用内存队列，消息不会在 API 服务器和 GPU 处理器进程之间共享")
+	}
 	if cfg.OutputBucket == "" {
 		log.Fatal("❌ OUTPUT_BUCKET 环境变量未设置")
 	}
@@ -47,15 +53,27 @@ func main() {
 	// 加载 AWS 配置，支持多种凭证方式
 	awsCfg, credSource, err := loadAWSConfig(cfg.AWSRegion)
 	if err != nil {
-		log.Fatalf("❌ 无法加载AWS配置: %v", err)
+		if cfg.RequiresAWS() {
+			log.Fatalf("❌ 无法加载AWS配置: %v", err)
+		}
+		// 任务存储、队列和对象存储都是本地后端，没有 AWS 凭证也可以运行
+		log.Printf("⚠️ 无法加载AWS配置，以单机模式运行（用户管理、LLM 和自定义预设持久化不可用）: %v", err)
+		awsCfg = aws.Config{Region: cfg.AWSRegion}
+	} else {
+		log.Printf("✅ AWS 凭证加载成功，来源: %s", credSource)
 	}
-	log.Printf("✅ AWS 凭证加载成功，来源: %s", credSource)
 
 	// 创建AWS客户端
 	sqsClient := sqs.NewFromConfig(awsCfg)
 	dynamoClient := dynamodb.NewFromConfig(awsCfg)
 	s3Client := s3.NewFromConfig(awsCfg)
 
+	// 创建对象存储
+	store, err := storage.New(cfg.StorageBackend, cfg.LocalStorageDir, s3Client)
+	if err != nil {
+		log.Fatalf("❌ 无法创建对象存储: %v", err)
+	}
+
 	// 创建 Bedrock 客户端（用于 LLM）
 	// Bedrock 可能需要使用特定区域，并且需要代理支持（用于访问 Anthropic 模型）
 	bedrockRegion := os.Getenv("BEDROCK_REGION")
@@ -70,9 +88,37 @@ func main() {
 	bedrockClient := bedrockruntime.NewFromConfig(bedrockCfg)
 
 	// 创建管理器
-	queueManager := queue.NewManager(sqsClient, cfg.SQSQueueURL)
-	taskManager := task.NewManager(dynamoClient, cfg.DynamoDBTable)
+	queueBackend, err := queue.New(cfg.QueueBackend, sqsClient, cfg.SQSQueueURL, cfg.QueueDir)
+	if err != nil {
+		log.Fatalf("❌ 无法创建队列: %v", err)
+	}
+	queueManager := queue.NewManager(queueBackend)
+	laneURLs := map[string]string{task.PriorityHigh: cfg.SQSHighQueueURL, task.PriorityBulk: cfg.SQSBulkQueueURL}
+	for priority, laneURL := range laneURLs {
+		laneQueue, err := queue.NewOptional(cfg.QueueBackend, sqsClient, laneURL, filepath.Join(cfg.QueueDir, priority))
+		if err != nil {
+			log.Fatalf("❌ 无法创建 %s 优先级队列: %v", priority, err)
+		}
+		queueManager.SetLaneQueue(priority, laneQueue)
+	}
+	deadLetterQueue, err := queue.NewOptional(cfg.QueueBackend, sqsClient, cfg.SQSDeadLetterQueueURL, cfg.DeadLetterQueueDir)
+	if err != nil {
+		log.Fatalf("❌ 无法创建死信队列: %v", err)
+	}
+	queueManager.SetDeadLetterQueue(deadLetterQueue)
+	taskStore, err := task.NewStore(cfg.TaskStoreBackend, dynamoClient, cfg.DynamoDBTable, cfg.SQLitePath)
+	if err != nil {
+		log.Fatalf("❌ 无法创建任务存储: %v", err)
+	}
+	taskManager := task.NewManager(taskStore)
+	taskManager.SetIdempotencyTTL(cfg.IdempotencyTTL)
 	presetManager := transcode.NewPresetManager(dynamoClient, cfg.DynamoDBTable)
+	ingestStore, err := ingest.NewStore(cfg.TaskStoreBackend, dynamoClient, cfg.DynamoDBTable, cfg.SQLitePath)
+	if err != nil {
+		log.Fatalf("❌ 无法创建接入规则存储: %v", err)
+	}
+	ingestRules := ingest.NewManager(ingestStore)
+	queueManager.SetIngestRules(ingestRules)
 	userManager := user.NewManager(dynamoClient, cfg.UserTable, cfg.JWTSecret)
 
 	// 初始化默认管理员账户
@@ -86,18 +132,19 @@ func main() {
 	}
 
 	// 创建转码处理器（用于测试转码）
-	processor := transcode.NewProcessor(s3Client, taskManager, presetManager, cfg.TempDir, cfg.OutputBucket, cfg.Debug)
+	processor := transcode.NewProcessor(store, taskManager, presetManager, cfg.TempDir, cfg.OutputBucket, cfg.Debug)
 
 	// 创建 LLM 客户端
 	llmClient := llm.NewBedrockClient(bedrockClient)
 
 	// 创建API处理器
-	handlers := api.NewHandlers(queueManager, taskManager, cfg.InputBucket, cfg.OutputBucket)
-	llmHandlers := api.NewLLMHandlers(llmClient, processor, presetManager)
+	handlers := api.NewHandlers(queueManager, taskManager, store, cfg.InputBucket, cfg.OutputBucket)
+	llmHandlers := api.NewLLMHandlers(llmClient, processor, presetManager, store, cfg.InputBucket)
 	authHandlers := api.NewAuthHandlers(userManager, cfg.APIKey)
+	ingestHandlers := api.NewIngestHandlers(ingestRules, presetManager)
 
 	// 设置路由
-	router := api.SetupRouter(handlers, llmHandlers, authHandlers, cfg.Debug)
+	router := api.SetupRouter(handlers, llmHandlers, authHandlers, ingestHandlers, cfg.Debug)
 
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%s", cfg.APIHost, cfg.APIPort)
@@ -105,8 +152,11 @@ func main() {
 	log.Printf("📍 监听地址: %s", addr)
 	log.Printf("🌐 Web管理界面: http://%s:%s/admin", cfg.APIHost, cfg.APIPort)
 	log.Printf("🪣 输出桶: %s", cfg.OutputBucket)
-	log.Printf("📋 队列URL: %s", cfg.SQSQueueURL)
-	log.Printf("🗄️  DynamoDB表: %s", cfg.DynamoDBTable)
+	log.Printf("💾 存储后端: %s", store.Backend())
+	log.Printf("📋 队列: %s (%s)，优先级通道: %v", queueDescription(cfg), queueManager.Backend(), queueManager.Lanes())
+	log.Printf("☠️  死信队列: %s", deadLetterDescription(cfg))
+	log.Printf("🗄️  任务存储: %s (%s)", taskStoreDescription(cfg), taskManager.Backend())
+	log.Printf("📐 接入规则存储: %s", ingestRules.Backend())
 	log.Printf("👤 用户表: %s", cfg.UserTable)
 	log.Printf("🔑 API Key: %s", cfg.APIKey)
 	log.Printf("🤖 Bedrock区域: %s", bedrockRegion)
@@ -284,3 +334,37 @@ func loadAWSConfigWithProxy(region string, useProxy bool) (aws.Config, string, e
 		"  2. 配置 ~/.aws/credentials 文件，或\n" +
 		"  3. 在 EC2 实例上配置 IAM Role")
 }
+
+// queueDescription 返回队列的展示信息（SQS 为队列URL，file 为目录）
+func queueDescription(cfg *config.Config) string {
+	switch cfg.QueueBackend {
+	case queue.BackendFile:
+		return cfg.QueueDir
+	case queue.BackendMemory:
+		return "进程内"
+	default:
+		return cfg.SQSQueueURL
+	}
+}
+
+// deadLetterDescription 返回死信队列的展示信息
+func deadLetterDescription(cfg *config.Config) string {
+	switch cfg.QueueBackend {
+	case queue.BackendFile:
+		return cfg.DeadLetterQueueDir
+	case queue.BackendMemory:
+		return "进程内"
+	}
+	if cfg.SQSDeadLetterQueueURL == "" {
+		return "未配置"
+	}
+	return cfg.SQSDeadLetterQueueURL
+}
+
+// taskStoreDescription 返回任务存储的展示信息（DynamoDB 为表名，sqlite 为数据库文件）
+func taskStoreDescription(cfg *config.Config) string {
+	if cfg.TaskStoreBackend == task.StoreBackendSQLite {
+		return cfg.SQLitePath
+	}
+	return cfg.DynamoDBTable
+}
@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
 	appConfig "enhanced_video_transcoder/internal/config"
+	"enhanced_video_transcoder/internal/ingest"
 	"enhanced_video_transcoder/internal/queue"
+	"enhanced_video_transcoder/internal/storage"
 	"enhanced_video_transcoder/internal/task"
 	"enhanced_video_transcoder/internal/transcode"
 )
@@ -27,9 +33,12 @@ func main() {
 	cfg := appConfig.LoadConfig()
 
 	// 验证必要的配置
-	if cfg.SQSQueueURL == "" {
+	if (cfg.QueueBackend == "" || cfg.QueueBackend == queue.BackendSQS) && cfg.SQSQueueURL == "" {
 		log.Fatal("❌ SQS_QUEUE_URL 环境变量未设置")
 	}
+	if cfg.QueueBackend == queue.BackendMemory {
+		log.Printf("⚠️ 使用内存队列，消息不会在 API 服务器和 GPU 处理器进程之间共享")
+	}
 	if cfg.OutputBucket == "" {
 		log.Fatal("❌ OUTPUT_BUCKET 环境变量未设置")
 	}
@@ -37,7 +46,12 @@ func main() {
 	// 加载AWS配置
 	awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO(), awsconfig.WithRegion(cfg.AWSRegion))
 	if err != nil {
-		log.Fatalf("❌ 无法加载AWS配置: %v", err)
+		if cfg.RequiresAWS() {
+			log.Fatalf("❌ 无法加载AWS配置: %v", err)
+		}
+		// 任务存储、队列和对象存储都是本地后端，没有 AWS 凭证也可以运行
+		log.Printf("⚠️ 无法加载AWS配置，以单机模式运行（DynamoDB 中的自定义预设不可用）: %v", err)
+		awsCfg = aws.Config{Region: cfg.AWSRegion}
 	}
 
 	// 创建AWS客户端
@@ -45,36 +59,91 @@ func main() {
 	sqsClient := sqs.NewFromConfig(awsCfg)
 	dynamoClient := dynamodb.NewFromConfig(awsCfg)
 
+	// 创建对象存储
+	store, err := storage.New(cfg.StorageBackend, cfg.LocalStorageDir, s3Client)
+	if err != nil {
+		log.Fatalf("❌ 无法创建对象存储: %v", err)
+	}
+
 	// 创建管理器
-	queueManager := queue.NewManager(sqsClient, cfg.SQSQueueURL)
-	taskManager := task.NewManager(dynamoClient, cfg.DynamoDBTable)
+	queueBackend, err := queue.New(cfg.QueueBackend, sqsClient, cfg.SQSQueueURL, cfg.QueueDir)
+	if err != nil {
+		log.Fatalf("❌ 无法创建队列: %v", err)
+	}
+	queueManager := queue.NewManager(queueBackend)
+	laneURLs := map[string]string{task.PriorityHigh: cfg.SQSHighQueueURL, task.PriorityBulk: cfg.SQSBulkQueueURL}
+	for priority, laneURL := range laneURLs {
+		laneQueue, err := queue.NewOptional(cfg.QueueBackend, sqsClient, laneURL, filepath.Join(cfg.QueueDir, priority))
+		if err != nil {
+			log.Fatalf("❌ 无法创建 %s 优先级队列: %v", priority, err)
+		}
+		queueManager.SetLaneQueue(priority, laneQueue)
+	}
+	deadLetterQueue, err := queue.NewOptional(cfg.QueueBackend, sqsClient, cfg.SQSDeadLetterQueueURL, cfg.DeadLetterQueueDir)
+	if err != nil {
+		log.Fatalf("❌ 无法创建死信队列: %v", err)
+	}
+	queueManager.SetDeadLetterQueue(deadLetterQueue)
+	taskStore, err := task.NewStore(cfg.TaskStoreBackend, dynamoClient, cfg.DynamoDBTable, cfg.SQLitePath)
+	if err != nil {
+		log.Fatalf("❌ 无法创建任务存储: %v", err)
+	}
+	taskManager := task.NewManager(taskStore)
 	presetManager := transcode.NewPresetManager(dynamoClient, cfg.DynamoDBTable)
+	ingestStore, err := ingest.NewStore(cfg.TaskStoreBackend, dynamoClient, cfg.DynamoDBTable, cfg.SQLitePath)
+	if err != nil {
+		log.Fatalf("❌ 无法创建接入规则存储: %v", err)
+	}
+	ingestRules := ingest.NewManager(ingestStore)
+	queueManager.SetIngestRules(ingestRules)
 
 	// 加载自定义预设
 	if err := presetManager.LoadCustomPresets(); err != nil {
 		log.Printf("⚠️ 加载自定义预设失败: %v", err)
 	}
 
+	// 加载接入规则（之后定期刷新，API 修改的规则无需重启即可生效）
+	if err := ingestRules.Load(); err != nil {
+		log.Printf("⚠️ 加载接入规则失败: %v", err)
+	}
+
 	// 创建转码处理器
-	processor := transcode.NewProcessor(s3Client, taskManager, presetManager, cfg.TempDir, cfg.OutputBucket, cfg.Debug)
+	processor := transcode.NewProcessor(store, taskManager, presetManager, cfg.TempDir, cfg.OutputBucket, cfg.Debug)
+	processor.SetConcurrency(cfg.TranscodeConcurrency, cfg.MaxEncodeSessions)
+	processor.SetMultiOutput(cfg.MultiOutputEncoding)
+	packaging := transcode.PackagingOptions{SegmentSeconds: cfg.PackagingSegmentSeconds}
+	if cfg.PackagingLadder != "" {
+		if packaging.Ladder, err = transcode.ParseLadder(cfg.PackagingLadder); err != nil {
+			log.Fatalf("❌ RENDITION_LADDER 配置错误: %v", err)
+		}
+	}
+	processor.SetPackagingOptions(packaging)
 
 	log.Printf("✅ 处理器初始化完成")
 	log.Printf("🖥️  平台: %s (GPU: %v)", processor.GetPlatformInfo().Platform, processor.GetPlatformInfo().GPUAvailable)
 	log.Printf("📁 临时目录: %s", cfg.TempDir)
 	log.Printf("🪣 输出桶: %s", cfg.OutputBucket)
-	log.Printf("📋 队列URL: %s", cfg.SQSQueueURL)
-	log.Printf("🗄️  DynamoDB表: %s", cfg.DynamoDBTable)
+	log.Printf("💾 存储后端: %s", store.Backend())
+	log.Printf("📋 队列: %s (%s)，优先级通道: %v", queueDescription(cfg), queueManager.Backend(), queueManager.Lanes())
+	log.Printf("☠️  死信队列: %s", deadLetterDescription(cfg))
+	log.Printf("🗄️  任务存储: %s (%s)", taskStoreDescription(cfg), taskManager.Backend())
+	log.Printf("📐 接入规则存储: %s，刷新间隔: %v", ingestRules.Backend(), ingest.DefaultRefreshInterval)
 	log.Printf("⚙️  最大并发任务: %d", cfg.MaxConcurrentTasks)
+	log.Printf("⚙️  任务内并行度: %d，编码会话上限: %d，多输出合并转码: %v", processor.TaskConcurrency(), processor.GetPlatformInfo().MaxEncodeSessions, processor.MultiOutput())
+	log.Printf("🎞️  码率阶梯: %s，分段时长: %ds", transcode.DescribeLadder(processor.PackagingOptions().Ladder), processor.PackagingOptions().SegmentSeconds)
 	log.Printf("⏱️  轮询间隔: %v", cfg.PollInterval)
+	log.Printf("👁️  消息可见性超时: %v，关闭等待时间: %v", cfg.VisibilityTimeout, cfg.DrainTimeout)
 
 	// 创建工作协程池
+	// ctx 控制是否继续接收新消息，processCtx 控制进行中的任务（仅在关闭等待超时后取消）
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
+	processCtx, cancelProcessing := context.WithCancelCause(context.Background())
 
 	// 启动工作协程
 	for i := 0; i < cfg.MaxConcurrentTasks; i++ {
 		wg.Add(1)
-		go worker(ctx, &wg, i+1, queueManager, processor, cfg.PollInterval, cfg.OutputBucket)
+		go worker(ctx, processCtx, &wg, i+1, queueManager, taskManager, processor, cfg)
 	}
 
 	log.Printf("🔄 已启动 %d 个工作协程", cfg.MaxConcurrentTasks)
@@ -84,9 +153,9 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("🛑 正在关闭处理器...")
+	log.Println("🛑 正在关闭处理器，停止接收新任务...")
 
-	// 取消所有工作协程
+	// 停止接收新消息，进行中的任务继续处理
 	cancel()
 
 	// 等待所有协程完成
@@ -96,19 +165,33 @@ func main() {
 		close(done)
 	}()
 
-	// 给工作协程30秒时间完成当前任务
 	select {
 	case <-done:
 		log.Println("✅ 所有工作协程已完成")
-	case <-time.After(30 * time.Second):
-		log.Println("⚠️  强制关闭处理器")
+	case <-time.After(cfg.DrainTimeout):
+		// 超时后终止进行中的转码，工作协程会将消息放回队列由其他处理器继续处理
+		log.Printf("⚠️  等待 %v 后仍有任务未完成，终止任务并释放消息", cfg.DrainTimeout)
+		cancelProcessing(errShuttingDown)
+		select {
+		case <-done:
+			log.Println("✅ 进行中的消息已释放")
+		case <-time.After(releaseTimeout):
+			log.Println("⚠️  强制关闭处理器")
+		}
 	}
 
 	log.Println("✅ 处理器已关闭")
 }
 
+// errShuttingDown 关闭等待超时后取消进行中任务的原因
+var errShuttingDown = errors.New("处理器正在关闭")
+
+// releaseTimeout 关闭等待超时后，等待工作协程终止转码并释放消息的最长时间
+const releaseTimeout = 15 * time.Second
+
 // worker 工作协程
-func worker(ctx context.Context, wg *sync.WaitGroup, workerID int, queueManager *queue.Manager, processor *transcode.Processor, pollInterval time.Duration, defaultOutputBucket string) {
+// ctx 结束后不再接收新消息；processCtx 被取消时终止进行中的任务并将消息放回队列
+func worker(ctx, processCtx context.Context, wg *sync.WaitGroup, workerID int, queueManager *queue.Manager, taskManager *task.Manager, processor *transcode.Processor, cfg *appConfig.Config) {
 	defer wg.Done()
 
 	log.Printf("🔧 工作协程 %d 已启动", workerID)
@@ -120,10 +203,10 @@ func worker(ctx context.Context, wg *sync.WaitGroup, workerID int, queueManager
 			return
 		default:
 			// 从队列接收消息
-			messages, err := queueManager.ReceiveMessages(1, int32(pollInterval.Seconds()))
+			messages, err := queueManager.ReceiveMessages(1, int32(cfg.PollInterval.Seconds()), cfg.VisibilityTimeout)
 			if err != nil {
 				log.Printf("⚠️  工作协程 %d 接收消息失败: %v", workerID, err)
-				time.Sleep(pollInterval)
+				time.Sleep(cfg.PollInterval)
 				continue
 			}
 
@@ -133,33 +216,171 @@ func worker(ctx context.Context, wg *sync.WaitGroup, workerID int, queueManager
 			}
 
 			message := messages[0]
-			log.Printf("🔧 工作协程 %d 接收到任务: %s", workerID, message.QueueMessage.TaskID)
 
-			// 处理任务
-			// 如果消息没有指定 OutputBucket（S3事件消息），使用配置的默认值
-			outputBucket := message.QueueMessage.OutputBucket
-			if outputBucket == "" {
-				outputBucket = defaultOutputBucket
+			// 长轮询期间收到关闭信号，消息还未开始处理，直接放回队列
+			if ctx.Err() != nil {
+				releaseMessage(queueManager, workerID, message)
+				log.Printf("🔧 工作协程 %d 正在关闭", workerID)
+				return
 			}
 
-			transcodeTask := &task.TranscodeTask{
-				TaskID:         message.QueueMessage.TaskID,
-				InputBucket:    message.QueueMessage.InputBucket,
-				InputKey:       message.QueueMessage.InputKey,
-				OutputBucket:   outputBucket,
-				TranscodeTypes: message.QueueMessage.TranscodeTypes,
+			if message.QueueMessage.Action == task.QueueActionCancel {
+				cancelTasksForInput(workerID, queueManager, taskManager, message)
+				continue
 			}
 
-			if err := processor.ProcessTask(transcodeTask); err != nil {
-				log.Printf("❌ 工作协程 %d 处理任务失败: %v", workerID, err)
-			} else {
-				log.Printf("✅ 工作协程 %d 任务完成: %s", workerID, message.QueueMessage.TaskID)
-			}
+			log.Printf("🔧 工作协程 %d 接收到任务: %s", workerID, message.QueueMessage.TaskID)
+			processMessage(processCtx, workerID, queueManager, processor, cfg, message)
+		}
+	}
+}
 
-			// 删除队列中的消息
-			if err := queueManager.DeleteMessage(message.ReceiptHandle); err != nil {
-				log.Printf("⚠️  工作协程 %d 删除消息失败: %v", workerID, err)
-			}
+// processMessage 处理一条消息：处理期间持续延长消息可见性，根据处理结果确认消息
+//   - 成功、永久失败或任务被中止：删除消息
+//   - 临时故障：消息保留在队列中，按退避时间延迟后重新投递；
+//     任务存储不可用、未能记录重试次数时，消息接收次数达到 MaxReceiveCount 后移入死信队列
+//   - 重试次数用完：移入死信队列
+//   - 被 processCtx 中断：立即将消息放回队列
+func processMessage(processCtx context.Context, workerID int, queueManager *queue.Manager, processor *transcode.Processor, cfg *appConfig.Config, message queue.Message) {
+	heartbeatCtx, cancelHeartbeat := context.WithCancel(context.Background())
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		queueManager.KeepMessageInvisible(heartbeatCtx, message, cfg.VisibilityTimeout)
+	}()
+	// 等待心跳协程退出，避免进行中的延长请求覆盖之后设置的可见性
+	stopHeartbeat := func() {
+		cancelHeartbeat()
+		<-heartbeatDone
+	}
+	defer cancelHeartbeat()
+
+	// 处理任务
+	// 如果消息没有指定 OutputBucket（S3事件消息），使用配置的默认值
+	outputBucket := message.QueueMessage.OutputBucket
+	if outputBucket == "" {
+		outputBucket = cfg.OutputBucket
+	}
+
+	transcodeTask := &task.TranscodeTask{
+		TaskID:         message.QueueMessage.TaskID,
+		InputBucket:    message.QueueMessage.InputBucket,
+		InputKey:       message.QueueMessage.InputKey,
+		OutputBucket:   outputBucket,
+		TranscodeTypes: message.QueueMessage.TranscodeTypes,
+		Priority:       message.QueueMessage.Priority,
+		OutputPrefix:   message.QueueMessage.OutputPrefix,
+		IngestRule:     message.QueueMessage.IngestRule,
+		MessageID:      message.MessageID,
+	}
+
+	err := processor.ProcessTask(processCtx, transcodeTask)
+	stopHeartbeat()
+
+	if processCtx.Err() != nil {
+		// 关闭时被中断，任务保持 processing，消息重新投递后继续处理
+		log.Printf("⏸️  工作协程 %d 任务被中断: %s (%v)", workerID, message.QueueMessage.TaskID, err)
+		releaseMessage(queueManager, workerID, message)
+		return
+	}
+
+	var retryErr *transcode.RetryableError
+	if errors.As(err, &retryErr) && retryErr.Attempt == 0 && cfg.MaxReceiveCount > 0 && message.ReceiveCount >= cfg.MaxReceiveCount {
+		// 重试次数没有计入任务，按消息接收次数兜底，避免任务存储持续故障时消息无限重新投递
+		log.Printf("❌ 工作协程 %d 消息已接收 %d 次仍遇到临时故障，移入死信队列: %s (%v)", workerID, message.ReceiveCount, message.QueueMessage.TaskID, retryErr.Err)
+		reason := fmt.Sprintf("消息已接收 %d 次仍未能处理: %v", message.ReceiveCount, retryErr.Err)
+		if err := queueManager.MoveToDeadLetter(message, reason); err != nil {
+			log.Printf("⚠️  工作协程 %d 移入死信队列失败: %v", workerID, err)
+		}
+		return
+	}
+	if retryErr != nil {
+		// 临时故障，消息保留在队列中，退避时间后重新投递
+		log.Printf("🔁 工作协程 %d 任务遇到临时故障，%v 后重新投递: %s (%v)", workerID, retryErr.Delay, message.QueueMessage.TaskID, retryErr.Err)
+		if err := queueManager.ChangeMessageVisibility(message, retryErr.Delay); err != nil {
+			log.Printf("⚠️  工作协程 %d 设置消息重试延迟失败: %v", workerID, err)
+		}
+		return
+	}
+
+	if errors.Is(err, task.ErrRetriesExhausted) {
+		// 重试次数用完，移入死信队列，修复问题后可通过 API 重新投递
+		log.Printf("❌ 工作协程 %d 任务重试次数已用完: %v", workerID, err)
+		if err := queueManager.MoveToDeadLetter(message, err.Error()); err != nil {
+			log.Printf("⚠️  工作协程 %d 移入死信队列失败: %v", workerID, err)
 		}
+		return
+	}
+
+	if err != nil {
+		log.Printf("❌ 工作协程 %d 处理任务失败: %v", workerID, err)
+	} else {
+		log.Printf("✅ 工作协程 %d 任务完成: %s", workerID, message.QueueMessage.TaskID)
+	}
+
+	// 删除队列中的消息
+	if err := queueManager.DeleteMessage(message); err != nil {
+		log.Printf("⚠️  工作协程 %d 删除消息失败: %v", workerID, err)
+	}
+}
+
+// cancelTasksForInput 输入文件已被删除，取消该文件的待处理任务
+// 任务存储暂时不可用时保留消息，可见性超时后重新投递
+func cancelTasksForInput(workerID int, queueManager *queue.Manager, taskManager *task.Manager, message queue.Message) {
+	bucket, key := message.QueueMessage.InputBucket, message.QueueMessage.InputKey
+	cancelled, err := taskManager.CancelTasksForInput(bucket, key, "输入文件已被删除")
+	if err != nil {
+		log.Printf("⚠️  工作协程 %d 取消已删除文件的任务失败: s3://%s/%s (%v)", workerID, bucket, key, err)
+		return
+	}
+	if len(cancelled) > 0 {
+		log.Printf("🚫 工作协程 %d 输入文件已被删除，已取消 %d 个待处理任务: s3://%s/%s %v", workerID, len(cancelled), bucket, key, cancelled)
+	}
+
+	if err := queueManager.DeleteMessage(message); err != nil {
+		log.Printf("⚠️  工作协程 %d 删除消息失败: %v", workerID, err)
+	}
+}
+
+// releaseMessage 将未处理完的消息立即放回队列（可见性超时设为 0）
+func releaseMessage(queueManager *queue.Manager, workerID int, message queue.Message) {
+	if err := queueManager.ChangeMessageVisibility(message, 0); err != nil {
+		log.Printf("⚠️  工作协程 %d 释放消息失败: %v", workerID, err)
+		return
+	}
+	log.Printf("↩️  工作协程 %d 已将任务放回队列: %s", workerID, message.QueueMessage.TaskID)
+}
+
+// queueDescription 返回队列的展示信息（SQS 为队列URL，file 为目录）
+func queueDescription(cfg *appConfig.Config) string {
+	switch cfg.QueueBackend {
+	case queue.BackendFile:
+		return cfg.QueueDir
+	case queue.BackendMemory:
+		return "进程内"
+	default:
+		return cfg.SQSQueueURL
+	}
+}
+
+// deadLetterDescription 返回死信队列的展示信息
+func deadLetterDescription(cfg *appConfig.Config) string {
+	switch cfg.QueueBackend {
+	case queue.BackendFile:
+		return cfg.DeadLetterQueueDir
+	case queue.BackendMemory:
+		return "进程内"
+	}
+	if cfg.SQSDeadLetterQueueURL == "" {
+		return "未配置"
 	}
-}
\ No newline at end of file
+	return cfg.SQSDeadLetterQueueURL
+}
+
+// taskStoreDescription 返回任务存储的展示信息（DynamoDB 为表名，sqlite 为数据库文件）
+func taskStoreDescription(cfg *appConfig.Config) string {
+	if cfg.TaskStoreBackend == task.StoreBackendSQLite {
+		return cfg.SQLitePath
+	}
+	return cfg.DynamoDBTable
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"enhanced_video_transcoder/internal/queue"
+)
+
+// ListDeadLetters 查看死信队列中的消息
+func (h *Handlers) ListDeadLetters(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	messages, err := h.queueManager.ListDeadLetters(limit)
+	if err != nil {
+		respondDeadLetterError(c, "获取死信消息失败", err)
+		return
+	}
+	count, err := h.queueManager.DeadLetterCount()
+	if err != nil {
+		respondDeadLetterError(c, "获取死信队列状态失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":                messages,
+		"approximate_total_count": count,
+		"limit":                   limit,
+	})
+}
+
+// GetDeadLetter 查看单条死信消息
+func (h *Handlers) GetDeadLetter(c *gin.Context) {
+	message, err := h.queueManager.GetDeadLetter(c.Param("message_id"))
+	if err != nil {
+		respondDeadLetterError(c, "获取死信消息失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// RedriveDeadLetter 将死信消息重新投递到任务队列
+// 消息对应的任务已结束（如重试次数用完后标记为 failed）时先将任务置为 retrying，处理器才会重新处理
+func (h *Handlers) RedriveDeadLetter(c *gin.Context) {
+	messageID := c.Param("message_id")
+	message, err := h.queueManager.GetDeadLetter(messageID)
+	if err != nil {
+		respondDeadLetterError(c, "获取死信消息失败", err)
+		return
+	}
+
+	if message.TaskID != "" {
+		if transcodeTask, err := h.taskManager.GetTask(message.TaskID); err == nil && transcodeTask.Status.IsTerminal() {
+			if _, err := h.taskManager.RetryTask(message.TaskID, 0); err != nil {
+				respondTaskError(c, http.StatusInternalServerError, "重置任务状态失败", err)
+				return
+			}
+		}
+	}
+
+	message, err = h.queueManager.RedriveDeadLetter(messageID)
+	if err != nil {
+		respondDeadLetterError(c, "重新投递失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "死信消息已重新投递",
+		"dead_letter": message,
+		"task_id":     message.TaskID,
+	})
+}
+
+// DeleteDeadLetter 删除死信消息
+func (h *Handlers) DeleteDeadLetter(c *gin.Context) {
+	messageID := c.Param("message_id")
+	if err := h.queueManager.DeleteDeadLetter(messageID); err != nil {
+		respondDeadLetterError(c, "删除死信消息失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "死信消息已删除",
+		"message_id": messageID,
+	})
+}
+
+// respondDeadLetterError 将死信队列错误转换为 HTTP 响应
+func respondDeadLetterError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, queue.ErrNoDeadLetterQueue):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, queue.ErrMessageNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"error": fmt.Sprintf("%s: %v", message, err),
+	})
+}
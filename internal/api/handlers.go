@@ -1,28 +1,36 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"enhanced_video_transcoder/internal/queue"
+	"enhanced_video_transcoder/internal/storage"
 	"enhanced_video_transcoder/internal/task"
 )
 
 type Handlers struct {
 	queueManager *queue.Manager
 	taskManager  *task.Manager
+	store        storage.Storage
 	inputBucket  string
 	outputBucket string
 }
 
-func NewHandlers(queueManager *queue.Manager, taskManager *task.Manager, inputBucket, outputBucket string) *Handlers {
+func NewHandlers(queueManager *queue.Manager, taskManager *task.Manager, store storage.Storage, inputBucket, outputBucket string) *Handlers {
 	return &Handlers{
 		queueManager: queueManager,
 		taskManager:  taskManager,
+		store:        store,
 		inputBucket:  inputBucket,
 		outputBucket: outputBucket,
 	}
@@ -51,27 +59,64 @@ func (h *Handlers) AddTaskToQueue(c *gin.Context) {
 		return
 	}
 
-	// 创建任务记录
-	transcodeTask, err := h.taskManager.CreateTask(req.InputBucket, req.InputKey, h.outputBucket, req.TranscodeTypes)
+	idempotencyKey := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if idempotencyKey == "" {
+		idempotencyKey = strings.TrimSpace(req.IdempotencyKey)
+	}
+	if len(idempotencyKey) > task.MaxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("幂等键长度不能超过 %d", task.MaxIdempotencyKeyLength),
+		})
+		return
+	}
+
+	// 创建任务记录，携带幂等键时保留期内的重复提交返回原任务
+	var transcodeTask *task.TranscodeTask
+	var err error
+	created := true
+	if idempotencyKey != "" {
+		transcodeTask, created, err = h.taskManager.CreateTaskIdempotent(idempotencyKey, req.InputBucket, req.InputKey, h.outputBucket, req.TranscodeTypes, currentUsername(c), req.Priority)
+	} else {
+		transcodeTask, err = h.taskManager.CreateTask(req.InputBucket, req.InputKey, h.outputBucket, req.TranscodeTypes, currentUsername(c), req.Priority)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status := http.StatusInternalServerError
+		if errors.Is(err, task.ErrIdempotencyKeyReused) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{
 			"error": fmt.Sprintf("创建任务失败: %v", err),
 		})
 		return
 	}
 
 	// 发送消息到队列
-	queueMessage := &task.QueueMessage{
-		TaskID:         transcodeTask.TaskID,
-		InputBucket:    req.InputBucket,
-		InputKey:       req.InputKey,
-		OutputBucket:   h.outputBucket,
-		TranscodeTypes: req.TranscodeTypes,
+	// 重复提交时原任务仍为 pending 说明上次请求可能未能发送消息，重新发送；
+	// 多余的消息在处理时因任务状态已变化被跳过
+	if created || transcodeTask.Status == task.TaskStatusPending {
+		queueMessage := &task.QueueMessage{
+			TaskID:         transcodeTask.TaskID,
+			InputBucket:    transcodeTask.InputBucket,
+			InputKey:       transcodeTask.InputKey,
+			OutputBucket:   transcodeTask.OutputBucket,
+			TranscodeTypes: transcodeTask.TranscodeTypes,
+			Priority:       transcodeTask.Priority,
+		}
+
+		if err := h.queueManager.SendMessage(queueMessage); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("发送消息到队列失败: %v", err),
+			})
+			return
+		}
 	}
 
-	if err := h.queueManager.SendMessage(queueMessage); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("发送消息到队列失败: %v", err),
+	if !created {
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, gin.H{
+			"message": "重复提交，返回已创建的任务",
+			"task_id": transcodeTask.TaskID,
+			"task":    transcodeTask,
 		})
 		return
 	}
@@ -101,42 +146,110 @@ func (h *Handlers) GetTask(c *gin.Context) {
 		return
 	}
 
+	// 版本号作为 ETag 返回，客户端修改任务时可通过 If-Match 携带
+	c.Header("ETag", fmt.Sprintf("%q", strconv.FormatInt(transcodeTask.Version, 10)))
 	c.JSON(http.StatusOK, transcodeTask)
 }
 
-// ListTasks 获取任务列表
-func (h *Handlers) ListTasks(c *gin.Context) {
-	// 直接从查询参数获取，避免绑定问题
-	status := c.Query("status")
-	date := c.Query("date")
-	limit := 10
-	offset := 0
-
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := fmt.Sscanf(l, "%d", &limit); err != nil || parsed != 1 {
-			limit = 10
-		}
+// currentUsername 当前登录用户名（由认证中间件写入），未登录时返回空字符串
+func currentUsername(c *gin.Context) string {
+	username, exists := c.Get("username")
+	if !exists || username == nil {
+		return ""
 	}
-	if o := c.Query("offset"); o != "" {
-		if parsed, err := fmt.Sscanf(o, "%d", &offset); err != nil || parsed != 1 {
-			offset = 0
-		}
+	return fmt.Sprint(username)
+}
+
+// expectedVersion 从 If-Match 请求头读取客户端持有的任务版本，未提供时返回 0（不检查版本）
+func expectedVersion(c *gin.Context) (int64, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
 	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("无效的 If-Match 版本号: %s", c.GetHeader("If-Match"))
+	}
+	return version, nil
+}
 
-	// 调试：打印查询参数
-	log.Printf("🔍 ListTasks 原始查询参数: %s", c.Request.URL.RawQuery)
-	log.Printf("🔍 ListTasks 解析后: status=%q, date=%q, limit=%d, offset=%d", status, date, limit, offset)
+// respondTaskError 将任务修改错误映射为 HTTP 响应
+// 任务不存在返回 404；当前状态不允许该操作、并发冲突返回 409（附带当前状态），其他错误使用 fallbackStatus
+func respondTaskError(c *gin.Context, fallbackStatus int, message string, err error) {
+	var transition *task.TransitionError
+	var conflict *task.ConflictError
+	switch {
+	case errors.As(err, &transition):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          fmt.Sprintf("%s: %v", message, err),
+			"code":           "INVALID_TRANSITION",
+			"task_id":        transition.TaskID,
+			"current_status": transition.From,
+			"target_status":  transition.To,
+		})
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":           fmt.Sprintf("%s: %v", message, err),
+			"code":            "VERSION_CONFLICT",
+			"task_id":         conflict.TaskID,
+			"current_version": conflict.CurrentVersion,
+			"current_status":  conflict.CurrentStatus,
+		})
+	case errors.Is(err, task.ErrTaskNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("%s: %v", message, err),
+		})
+	default:
+		c.JSON(fallbackStatus, gin.H{
+			"error": fmt.Sprintf("%s: %v", message, err),
+		})
+	}
+}
+
+// ListTasks 获取任务列表（组合条件搜索 + 游标分页）
+func (h *Handlers) ListTasks(c *gin.Context) {
+	var req task.TaskListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("无效的查询参数: %v", err),
+		})
+		return
+	}
+
+	log.Printf("🔍 ListTasks 查询参数: %s", c.Request.URL.RawQuery)
 
 	// 限制范围
-	if limit <= 0 {
-		limit = 10
+	if req.Limit <= 0 {
+		req.Limit = task.DefaultListLimit
+	}
+	if req.Limit > 100 {
+		req.Limit = 100
+	}
+
+	filter := task.TaskFilter{
+		Status:        req.Status,
+		Date:          req.Date,
+		DateFrom:      req.DateFrom,
+		DateTo:        req.DateTo,
+		KeyPrefix:     req.KeyPrefix,
+		TranscodeType: req.TranscodeType,
+		CreatedBy:     req.CreatedBy,
+		ErrorStage:    req.ErrorStage,
 	}
-	if limit > 100 {
-		limit = 100
+	if req.Days > 0 && filter.Date == "" && filter.DateFrom == "" {
+		// 最近 N 天（含今天）
+		filter.DateFrom = time.Now().AddDate(0, 0, -(req.Days - 1)).Format("2006-01-02")
 	}
 
-	tasks, total, err := h.taskManager.ListTasks(status, date, limit, offset)
+	result, err := h.taskManager.SearchTasks(filter, req.Limit, req.Cursor, req.Count)
 	if err != nil {
+		if errors.Is(err, task.ErrInvalidCursor) || errors.Is(err, task.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("获取任务列表失败: %v", err),
 		})
@@ -144,10 +257,10 @@ func (h *Handlers) ListTasks(c *gin.Context) {
 	}
 
 	response := &task.TaskListResponse{
-		Tasks:  tasks,
-		Total:  total,
-		Limit:  limit,
-		Offset: offset,
+		Tasks:      result.Tasks,
+		Total:      result.Total,
+		Limit:      req.Limit,
+		NextCursor: result.NextCursor,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -163,20 +276,18 @@ func (h *Handlers) RetryTask(c *gin.Context) {
 		return
 	}
 
-	// 重试任务
-	if err := h.taskManager.RetryTask(taskID); err != nil {
+	version, err := expectedVersion(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("重试任务失败: %v", err),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// 获取更新后的任务
-	transcodeTask, err := h.taskManager.GetTask(taskID)
+	// 重试任务
+	transcodeTask, err := h.taskManager.RetryTask(taskID, version)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("获取任务失败: %v", err),
-		})
+		respondTaskError(c, http.StatusBadRequest, "重试任务失败", err)
 		return
 	}
 
@@ -187,6 +298,7 @@ func (h *Handlers) RetryTask(c *gin.Context) {
 		InputKey:       transcodeTask.InputKey,
 		OutputBucket:   transcodeTask.OutputBucket,
 		TranscodeTypes: transcodeTask.TranscodeTypes,
+		Priority:       transcodeTask.Priority,
 	}
 
 	if err := h.queueManager.SendMessage(queueMessage); err != nil {
@@ -203,7 +315,15 @@ func (h *Handlers) RetryTask(c *gin.Context) {
 }
 
 // UploadFile 上传文件接口
+// 文件写入输入桶的 uploads/<日期>/ 目录下，然后创建任务并发送到队列
 func (h *Handlers) UploadFile(c *gin.Context) {
+	if h.inputBucket == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "INPUT_BUCKET 未配置，无法上传文件",
+		})
+		return
+	}
+
 	// 获取上传的文件
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -218,15 +338,75 @@ func (h *Handlers) UploadFile(c *gin.Context) {
 	if transcodeTypesStr == "" {
 		transcodeTypesStr = "mp4_standard,mp4_smooth,thumbnail" // 默认转码类型
 	}
+	var transcodeTypes []string
+	for _, t := range strings.Split(transcodeTypesStr, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			transcodeTypes = append(transcodeTypes, t)
+		}
+	}
 
-	// TODO: 实现文件上传到S3的逻辑
-	// 这里需要根据实际需求实现文件上传功能
+	// 优先级（默认 normal）
+	priority := c.PostForm("priority")
+	if priority != "" && task.NormalizePriority(priority) != priority {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("无效的优先级: %s（可选 high/normal/bulk）", priority),
+		})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "文件上传功能待实现",
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("读取上传文件失败: %v", err),
+		})
+		return
+	}
+	defer src.Close()
+
+	// 写入对象存储
+	inputKey := fmt.Sprintf("uploads/%s/%s_%s", time.Now().Format("2006-01-02"), uuid.New().String()[:8], filepath.Base(file.Filename))
+	contentType := file.Header.Get("Content-Type")
+	if err := h.store.Put(c.Request.Context(), h.inputBucket, inputKey, src, file.Size, contentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("保存上传文件失败: %v", err),
+		})
+		return
+	}
+	log.Printf("✅ 文件上传成功: %s/%s (%d 字节)", h.inputBucket, inputKey, file.Size)
+
+	// 创建任务记录
+	transcodeTask, err := h.taskManager.CreateTask(h.inputBucket, inputKey, h.outputBucket, transcodeTypes, currentUsername(c), priority)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("创建任务失败: %v", err),
+		})
+		return
+	}
+
+	// 发送消息到队列
+	queueMessage := &task.QueueMessage{
+		TaskID:         transcodeTask.TaskID,
+		InputBucket:    h.inputBucket,
+		InputKey:       inputKey,
+		OutputBucket:   h.outputBucket,
+		TranscodeTypes: transcodeTypes,
+		Priority:       transcodeTask.Priority,
+	}
+
+	if err := h.queueManager.SendMessage(queueMessage); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("发送消息到队列失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "文件已上传并添加到队列",
+		"task_id":   transcodeTask.TaskID,
+		"input_key": inputKey,
 		"filename":  file.Filename,
 		"size":      file.Size,
-		"transcode": transcodeTypesStr,
+		"task":      transcodeTask,
 	})
 }
 
@@ -264,38 +444,24 @@ func (h *Handlers) CancelTask(c *gin.Context) {
 		return
 	}
 
-	// 获取任务
-	transcodeTask, err := h.taskManager.GetTask(taskID)
+	version, err := expectedVersion(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": fmt.Sprintf("任务不存在: %v", err),
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// 只能取消 pending 状态的任务
-	if transcodeTask.Status != task.TaskStatusPending {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("只能取消等待中的任务，当前状态: %s", transcodeTask.Status),
-		})
+	// 先更新任务状态为已取消（只能取消尚未开始处理的任务），处理器不会再处理已取消的任务
+	if _, err := h.taskManager.CancelTask(taskID, version, "用户取消"); err != nil {
+		respondTaskError(c, http.StatusInternalServerError, "取消任务失败", err)
 		return
 	}
 
-	// 尝试从队列中移除消息
+	// 再尝试从队列中移除消息，失败时消息被处理器收到后也会直接跳过
 	removed, err := h.queueManager.RemoveMessageByTaskID(taskID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("从队列移除消息失败: %v", err),
-		})
-		return
-	}
-
-	// 更新任务状态为已取消
-	if err := h.taskManager.UpdateTaskStatus(taskID, task.TaskStatusCancelled, "用户取消"); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("更新任务状态失败: %v", err),
-		})
-		return
+		log.Printf("⚠️  从队列移除消息失败 [%s]: %v", taskID, err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -315,36 +481,17 @@ func (h *Handlers) AbortTask(c *gin.Context) {
 		return
 	}
 
-	// 获取任务
-	transcodeTask, err := h.taskManager.GetTask(taskID)
+	version, err := expectedVersion(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": fmt.Sprintf("任务不存在: %v", err),
-		})
-		return
-	}
-
-	// 只能中止 processing 状态的任务
-	if transcodeTask.Status != task.TaskStatusProcessing {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("只能中止处理中的任务，当前状态: %s", transcodeTask.Status),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// 将未完成的转码类型状态设置为 failed
-	if err := h.taskManager.MarkIncompleteProgressAsFailed(taskID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("更新转码进度失败: %v", err),
-		})
-		return
-	}
-
-	// 更新任务状态为失败（中止的任务统一使用 failed 状态）
-	if err := h.taskManager.UpdateTaskStatus(taskID, task.TaskStatusFailed, "用户手动中止"); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("更新任务状态失败: %v", err),
-		})
+	// 原子地将任务置为 aborted 并将未完成的转码类型设置为 aborted（已失败的保持 failed，只能中止 processing 状态的任务）
+	if _, err := h.taskManager.AbortTask(taskID, version, "用户手动中止"); err != nil {
+		respondTaskError(c, http.StatusInternalServerError, "中止任务失败", err)
 		return
 	}
 
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"enhanced_video_transcoder/internal/ingest"
+	"enhanced_video_transcoder/internal/transcode"
+)
+
+// IngestHandlers S3 接入规则管理接口
+type IngestHandlers struct {
+	rules         *ingest.Manager
+	presetManager *transcode.PresetManager
+}
+
+func NewIngestHandlers(rules *ingest.Manager, presetManager *transcode.PresetManager) *IngestHandlers {
+	return &IngestHandlers{
+		rules:         rules,
+		presetManager: presetManager,
+	}
+}
+
+// MatchIngestRuleRequest 规则匹配测试请求
+type MatchIngestRuleRequest struct {
+	Bucket string `json:"bucket" binding:"required"`
+	Key    string `json:"key" binding:"required"`
+	Size   *int64 `json:"size"` // 为空时不检查大小范围
+}
+
+// ListIngestRules 按匹配顺序列出所有接入规则
+func (h *IngestHandlers) ListIngestRules(c *gin.Context) {
+	rules, err := h.rules.ListRules()
+	if err != nil {
+		respondIngestRuleError(c, "获取接入规则失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+		"total": len(rules),
+	})
+}
+
+// GetIngestRule 获取单条接入规则
+func (h *IngestHandlers) GetIngestRule(c *gin.Context) {
+	rule, err := h.rules.GetRule(c.Param("rule_id"))
+	if err != nil {
+		respondIngestRuleError(c, "获取接入规则失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateIngestRule 创建接入规则
+func (h *IngestHandlers) CreateIngestRule(c *gin.Context) {
+	var rule ingest.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("请求参数错误: %v", err),
+		})
+		return
+	}
+	rule.RuleID = ""
+
+	if err := h.saveRule(&rule); err != nil {
+		respondIngestRuleError(c, "保存接入规则失败", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "接入规则创建成功",
+		"rule":    rule,
+	})
+}
+
+// UpdateIngestRule 整体替换接入规则（保留创建时间）
+func (h *IngestHandlers) UpdateIngestRule(c *gin.Context) {
+	existing, err := h.rules.GetRule(c.Param("rule_id"))
+	if err != nil {
+		respondIngestRuleError(c, "获取接入规则失败", err)
+		return
+	}
+
+	var rule ingest.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("请求参数错误: %v", err),
+		})
+		return
+	}
+	rule.RuleID = existing.RuleID
+	rule.CreatedAt = existing.CreatedAt
+
+	if err := h.saveRule(&rule); err != nil {
+		respondIngestRuleError(c, "保存接入规则失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "接入规则更新成功",
+		"rule":    rule,
+	})
+}
+
+// DeleteIngestRule 删除接入规则
+func (h *IngestHandlers) DeleteIngestRule(c *gin.Context) {
+	if err := h.rules.DeleteRule(c.Param("rule_id")); err != nil {
+		respondIngestRuleError(c, "删除接入规则失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "接入规则删除成功",
+	})
+}
+
+// MatchIngestRule 测试对象会匹配哪条规则，以及 S3 事件会如何处理
+func (h *IngestHandlers) MatchIngestRule(c *gin.Context) {
+	var req MatchIngestRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("请求参数错误: %v", err),
+		})
+		return
+	}
+
+	size := int64(-1)
+	if req.Size != nil {
+		size = *req.Size
+	}
+	// 规则刚修改时缓存已失效，这里读到的就是最新规则
+	rule := h.rules.Match(req.Bucket, req.Key, size)
+	switch {
+	case rule == nil && !ingest.IsVideoFile(req.Key):
+		c.JSON(http.StatusOK, gin.H{"matched": false, "action": "ignore"})
+	case rule == nil:
+		c.JSON(http.StatusOK, gin.H{"matched": false, "action": "transcode_default"})
+	case rule.Ignore:
+		c.JSON(http.StatusOK, gin.H{"matched": true, "action": "ignore", "rule": rule})
+	default:
+		c.JSON(http.StatusOK, gin.H{"matched": true, "action": "transcode", "rule": rule})
+	}
+}
+
+// saveRule 检查规则引用的转码预设都存在后保存
+func (h *IngestHandlers) saveRule(rule *ingest.Rule) error {
+	for _, presetID := range rule.TranscodeTypes {
+		if _, err := h.presetManager.GetPreset(presetID); err != nil {
+			return fmt.Errorf("%w: 转码预设不存在: %s", ingest.ErrInvalidRule, presetID)
+		}
+	}
+	return h.rules.SaveRule(rule)
+}
+
+// respondIngestRuleError 将接入规则错误映射为 HTTP 状态码
+func respondIngestRuleError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ingest.ErrRuleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ingest.ErrInvalidRule):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{
+		"error": fmt.Sprintf("%s: %v", message, err),
+	})
+}
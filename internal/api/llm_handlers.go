@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -10,25 +12,31 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"enhanced_video_transcoder/internal/llm"
+	"enhanced_video_transcoder/internal/storage"
 	"enhanced_video_transcoder/internal/transcode"
 )
 
 // 本地测试视频相对路径（相对于 internal/api 目录）
+// 本地不存在时，从对象存储输入桶的同名 key 下载
 const localTestVideoPath = "resources/test-video.mp4"
 
 // LLMHandlers LLM 相关的处理器
 type LLMHandlers struct {
-	bedrockClient *llm.BedrockClient
-	processor     *transcode.Processor
-	presetManager *transcode.PresetManager
+	bedrockClient   *llm.BedrockClient
+	processor       *transcode.Processor
+	presetManager   *transcode.PresetManager
+	store           storage.Storage
+	testVideoBucket string
 }
 
 // NewLLMHandlers 创建 LLM 处理器
-func NewLLMHandlers(bedrockClient *llm.BedrockClient, processor *transcode.Processor, presetManager *transcode.PresetManager) *LLMHandlers {
+func NewLLMHandlers(bedrockClient *llm.BedrockClient, processor *transcode.Processor, presetManager *transcode.PresetManager, store storage.Storage, testVideoBucket string) *LLMHandlers {
 	return &LLMHandlers{
-		bedrockClient: bedrockClient,
-		processor:     processor,
-		presetManager: presetManager,
+		bedrockClient:   bedrockClient,
+		processor:       processor,
+		presetManager:   presetManager,
+		store:           store,
+		testVideoBucket: testVideoBucket,
 	}
 }
 
@@ -246,7 +254,51 @@ func (h *LLMHandlers) ensureTestVideo() (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("本地测试视频不存在，请确保文件存在于 internal/api/%s", localTestVideoPath)
+	// 本地不存在时从对象存储下载
+	if h.store != nil && h.testVideoBucket != "" {
+		path, err := h.downloadTestVideo()
+		if err == nil {
+			return path, nil
+		}
+		log.Printf("⚠️ [AutoTest] 从存储获取测试视频失败: %v", err)
+	}
+
+	return "", fmt.Errorf("测试视频不存在，请确保文件存在于 internal/api/%s 或存储桶 %s 的同名路径下", localTestVideoPath, h.testVideoBucket)
+}
+
+// downloadTestVideo 从对象存储下载测试视频，按大小判断本地缓存是否可复用
+func (h *LLMHandlers) downloadTestVideo() (string, error) {
+	ctx := context.TODO()
+	info, err := h.store.Head(ctx, h.testVideoBucket, localTestVideoPath)
+	if err != nil {
+		return "", err
+	}
+
+	cachePath := filepath.Join(os.TempDir(), "transcode_test_video"+filepath.Ext(localTestVideoPath))
+	if stat, err := os.Stat(cachePath); err == nil && stat.Size() == info.Size {
+		log.Printf("✅ [AutoTest] 使用缓存的测试视频: %s", cachePath)
+		return cachePath, nil
+	}
+
+	body, _, err := h.store.Get(ctx, h.testVideoBucket, localTestVideoPath)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	file, err := os.Create(cachePath)
+	if err != nil {
+		return "", fmt.Errorf("创建测试视频缓存失败: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, body); err != nil {
+		os.Remove(cachePath)
+		return "", fmt.Errorf("写入测试视频缓存失败: %v", err)
+	}
+
+	log.Printf("✅ [AutoTest] 已从存储 [%s] 下载测试视频: %s/%s", h.store.Backend(), h.testVideoBucket, localTestVideoPath)
+	return cachePath, nil
 }
 
 // TestFFmpegRequest 测试 FFmpeg 参数请求
@@ -363,8 +415,13 @@ func (h *LLMHandlers) FixFFmpegParams(c *gin.Context) {
 type SavePresetRequest struct {
 	Name        string   `json:"name" binding:"required"`
 	Description string   `json:"description"`
-	FFmpegArgs  []string `json:"ffmpeg_args" binding:"required"`
-	OutputExt   string   `json:"output_ext" binding:"required"`
+	// Spec 结构化参数，按运行平台编译为 FFmpeg 参数；与 FFmpegArgs 二选一
+	Spec       *transcode.PresetSpec `json:"spec"`
+	FFmpegArgs []string              `json:"ffmpeg_args"`
+	// OutputExt 使用 Spec 时可省略，按封装格式确定
+	OutputExt string `json:"output_ext"`
+	// Target 档位占位符（{width}、{scale}、{video_bitrate} 等）的规划目标，为空时使用码率阶梯中的最高档
+	Target *transcode.Rendition `json:"target"`
 }
 
 // SavePreset 保存自定义预设
@@ -377,14 +434,48 @@ func (h *LLMHandlers) SavePreset(c *gin.Context) {
 		return
 	}
 
-	platformInfo := h.processor.GetPlatformInfo()
+	if (req.Spec == nil) == (len(req.FFmpegArgs) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: spec 和 ffmpeg_args 必须且只能设置一个",
+		})
+		return
+	}
+	if req.Spec == nil && req.OutputExt == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: 使用 ffmpeg_args 时 output_ext 不能为空",
+		})
+		return
+	}
+	if req.Spec != nil {
+		if err := req.Spec.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("请求参数错误: %v", err),
+			})
+			return
+		}
+	}
+
+	if req.Target != nil && (req.Target.Width <= 0 || req.Target.Height <= 0 || req.Target.VideoBitrate <= 0) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求参数错误: target 的 width、height、video_bitrate 必须大于 0",
+		})
+		return
+	}
+
+	// 原始参数只适用于生成它的平台，结构化参数在各平台编译
+	platform := string(h.processor.GetPlatformInfo().Platform)
+	if req.Spec != nil {
+		platform = "all"
+	}
 
 	preset := &transcode.TranscodePreset{
 		Name:        req.Name,
 		Description: req.Description,
+		Spec:        req.Spec,
 		FFmpegArgs:  req.FFmpegArgs,
 		OutputExt:   req.OutputExt,
-		Platform:    string(platformInfo.Platform),
+		Platform:    platform,
+		Target:      req.Target,
 	}
 
 	if err := h.presetManager.SavePreset(preset); err != nil {
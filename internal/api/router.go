@@ -6,7 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(handlers *Handlers, llmHandlers *LLMHandlers, authHandlers *AuthHandlers, debug bool) *gin.Engine {
+func SetupRouter(handlers *Handlers, llmHandlers *LLMHandlers, authHandlers *AuthHandlers, ingestHandlers *IngestHandlers, debug bool) *gin.Engine {
 	if !debug {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -49,6 +49,12 @@ func SetupRouter(handlers *Handlers, llmHandlers *LLMHandlers, authHandlers *Aut
 				queue.GET("/status", handlers.GetQueueStatus)
 				queue.POST("/add", handlers.AddTaskToQueue)
 				queue.DELETE("/purge", handlers.PurgeQueue)
+
+				// 死信队列
+				queue.GET("/dlq", handlers.ListDeadLetters)
+				queue.GET("/dlq/:message_id", handlers.GetDeadLetter)
+				queue.POST("/dlq/:message_id/redrive", handlers.RedriveDeadLetter)
+				queue.DELETE("/dlq/:message_id", handlers.DeleteDeadLetter)
 			}
 
 			// 任务管理
@@ -78,6 +84,17 @@ func SetupRouter(handlers *Handlers, llmHandlers *LLMHandlers, authHandlers *Aut
 				presets.DELETE("/:preset_id", llmHandlers.DeletePreset)
 			}
 
+			// S3 接入规则
+			ingestRules := authenticated.Group("/ingest-rules")
+			{
+				ingestRules.GET("", ingestHandlers.ListIngestRules)
+				ingestRules.POST("", ingestHandlers.CreateIngestRule)
+				ingestRules.POST("/match", ingestHandlers.MatchIngestRule)
+				ingestRules.GET("/:rule_id", ingestHandlers.GetIngestRule)
+				ingestRules.PUT("/:rule_id", ingestHandlers.UpdateIngestRule)
+				ingestRules.DELETE("/:rule_id", ingestHandlers.DeleteIngestRule)
+			}
+
 			// 文件上传
 			authenticated.POST("/upload", handlers.UploadFile)
 
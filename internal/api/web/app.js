@@ -5,9 +5,13 @@ const API_BASE = '/api';
 let currentPage = 1;
 let pageSize = 10;
 let totalTasks = 0;
+let taskCursors = [''];     // taskCursors[i] 为第 i+1 页的游标
+let hasMoreTasks = false;
 
 // 仪表盘任务列表状态
 let dashboardTasksPage = 1;
+let dashboardCursors = [''];
+let dashboardHasMore = false;
 let dashboardTasksTotal = 0;
 let dashboardTasksStatus = '';
 
@@ -592,12 +596,12 @@ async function loadTaskStats() {
         document.getElementById('pendingTasks').textContent = queueData.approximate_number_of_messages || 0;
         document.getElementById('processingTasks').textContent = queueData.approximate_number_of_messages_not_visible || 0;
         
-        const completedRes = await authFetch(`${API_BASE}/tasks?status=completed&limit=1`);
+        const completedRes = await authFetch(`${API_BASE}/tasks?status=completed&limit=1&count=true`);
         if (!completedRes) return;
         const completedData = await completedRes.json();
         document.getElementById('completedTasks').textContent = completedData.total || 0;
         
-        const failedRes = await authFetch(`${API_BASE}/tasks?status=failed&limit=1`);
+        const failedRes = await authFetch(`${API_BASE}/tasks?status=failed&limit=1&count=true`);
         if (!failedRes) return;
         const failedData = await failedRes.json();
         document.getElementById('failedTasks').textContent = failedData.total || 0;
@@ -609,20 +613,25 @@ async function loadTaskStats() {
 async function showTasksByStatus(status) {
     dashboardTasksStatus = status;
     dashboardTasksPage = 1;
+    dashboardCursors = [''];
     await loadDashboardTasks();
     document.getElementById('dashboardTasksSection').style.display = 'block';
-    const statusNames = { 'pending': '等待中', 'processing': '处理中', 'completed': '已完成', 'failed': '失败' };
+    const statusNames = { 'pending': '等待中', 'processing': '处理中', 'completed': '已完成', 'failed': '失败', 'aborted': '已中止' };
     document.getElementById('dashboardTasksTitle').textContent = `📋 ${statusNames[status] || status}任务`;
     document.getElementById('dashboardTasksSection').scrollIntoView({ behavior: 'smooth' });
 }
 
 async function loadDashboardTasks() {
-    const offset = (dashboardTasksPage - 1) * pageSize;
+    const cursor = dashboardCursors[dashboardTasksPage - 1] || '';
+    // 总数只在第一页统计一次
+    const countParam = dashboardTasksPage === 1 ? '&count=true' : '';
     try {
-        const res = await authFetch(`${API_BASE}/tasks?status=${dashboardTasksStatus}&limit=${pageSize}&offset=${offset}`);
+        const res = await authFetch(`${API_BASE}/tasks?status=${dashboardTasksStatus}&limit=${pageSize}&cursor=${encodeURIComponent(cursor)}${countParam}`);
         if (!res) return;
         const data = await res.json();
-        dashboardTasksTotal = data.total || 0;
+        if (data.total !== undefined) dashboardTasksTotal = data.total;
+        dashboardCursors[dashboardTasksPage] = data.next_cursor || '';
+        dashboardHasMore = !!data.next_cursor;
         const tbody = document.querySelector('#dashboardTasksTable tbody');
         tbody.innerHTML = '';
         if (data.tasks && data.tasks.length > 0) {
@@ -638,21 +647,8 @@ async function loadDashboardTasks() {
 }
 
 function renderDashboardPagination() {
-    const totalPages = Math.ceil(dashboardTasksTotal / pageSize);
     const pagination = document.getElementById('dashboardTasksPagination');
-    if (totalPages <= 1) {
-        pagination.innerHTML = dashboardTasksTotal > 0 ? `<span style="color:#666;">共 ${dashboardTasksTotal} 条</span>` : '';
-        return;
-    }
-    let html = `<button ${dashboardTasksPage === 1 ? 'disabled' : ''} onclick="goToDashboardPage(${dashboardTasksPage - 1})">上一页</button>`;
-    const startPage = Math.max(1, dashboardTasksPage - 2);
-    const endPage = Math.min(totalPages, startPage + 4);
-    for (let i = startPage; i <= endPage; i++) {
-        html += `<button class="${i === dashboardTasksPage ? 'active' : ''}" onclick="goToDashboardPage(${i})">${i}</button>`;
-    }
-    html += `<button ${dashboardTasksPage === totalPages ? 'disabled' : ''} onclick="goToDashboardPage(${dashboardTasksPage + 1})">下一页</button>`;
-    html += `<span style="margin-left:10px;color:#666;">共 ${dashboardTasksTotal} 条</span>`;
-    pagination.innerHTML = html;
+    pagination.innerHTML = renderCursorPagination(dashboardTasksPage, dashboardHasMore, dashboardTasksTotal, 'goToDashboardPage');
 }
 
 function goToDashboardPage(page) { dashboardTasksPage = page; loadDashboardTasks(); }
@@ -680,16 +676,26 @@ async function loadRecentTasks() {
 async function loadTasks() {
     const status = document.getElementById('statusFilter').value;
     const date = document.getElementById('dateFilter').value;
-    const offset = (currentPage - 1) * pageSize;
-    let url = `${API_BASE}/tasks?limit=${pageSize}&offset=${offset}`;
+    if (currentPage === 1) taskCursors = [''];
+    const cursor = taskCursors[currentPage - 1] || '';
+    let url = `${API_BASE}/tasks?limit=${pageSize}&cursor=${encodeURIComponent(cursor)}`;
+    const keyPrefix = document.getElementById('keyPrefixFilter').value.trim();
+    const transcodeType = document.getElementById('transcodeTypeFilter').value.trim();
     if (status) url += `&status=${status}`;
     if (date) url += `&date=${date}`;
+    if (keyPrefix) url += `&key_prefix=${encodeURIComponent(keyPrefix)}`;
+    if (transcodeType) url += `&transcode_type=${encodeURIComponent(transcodeType)}`;
+    // 总数只在第一页统计一次
+    if (currentPage === 1) url += '&count=true';
     
     try {
         const res = await authFetch(url);
         if (!res) return;
         const data = await res.json();
-        totalTasks = data.total || 0;
+        if (!res.ok) { showToast(data.error || '加载任务列表失败', 'error'); return; }
+        if (data.total !== undefined) totalTasks = data.total;
+        taskCursors[currentPage] = data.next_cursor || '';
+        hasMoreTasks = !!data.next_cursor;
         const tbody = document.querySelector('#tasksTable tbody');
         tbody.innerHTML = '';
         if (data.tasks && data.tasks.length > 0) {
@@ -704,6 +710,7 @@ async function loadTasks() {
     }
 }
 
+function searchTasks() { currentPage = 1; loadTasks(); }
 function refreshTasks() { currentPage = 1; loadTasks(); loadQueueStats(); showToast('任务列表已刷新', 'success'); }
 function clearDateFilter() { document.getElementById('dateFilter').value = ''; currentPage = 1; loadTasks(); }
 
@@ -714,7 +721,7 @@ function createTaskRow(task, simple) {
     const shortId = task.task_id.substring(0, 8) + '...';
     
     if (simple) {
-        const canRerunSimple = task.status !== 'processing';
+        const canRerunSimple = isTerminalStatus(task.status);
         const canAbortSimple = task.status === 'processing';
         return `<tr>
             <td title="${task.task_id}">${shortId}</td>
@@ -723,16 +730,16 @@ function createTaskRow(task, simple) {
             <td>${createdAt}</td>
             <td><div class="action-btns">
                 <button class="btn btn-secondary btn-small" onclick="viewTask('${task.task_id}')">详情</button>
-                ${canRerunSimple ? `<button class="btn btn-primary btn-small" onclick="retryTask('${task.task_id}')">重新运行</button>` : ''}
-                ${canAbortSimple ? `<button class="btn btn-danger btn-small" onclick="abortTask('${task.task_id}')">中止</button>` : ''}
+                ${canRerunSimple ? `<button class="btn btn-primary btn-small" onclick="retryTask('${task.task_id}', ${task.version || 0})">重新运行</button>` : ''}
+                ${canAbortSimple ? `<button class="btn btn-danger btn-small" onclick="abortTask('${task.task_id}', ${task.version || 0})">中止</button>` : ''}
             </div></td>
         </tr>`;
     }
     
     const transcodeTypes = task.transcode_types ? task.transcode_types.join(', ') : '-';
-    const progress = getProgressSummary(task.progress);
-    const canRerun = task.status !== 'processing';
-    const canCancel = task.status === 'pending';
+    const progress = getProgressSummary(task);
+    const canRerun = isTerminalStatus(task.status);
+    const canCancel = task.status === 'pending' || task.status === 'retrying';
     const canAbort = task.status === 'processing';
     
     return `<tr>
@@ -744,44 +751,64 @@ function createTaskRow(task, simple) {
         <td>${createdAt}</td>
         <td><div class="action-btns">
             <button class="btn btn-secondary btn-small" onclick="viewTask('${task.task_id}')">详情</button>
-            ${canRerun ? `<button class="btn btn-primary btn-small" onclick="retryTask('${task.task_id}')">重新运行</button>` : ''}
-            ${canCancel ? `<button class="btn btn-danger btn-small" onclick="cancelTask('${task.task_id}')">取消</button>` : ''}
-            ${canAbort ? `<button class="btn btn-danger btn-small" onclick="abortTask('${task.task_id}')">中止</button>` : ''}
+            ${canRerun ? `<button class="btn btn-primary btn-small" onclick="retryTask('${task.task_id}', ${task.version || 0})">重新运行</button>` : ''}
+            ${canCancel ? `<button class="btn btn-danger btn-small" onclick="cancelTask('${task.task_id}', ${task.version || 0})">取消</button>` : ''}
+            ${canAbort ? `<button class="btn btn-danger btn-small" onclick="abortTask('${task.task_id}', ${task.version || 0})">中止</button>` : ''}
         </div></td>
     </tr>`;
 }
 
-function getProgressSummary(progress) {
+function getProgressSummary(task) {
+    const progress = task.progress;
     if (!progress) return '-';
     const values = Object.values(progress);
     const completed = values.filter(v => v === 'completed').length;
-    return values.length === 0 ? '-' : `${completed}/${values.length}`;
+    if (values.length === 0) return '-';
+    if (task.status !== 'processing') return `${completed}/${values.length}`;
+    // 处理中的任务附带整体百分比（已完成的类型按 100% 计）
+    const details = task.progress_details || {};
+    const total = Object.entries(progress).reduce((sum, [type, status]) => {
+        if (status === 'completed') return sum + 100;
+        return sum + (details[type] ? details[type].percent : 0);
+    }, 0);
+    return `${completed}/${values.length} (${Math.round(total / values.length)}%)`;
+}
+
+// 格式化剩余秒数
+function formatETA(seconds) {
+    if (seconds == null || seconds < 0) return '未知';
+    if (seconds < 60) return `${seconds}秒`;
+    const minutes = Math.floor(seconds / 60);
+    if (minutes < 60) return `${minutes}分${seconds % 60}秒`;
+    return `${Math.floor(minutes / 60)}小时${minutes % 60}分`;
+}
+
+// 单个转码类型的实时进度条
+function renderProgressDetail(detail) {
+    const percent = Math.min(100, Math.max(0, detail.percent || 0));
+    const stats = [`${percent.toFixed(1)}%`];
+    if (detail.fps) stats.push(`${detail.fps.toFixed(1)} fps`);
+    if (detail.speed) stats.push(`${detail.speed.toFixed(2)}x`);
+    stats.push(`剩余 ${formatETA(detail.eta_seconds)}`);
+    return `<div class="progress-bar"><div class="progress-bar-fill" style="width:${percent}%"></div></div>
+        <div class="progress-stats">${stats.join(' · ')}</div>`;
 }
 
 function renderPagination() {
-    const totalPages = Math.ceil(totalTasks / pageSize);
     const pagination = document.getElementById('tasksPagination');
-    if (totalPages <= 1) {
-        pagination.innerHTML = totalTasks > 0 ? `<span style="color:#666;">共 ${totalTasks} 条</span>` : '';
-        return;
-    }
-    let html = `<button ${currentPage === 1 ? 'disabled' : ''} onclick="goToPage(${currentPage - 1})">上一页</button>`;
-    const startPage = Math.max(1, currentPage - 2);
-    const endPage = Math.min(totalPages, startPage + 4);
-    if (startPage > 1) {
-        html += `<button onclick="goToPage(1)">1</button>`;
-        if (startPage > 2) html += `<span style="padding:0 8px;">...</span>`;
-    }
-    for (let i = startPage; i <= endPage; i++) {
-        html += `<button class="${i === currentPage ? 'active' : ''}" onclick="goToPage(${i})">${i}</button>`;
-    }
-    if (endPage < totalPages) {
-        if (endPage < totalPages - 1) html += `<span style="padding:0 8px;">...</span>`;
-        html += `<button onclick="goToPage(${totalPages})">${totalPages}</button>`;
+    pagination.innerHTML = renderCursorPagination(currentPage, hasMoreTasks, totalTasks, 'goToPage');
+}
+
+// 游标分页只能逐页前进或后退（已访问页的游标会被缓存）
+function renderCursorPagination(page, hasMore, total, goFn) {
+    if (page === 1 && !hasMore) {
+        return total > 0 ? `<span style="color:#666;">共 ${total} 条</span>` : '';
     }
-    html += `<button ${currentPage === totalPages ? 'disabled' : ''} onclick="goToPage(${currentPage + 1})">下一页</button>`;
-    html += `<span style="margin-left:10px;color:#666;">共 ${totalTasks} 条</span>`;
-    pagination.innerHTML = html;
+    let html = `<button ${page === 1 ? 'disabled' : ''} onclick="${goFn}(${page - 1})">上一页</button>`;
+    html += `<button class="active">${page}</button>`;
+    html += `<button ${hasMore ? '' : 'disabled'} onclick="${goFn}(${page + 1})">下一页</button>`;
+    html += `<span style="margin-left:10px;color:#666;">共 ${total} 条</span>`;
+    return html;
 }
 
 function goToPage(page) { currentPage = page; loadTasks(); }
@@ -816,9 +843,13 @@ function createTaskDetail(task) {
     
     if (task.progress && Object.keys(task.progress).length > 0) {
         html += `<h4 style="margin-top:20px;margin-bottom:10px;">转码进度</h4><div class="progress-list">`;
+        const details = task.progress_details || {};
         for (const [type, status] of Object.entries(task.progress)) {
-            const progressClass = status === 'completed' ? 'status-completed' : status === 'failed' ? 'status-failed' : 'status-pending';
+            const progressClass = ['completed', 'failed', 'aborted'].includes(status) ? `status-${status}` : 'status-pending';
             html += `<div class="progress-item"><span>${type}</span><span class="status-badge ${progressClass}">${status}</span></div>`;
+            if (status === 'processing' && details[type]) {
+                html += renderProgressDetail(details[type]);
+            }
         }
         html += `</div>`;
     }
@@ -847,13 +878,13 @@ function createTaskDetail(task) {
         });
     }
     
-    const canRerun = task.status !== 'processing';
-    const canCancel = task.status === 'pending';
+    const canRerun = isTerminalStatus(task.status);
+    const canCancel = task.status === 'pending' || task.status === 'retrying';
     const canAbort = task.status === 'processing';
     html += `<div style="margin-top:24px;display:flex;gap:12px;">
-        ${canRerun ? `<button class="btn btn-primary" onclick="retryTask('${task.task_id}');closeModal();">🔄 重新运行</button>` : ''}
-        ${canCancel ? `<button class="btn btn-danger" onclick="cancelTask('${task.task_id}');closeModal();">❌ 取消任务</button>` : ''}
-        ${canAbort ? `<button class="btn btn-danger" onclick="abortTask('${task.task_id}');closeModal();">⛔ 中止任务</button>` : ''}
+        ${canRerun ? `<button class="btn btn-primary" onclick="retryTask('${task.task_id}', ${task.version || 0});closeModal();">🔄 重新运行</button>` : ''}
+        ${canCancel ? `<button class="btn btn-danger" onclick="cancelTask('${task.task_id}', ${task.version || 0});closeModal();">❌ 取消任务</button>` : ''}
+        ${canAbort ? `<button class="btn btn-danger" onclick="abortTask('${task.task_id}', ${task.version || 0});closeModal();">⛔ 中止任务</button>` : ''}
         <button class="btn btn-secondary" onclick="closeModal()">关闭</button>
     </div>`;
     return html;
@@ -861,34 +892,55 @@ function createTaskDetail(task) {
 
 function closeModal() { document.getElementById('taskDetailModal').classList.remove('active'); }
 
-async function retryTask(taskId) {
+// 终态任务才能重新运行，与服务端状态迁移表保持一致
+function isTerminalStatus(status) {
+    return ['completed', 'failed', 'aborted', 'cancelled'].includes(status);
+}
+
+// 任务版本作为 If-Match 发送，任务在此期间被修改时服务端返回 409
+function versionHeaders(version) {
+    return version ? { 'If-Match': `"${version}"` } : {};
+}
+
+// 处理任务操作的冲突响应：提示后刷新列表
+function handleTaskConflict(res, data) {
+    if (res.status !== 409) return false;
+    showToast(`任务状态已变化（当前: ${getStatusText(data.current_status) || '未知'}），已刷新`, 'error');
+    loadTasks(); loadDashboard();
+    return true;
+}
+
+async function retryTask(taskId, version) {
     if (!confirm('确定要重新运行此任务吗？')) return;
     try {
-        const res = await authFetch(`${API_BASE}/tasks/${taskId}/retry`, { method: 'POST' });
+        const res = await authFetch(`${API_BASE}/tasks/${taskId}/retry`, { method: 'POST', headers: versionHeaders(version) });
         if (!res) return;
         const data = await res.json();
+        if (handleTaskConflict(res, data)) return;
         if (res.ok) { showToast('任务已重新加入队列', 'success'); loadTasks(); loadDashboard(); }
         else { showToast(data.error || '重新运行失败', 'error'); }
     } catch (e) { showToast('重新运行任务失败', 'error'); }
 }
 
-async function cancelTask(taskId) {
+async function cancelTask(taskId, version) {
     if (!confirm('确定要取消此任务吗？')) return;
     try {
-        const res = await authFetch(`${API_BASE}/tasks/${taskId}`, { method: 'DELETE' });
+        const res = await authFetch(`${API_BASE}/tasks/${taskId}`, { method: 'DELETE', headers: versionHeaders(version) });
         if (!res) return;
         const data = await res.json();
+        if (handleTaskConflict(res, data)) return;
         if (res.ok) { showToast('任务已取消', 'success'); loadTasks(); loadDashboard(); }
         else { showToast(data.error || '取消失败', 'error'); }
     } catch (e) { showToast('取消任务失败', 'error'); }
 }
 
-async function abortTask(taskId) {
+async function abortTask(taskId, version) {
     if (!confirm('⚠️ 确定要中止此正在运行的任务吗？')) return;
     try {
-        const res = await authFetch(`${API_BASE}/tasks/${taskId}/abort`, { method: 'POST' });
+        const res = await authFetch(`${API_BASE}/tasks/${taskId}/abort`, { method: 'POST', headers: versionHeaders(version) });
         if (!res) return;
         const data = await res.json();
+        if (handleTaskConflict(res, data)) return;
         if (res.ok) { showToast('任务已中止', 'success'); loadTasks(); loadDashboard(); }
         else { showToast(data.error || '中止失败', 'error'); }
     } catch (e) { showToast('中止任务失败', 'error'); }
@@ -938,7 +990,7 @@ async function submitTask(event) {
 // ==================== 工具函数 ====================
 
 function getStatusText(status) {
-    const map = { 'pending': '等待中', 'processing': '处理中', 'completed': '已完成', 'failed': '失败', 'retrying': '重试中', 'cancelled': '已取消' };
+    const map = { 'pending': '等待中', 'processing': '处理中', 'completed': '已完成', 'failed': '失败', 'retrying': '重试中', 'cancelled': '已取消', 'aborted': '已中止' };
     return map[status] || status;
 }
 
@@ -16,6 +16,27 @@ type Config struct {
 	SQSQueueURL   string
 	DynamoDBTable string
 
+	// 任务存储配置
+	TaskStoreBackend string // dynamodb / sqlite
+	SQLitePath       string // sqlite 后端的数据库文件
+	IdempotencyTTL   time.Duration // 提交任务时幂等键的保留时间
+
+	// 队列配置
+	QueueBackend string // sqs / memory / file
+	QueueDir     string // file 后端的消息目录，high / bulk 通道使用其下的同名子目录
+
+	// 优先级通道配置（sqs 后端未配置时该优先级使用 SQS_QUEUE_URL）
+	SQSHighQueueURL string
+	SQSBulkQueueURL string
+
+	// 死信队列配置
+	SQSDeadLetterQueueURL string // sqs 后端的死信队列URL，为空时不启用死信队列
+	DeadLetterQueueDir    string // file 后端的死信消息目录
+
+	// 对象存储配置
+	StorageBackend  string // s3 / local
+	LocalStorageDir string // local 后端的根目录，目录结构为 <dir>/<bucket>/<key>
+
 	// 用户认证配置
 	UserTable string
 	JWTSecret string
@@ -30,12 +51,32 @@ type Config struct {
 	TempDir            string
 	MaxConcurrentTasks int
 	PollInterval       time.Duration
+	VisibilityTimeout  time.Duration // 消息被接收后的不可见时长，处理期间每隔 1/3 自动续期
+	DrainTimeout       time.Duration // 关闭时等待进行中任务完成的最长时间，超时后终止任务并释放消息
+	MaxReceiveCount    int           // 任务存储不可用、无法记录重试次数时，消息最多接收的次数，超过后移入死信队列
+
+	// 任务内并行配置
+	TranscodeConcurrency int  // 单个任务内并行执行的转码类型数，0 表示自动（等于编码会话上限）
+	MaxEncodeSessions    int  // 整个处理器同时运行的编码会话上限，0 表示按平台自动检测
+	MultiOutputEncoding  bool // 可合并的内置转码类型在同一个 FFmpeg 进程中一次解码、多路输出
+
+	// 分段输出（HLS/DASH）配置
+	PackagingLadder         string // 码率阶梯，如 1920x1080:5000k/128k,1280x720:2800k，为空时使用内置阶梯
+	PackagingSegmentSeconds int    // 分段时长（秒）
 }
 
 func LoadConfig() *Config {
 	pollInterval, _ := time.ParseDuration(getEnv("POLL_INTERVAL", "10s"))
+	visibilityTimeout, _ := time.ParseDuration(getEnv("VISIBILITY_TIMEOUT", "5m"))
+	drainTimeout, _ := time.ParseDuration(getEnv("DRAIN_TIMEOUT", "5m"))
+	maxReceiveCount, _ := strconv.Atoi(getEnv("MAX_RECEIVE_COUNT", "10"))
+	idempotencyTTL, _ := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
 	maxTasks, _ := strconv.Atoi(getEnv("MAX_CONCURRENT_TASKS", "2"))
 	debug, _ := strconv.ParseBool(getEnv("DEBUG_MODE", "false"))
+	transcodeConcurrency, _ := strconv.Atoi(getEnv("TRANSCODE_CONCURRENCY", "0"))
+	maxEncodeSessions, _ := strconv.Atoi(getEnv("MAX_ENCODE_SESSIONS", "0"))
+	multiOutputEncoding, _ := strconv.ParseBool(getEnv("MULTI_OUTPUT_ENCODING", "true"))
+	segmentSeconds, _ := strconv.Atoi(getEnv("SEGMENT_SECONDS", "6"))
 
 	return &Config{
 		AWSRegion:     getEnv("AWS_REGION", "us-west-2"),
@@ -44,6 +85,22 @@ func LoadConfig() *Config {
 		SQSQueueURL:   getEnv("SQS_QUEUE_URL", ""),
 		DynamoDBTable: getEnv("DYNAMODB_TABLE", "video-transcode-tasks"),
 
+		TaskStoreBackend: getEnv("TASK_STORE_BACKEND", "dynamodb"),
+		SQLitePath:       getEnv("SQLITE_PATH", "/tmp/transcode_tasks.db"),
+		IdempotencyTTL:   idempotencyTTL,
+
+		QueueBackend: getEnv("QUEUE_BACKEND", "sqs"),
+		QueueDir:     getEnv("QUEUE_DIR", "/tmp/transcode_queue"),
+
+		SQSHighQueueURL: getEnv("SQS_HIGH_QUEUE_URL", ""),
+		SQSBulkQueueURL: getEnv("SQS_BULK_QUEUE_URL", ""),
+
+		SQSDeadLetterQueueURL: getEnv("SQS_DLQ_URL", ""),
+		DeadLetterQueueDir:    getEnv("DLQ_DIR", "/tmp/transcode_queue_dlq"),
+
+		StorageBackend:  getEnv("STORAGE_BACKEND", "s3"),
+		LocalStorageDir: getEnv("LOCAL_STORAGE_DIR", "/tmp/transcode_storage"),
+
 		UserTable: getEnv("USER_TABLE", "video-transcode-users"),
 		JWTSecret: getOrGenerateJWTSecret(),
 		APIKey:    getOrGenerateAPIKey(),
@@ -55,9 +112,27 @@ func LoadConfig() *Config {
 		TempDir:            getEnv("TEMP_DIR", "/tmp/ffmpeg_processing"),
 		MaxConcurrentTasks: maxTasks,
 		PollInterval:       pollInterval,
+		VisibilityTimeout:  visibilityTimeout,
+		DrainTimeout:       drainTimeout,
+		MaxReceiveCount:    maxReceiveCount,
+
+		TranscodeConcurrency: transcodeConcurrency,
+		MaxEncodeSessions:    maxEncodeSessions,
+		MultiOutputEncoding:  multiOutputEncoding,
+
+		PackagingLadder:         getEnv("RENDITION_LADDER", ""),
+		PackagingSegmentSeconds: segmentSeconds,
 	}
 }
 
+// RequiresAWS 判断当前配置的任务存储、队列和对象存储是否依赖 AWS
+// 全部使用本地后端时可在没有 AWS 凭证的单机环境运行（用户管理和 LLM 功能除外）
+func (c *Config) RequiresAWS() bool {
+	return c.TaskStoreBackend == "" || c.TaskStoreBackend == "dynamodb" ||
+		c.QueueBackend == "" || c.QueueBackend == "sqs" ||
+		c.StorageBackend == "" || c.StorageBackend == "s3"
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
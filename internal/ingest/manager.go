@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRefreshInterval 规则缓存的刷新间隔
+// API 服务器修改规则后，其他进程（GPU 处理器）最迟在该间隔后生效
+const DefaultRefreshInterval = 30 * time.Second
+
+// Manager 接入规则管理器
+// 匹配使用内存中按顺序排好的规则缓存，过期后在下一次匹配时从存储重新加载
+type Manager struct {
+	store           Store
+	refreshInterval time.Duration
+
+	mu       sync.Mutex
+	rules    []Rule
+	loadedAt time.Time
+}
+
+// NewManager 创建接入规则管理器
+func NewManager(store Store) *Manager {
+	return &Manager{
+		store:           store,
+		refreshInterval: DefaultRefreshInterval,
+	}
+}
+
+// Backend 返回存储后端类型
+func (m *Manager) Backend() string {
+	return m.store.Backend()
+}
+
+// Load 从存储加载规则到缓存
+func (m *Manager) Load() error {
+	rules, err := m.ListRules()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.rules = rules
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// ListRules 按匹配顺序返回全部规则（直接读取存储）
+func (m *Manager) ListRules() ([]Rule, error) {
+	rules, err := m.store.ListRules(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Order != rules[j].Order {
+			return rules[i].Order < rules[j].Order
+		}
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules, nil
+}
+
+// GetRule 获取单条规则
+func (m *Manager) GetRule(ruleID string) (*Rule, error) {
+	rules, err := m.ListRules()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].RuleID == ruleID {
+			return &rules[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, ruleID)
+}
+
+// SaveRule 校验并保存规则，RuleID 为空时创建新规则
+func (m *Manager) SaveRule(rule *Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if rule.RuleID == "" {
+		rule.RuleID = uuid.New().String()
+	}
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	if err := m.store.SaveRule(context.TODO(), rule); err != nil {
+		return err
+	}
+	log.Printf("✅ 接入规则已保存: %s (%s)", rule.Name, rule.RuleID)
+	m.invalidate()
+	return nil
+}
+
+// DeleteRule 删除规则
+func (m *Manager) DeleteRule(ruleID string) error {
+	if err := m.store.DeleteRule(context.TODO(), ruleID); err != nil {
+		return err
+	}
+	log.Printf("🗑️  接入规则已删除: %s", ruleID)
+	m.invalidate()
+	return nil
+}
+
+// Match 返回第一条匹配对象的规则，没有规则匹配时返回 nil
+// size < 0 表示大小未知，不检查大小范围；缓存刷新失败时继续使用旧规则
+func (m *Manager) Match(bucket, key string, size int64) *Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.loadedAt) > m.refreshInterval {
+		if rules, err := m.ListRules(); err != nil {
+			log.Printf("⚠️  刷新接入规则失败，继续使用缓存: %v", err)
+		} else {
+			m.rules = rules
+		}
+		m.loadedAt = time.Now()
+	}
+
+	for i := range m.rules {
+		if m.rules[i].Matches(bucket, key, size) {
+			rule := m.rules[i]
+			return &rule
+		}
+	}
+	return nil
+}
+
+// invalidate 使缓存失效，下一次匹配时重新加载
+func (m *Manager) invalidate() {
+	m.mu.Lock()
+	m.loadedAt = time.Time{}
+	m.mu.Unlock()
+}
@@ -0,0 +1,169 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+var (
+	// ErrRuleNotFound 规则不存在
+	ErrRuleNotFound = errors.New("接入规则不存在")
+	// ErrInvalidRule 规则内容不合法
+	ErrInvalidRule = errors.New("接入规则不合法")
+)
+
+// Rule S3 事件接入规则：决定上传到输入桶的文件是否转码，以及使用的预设、输出前缀和优先级
+// 所有条件都满足时规则匹配，空条件表示不限制；多条规则按 Order 从小到大依次匹配，第一条匹配的规则生效
+type Rule struct {
+	RuleID   string `json:"rule_id" dynamodbav:"rule_id"`
+	Name     string `json:"name" dynamodbav:"name"`
+	Order    int    `json:"order" dynamodbav:"order"`                           // 匹配顺序，越小越先匹配
+	Disabled bool   `json:"disabled,omitempty" dynamodbav:"disabled,omitempty"` // 停用的规则不参与匹配
+
+	// 匹配条件
+	Bucket     string   `json:"bucket,omitempty" dynamodbav:"bucket,omitempty"`           // 输入桶
+	KeyPattern string   `json:"key_pattern,omitempty" dynamodbav:"key_pattern,omitempty"` // key 前缀；包含 * ? [ 时按 glob 匹配，** 匹配任意层目录
+	Extensions []string `json:"extensions,omitempty" dynamodbav:"extensions,omitempty"`   // 扩展名（如 .mxf），为空时只匹配常见视频格式
+	MinSize    int64    `json:"min_size,omitempty" dynamodbav:"min_size,omitempty"`       // 文件大小下限（字节，含）
+	MaxSize    int64    `json:"max_size,omitempty" dynamodbav:"max_size,omitempty"`       // 文件大小上限（字节，含），0 表示不限
+
+	// 匹配后的处理方式
+	Ignore         bool     `json:"ignore,omitempty" dynamodbav:"ignore,omitempty"`                   // 为 true 时匹配的文件不转码
+	TranscodeTypes []string `json:"transcode_types,omitempty" dynamodbav:"transcode_types,omitempty"` // 转码预设列表
+	OutputPrefix   string   `json:"output_prefix,omitempty" dynamodbav:"output_prefix,omitempty"`     // 输出文件 key 前缀
+	Priority       string   `json:"priority,omitempty" dynamodbav:"priority,omitempty"`               // 任务优先级，默认 normal
+
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// Validate 检查规则并规范化扩展名和输出前缀
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("%w: 名称不能为空", ErrInvalidRule)
+	}
+	if isGlob(r.KeyPattern) {
+		if _, err := path.Match(strings.ReplaceAll(r.KeyPattern, "**", "*"), ""); err != nil {
+			return fmt.Errorf("%w: key_pattern 不是合法的 glob: %s", ErrInvalidRule, r.KeyPattern)
+		}
+	}
+	if r.MinSize < 0 || r.MaxSize < 0 || (r.MaxSize > 0 && r.MaxSize < r.MinSize) {
+		return fmt.Errorf("%w: 文件大小范围无效", ErrInvalidRule)
+	}
+	if !r.Ignore && len(r.TranscodeTypes) == 0 {
+		return fmt.Errorf("%w: transcode_types 不能为空", ErrInvalidRule)
+	}
+	if r.Priority != "" && task.NormalizePriority(r.Priority) != r.Priority {
+		return fmt.Errorf("%w: 未知的优先级 %s", ErrInvalidRule, r.Priority)
+	}
+
+	for i, ext := range r.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if ext == "" || ext == "." {
+			return fmt.Errorf("%w: 扩展名不能为空", ErrInvalidRule)
+		}
+		r.Extensions[i] = ext
+	}
+
+	prefix := strings.Trim(r.OutputPrefix, "/")
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == ".." {
+			return fmt.Errorf("%w: output_prefix 不能包含 ..", ErrInvalidRule)
+		}
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	r.OutputPrefix = prefix
+	return nil
+}
+
+// Matches 判断对象是否满足规则的匹配条件，size < 0 表示大小未知（如删除事件），不检查大小
+func (r *Rule) Matches(bucket, key string, size int64) bool {
+	if r.Disabled {
+		return false
+	}
+	if r.Bucket != "" && r.Bucket != bucket {
+		return false
+	}
+	if r.KeyPattern != "" {
+		if isGlob(r.KeyPattern) {
+			if !matchGlob(r.KeyPattern, key) {
+				return false
+			}
+		} else if !strings.HasPrefix(key, r.KeyPattern) {
+			return false
+		}
+	}
+	if len(r.Extensions) > 0 {
+		if !hasExtension(key, r.Extensions) {
+			return false
+		}
+	} else if !IsVideoFile(key) {
+		return false
+	}
+	if size >= 0 {
+		if size < r.MinSize || (r.MaxSize > 0 && size > r.MaxSize) {
+			return false
+		}
+	}
+	return true
+}
+
+// videoExtensions 未配置规则（或规则未指定扩展名）时接受的视频格式
+var videoExtensions = []string{".mp4", ".mov", ".avi", ".mkv", ".wmv", ".flv", ".webm", ".m4v", ".mpeg", ".mpg"}
+
+// IsVideoFile 检查文件是否为常见视频格式
+func IsVideoFile(key string) bool {
+	return hasExtension(key, videoExtensions)
+}
+
+// hasExtension 判断 key 的扩展名（不区分大小写）是否在列表中
+func hasExtension(key string, extensions []string) bool {
+	key = strings.ToLower(key)
+	for _, ext := range extensions {
+		if strings.HasSuffix(key, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGlob 判断 key_pattern 是否为 glob（否则按前缀匹配）
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// matchGlob 按 / 分段匹配 glob，** 匹配零个或多个目录层级，其余通配符不跨越 /
+func matchGlob(pattern, key string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(key, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
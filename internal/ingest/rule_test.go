@@ -0,0 +1,100 @@
+package ingest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		bucket string
+		key    string
+		size   int64
+		want   bool
+	}{
+		{name: "空条件匹配常见视频", rule: Rule{}, bucket: "input", key: "a.mp4", size: 10, want: true},
+		{name: "空条件不匹配非视频文件", rule: Rule{}, bucket: "input", key: "a.txt", size: 10, want: false},
+		{name: "停用的规则不匹配", rule: Rule{Disabled: true}, bucket: "input", key: "a.mp4", size: 10, want: false},
+		{name: "桶不同", rule: Rule{Bucket: "other"}, bucket: "input", key: "a.mp4", size: 10, want: false},
+		{name: "前缀匹配", rule: Rule{KeyPattern: "uploads/"}, bucket: "input", key: "uploads/2025/a.mp4", size: 10, want: true},
+		{name: "前缀不匹配", rule: Rule{KeyPattern: "uploads/"}, bucket: "input", key: "drafts/a.mp4", size: 10, want: false},
+		{name: "* 不跨越目录", rule: Rule{KeyPattern: "uploads/*.mp4"}, bucket: "input", key: "uploads/2025/a.mp4", size: 10, want: false},
+		{name: "* 匹配单层", rule: Rule{KeyPattern: "uploads/*.mp4"}, bucket: "input", key: "uploads/a.mp4", size: 10, want: true},
+		{name: "** 匹配多层目录", rule: Rule{KeyPattern: "uploads/**/*.mp4"}, bucket: "input", key: "uploads/2025/01/a.mp4", size: 10, want: true},
+		{name: "** 匹配零层目录", rule: Rule{KeyPattern: "uploads/**/*.mp4"}, bucket: "input", key: "uploads/a.mp4", size: 10, want: true},
+		{name: "** 结尾匹配任意后代", rule: Rule{KeyPattern: "masters/**"}, bucket: "input", key: "masters/a/b/c.mov", size: 10, want: true},
+		{name: "glob 需要匹配整个 key", rule: Rule{KeyPattern: "uploads/?.mp4"}, bucket: "input", key: "uploads/ab.mp4", size: 10, want: false},
+		{name: "指定扩展名时不限于视频格式", rule: Rule{Extensions: []string{".mxf"}}, bucket: "input", key: "MASTER.MXF", size: 10, want: true},
+		{name: "指定扩展名后不再匹配其他视频", rule: Rule{Extensions: []string{".mxf"}}, bucket: "input", key: "a.mp4", size: 10, want: false},
+		{name: "小于下限", rule: Rule{MinSize: 100}, bucket: "input", key: "a.mp4", size: 99, want: false},
+		{name: "等于下限", rule: Rule{MinSize: 100}, bucket: "input", key: "a.mp4", size: 100, want: true},
+		{name: "等于上限", rule: Rule{MaxSize: 100}, bucket: "input", key: "a.mp4", size: 100, want: true},
+		{name: "大于上限", rule: Rule{MaxSize: 100}, bucket: "input", key: "a.mp4", size: 101, want: false},
+		{name: "大小未知时不检查", rule: Rule{MinSize: 100, MaxSize: 200}, bucket: "input", key: "a.mp4", size: -1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.bucket, tt.key, tt.size); got != tt.want {
+				t.Errorf("Matches(%q, %q, %d) = %v, want %v", tt.bucket, tt.key, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		rule           Rule
+		wantErr        bool
+		wantExtensions []string
+		wantPrefix     string
+	}{
+		{
+			name:           "规范化扩展名和输出前缀",
+			rule:           Rule{Name: "母带", Extensions: []string{"MXF", " .Mov "}, OutputPrefix: "/out/masters", TranscodeTypes: []string{"hls"}},
+			wantExtensions: []string{".mxf", ".mov"},
+			wantPrefix:     "out/masters/",
+		},
+		{
+			name: "忽略规则不需要转码类型",
+			rule: Rule{Name: "草稿", KeyPattern: "drafts/", Ignore: true},
+		},
+		{name: "名称为空", rule: Rule{TranscodeTypes: []string{"hls"}}, wantErr: true},
+		{name: "非法 glob", rule: Rule{Name: "r", KeyPattern: "uploads/[a", TranscodeTypes: []string{"hls"}}, wantErr: true},
+		{name: "大小为负数", rule: Rule{Name: "r", MinSize: -1, TranscodeTypes: []string{"hls"}}, wantErr: true},
+		{name: "上限小于下限", rule: Rule{Name: "r", MinSize: 200, MaxSize: 100, TranscodeTypes: []string{"hls"}}, wantErr: true},
+		{name: "缺少转码类型", rule: Rule{Name: "r"}, wantErr: true},
+		{name: "未知优先级", rule: Rule{Name: "r", TranscodeTypes: []string{"hls"}, Priority: "urgent"}, wantErr: true},
+		{name: "合法优先级", rule: Rule{Name: "r", TranscodeTypes: []string{"hls"}, Priority: task.PriorityBulk}},
+		{name: "空扩展名", rule: Rule{Name: "r", TranscodeTypes: []string{"hls"}, Extensions: []string{"."}}, wantErr: true},
+		{name: "输出前缀包含 ..", rule: Rule{Name: "r", TranscodeTypes: []string{"hls"}, OutputPrefix: "out/../secret"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			err := rule.Validate()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Fatalf("Validate() error = %v, want ErrInvalidRule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if tt.wantExtensions != nil && !reflect.DeepEqual(rule.Extensions, tt.wantExtensions) {
+				t.Errorf("Extensions = %v, want %v", rule.Extensions, tt.wantExtensions)
+			}
+			if rule.OutputPrefix != tt.wantPrefix {
+				t.Errorf("OutputPrefix = %q, want %q", rule.OutputPrefix, tt.wantPrefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	_ "modernc.org/sqlite"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// Store 接入规则持久化接口，后端与任务存储一致
+type Store interface {
+	// ListRules 获取全部规则（不保证顺序）
+	ListRules(ctx context.Context) ([]Rule, error)
+	// SaveRule 创建或覆盖规则
+	SaveRule(ctx context.Context, rule *Rule) error
+	// DeleteRule 删除规则，不存在时返回 ErrRuleNotFound
+	DeleteRule(ctx context.Context, ruleID string) error
+	// Backend 返回后端类型，用于日志展示
+	Backend() string
+}
+
+// NewStore 根据任务存储后端类型创建规则存储
+// DynamoDB 使用 <任务表>-ingest-rules 表，SQLite 与任务共用同一个数据库文件
+func NewStore(backend string, dynamoClient *dynamodb.Client, tableName, sqlitePath string) (Store, error) {
+	switch backend {
+	case "", task.StoreBackendDynamoDB:
+		if dynamoClient == nil {
+			return nil, fmt.Errorf("DynamoDB 规则存储需要 DynamoDB 客户端")
+		}
+		return NewDynamoStore(dynamoClient, tableName+"-ingest-rules"), nil
+	case task.StoreBackendSQLite:
+		return NewSQLiteStore(sqlitePath)
+	default:
+		return nil, fmt.Errorf("未知的任务存储后端: %s", backend)
+	}
+}
+
+// DynamoStore 基于 DynamoDB 的规则存储（主键 rule_id）
+type DynamoStore struct {
+	dynamoClient *dynamodb.Client
+	tableName    string
+}
+
+// NewDynamoStore 创建 DynamoDB 规则存储
+func NewDynamoStore(dynamoClient *dynamodb.Client, tableName string) *DynamoStore {
+	return &DynamoStore{
+		dynamoClient: dynamoClient,
+		tableName:    tableName,
+	}
+}
+
+// Backend 返回后端类型
+func (s *DynamoStore) Backend() string {
+	return task.StoreBackendDynamoDB
+}
+
+// ListRules 扫描全部规则（规则数量很少，直接 Scan）
+func (s *DynamoStore) ListRules(ctx context.Context) ([]Rule, error) {
+	var rules []Rule
+	paginator := dynamodb.NewScanPaginator(s.dynamoClient, &dynamodb.ScanInput{
+		TableName: aws.String(s.tableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("查询接入规则失败: %w", err)
+		}
+		var pageRules []Rule
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRules); err != nil {
+			return nil, fmt.Errorf("解析接入规则失败: %w", err)
+		}
+		rules = append(rules, pageRules...)
+	}
+	return rules, nil
+}
+
+// SaveRule 保存规则
+func (s *DynamoStore) SaveRule(ctx context.Context, rule *Rule) error {
+	item, err := attributevalue.MarshalMap(rule)
+	if err != nil {
+		return fmt.Errorf("序列化接入规则失败: %w", err)
+	}
+
+	_, err = s.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("保存接入规则到DynamoDB失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteRule 删除规则
+func (s *DynamoStore) DeleteRule(ctx context.Context, ruleID string) error {
+	_, err := s.dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"rule_id": &types.AttributeValueMemberS{Value: ruleID},
+		},
+		ConditionExpression: aws.String("attribute_exists(rule_id)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return fmt.Errorf("%w: %s", ErrRuleNotFound, ruleID)
+		}
+		return fmt.Errorf("删除接入规则失败: %w", err)
+	}
+	return nil
+}
+
+// sqliteSchema 规则表结构，完整规则以 JSON 保存在 data 列
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS ingest_rules (
+	rule_id TEXT PRIMARY KEY,
+	data    TEXT NOT NULL
+);
+`
+
+// SQLiteStore 基于 SQLite 的规则存储
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore 打开（必要时创建）SQLite 数据库中的规则表
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLite 数据库路径不能为空")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开SQLite数据库失败: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化SQLite表结构失败: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Backend 返回后端类型
+func (s *SQLiteStore) Backend() string {
+	return task.StoreBackendSQLite
+}
+
+// Close 关闭数据库
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// ListRules 获取全部规则
+func (s *SQLiteStore) ListRules(ctx context.Context) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM ingest_rules`)
+	if err != nil {
+		return nil, fmt.Errorf("查询接入规则失败: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("读取接入规则失败: %w", err)
+		}
+		var rule Rule
+		if err := json.Unmarshal([]byte(data), &rule); err != nil {
+			return nil, fmt.Errorf("解析接入规则失败: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// SaveRule 保存规则
+func (s *SQLiteStore) SaveRule(ctx context.Context, rule *Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("序列化接入规则失败: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO ingest_rules (rule_id, data) VALUES (?, ?)
+		 ON CONFLICT (rule_id) DO UPDATE SET data = excluded.data`,
+		rule.RuleID, string(data))
+	if err != nil {
+		return fmt.Errorf("保存接入规则失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteRule 删除规则
+func (s *SQLiteStore) DeleteRule(ctx context.Context, ruleID string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM ingest_rules WHERE rule_id = ?`, ruleID)
+	if err != nil {
+		return fmt.Errorf("删除接入规则失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, ruleID)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// 消息属性名
+const (
+	attrTaskID           = "TaskID"
+	attrPriority         = "Priority"         // 消息所在的优先级通道
+	attrDeadLetterReason = "DeadLetterReason" // 进入死信队列的原因
+	attrDeadLetteredAt   = "DeadLetteredAt"   // 进入死信队列的时间（RFC3339）
+	attrSourceMessageID  = "SourceMessageID"  // 原队列中的消息ID
+	attrReceiveCount     = "ReceiveCount"     // 进入死信队列前在原队列的接收次数
+)
+
+// 浏览死信队列的参数
+// SQS 不支持只读查看消息，浏览时先接收消息再立即释放
+const (
+	deadLetterBatchSize   = 10
+	deadLetterWaitTime    = time.Second      // 使用短暂的长轮询，避免 SQS 短轮询漏掉消息
+	deadLetterPeekTimeout = 30 * time.Second // 浏览期间消息的不可见时长
+	deadLetterMaxScan     = 1000             // 按消息ID查找时最多扫描的消息数
+)
+
+// DeadLetterMessage 死信队列中的消息
+type DeadLetterMessage struct {
+	MessageID       string            `json:"message_id"`
+	TaskID          string            `json:"task_id,omitempty"`
+	Reason          string            `json:"reason"`
+	SourceMessageID string            `json:"source_message_id,omitempty"`
+	ReceiveCount    int               `json:"receive_count"`
+	DeadLetteredAt  time.Time         `json:"dead_lettered_at"`
+	Body            string            `json:"body"`
+	Attributes      map[string]string `json:"attributes,omitempty"` // 原消息的其他属性
+}
+
+// newDeadLetterMessage 从死信队列的原始消息中还原死信信息
+func newDeadLetterMessage(msg RawMessage) *DeadLetterMessage {
+	dead := &DeadLetterMessage{
+		MessageID:       msg.MessageID,
+		TaskID:          msg.Attributes[attrTaskID],
+		Reason:          msg.Attributes[attrDeadLetterReason],
+		SourceMessageID: msg.Attributes[attrSourceMessageID],
+		Body:            msg.Body,
+		Attributes:      originalAttributes(msg.Attributes),
+	}
+	dead.ReceiveCount, _ = strconv.Atoi(msg.Attributes[attrReceiveCount])
+	if at, err := time.Parse(time.RFC3339, msg.Attributes[attrDeadLetteredAt]); err == nil {
+		dead.DeadLetteredAt = at
+	} else {
+		dead.DeadLetteredAt = msg.SentAt
+	}
+	return dead
+}
+
+// originalAttributes 去掉死信相关属性，返回原消息的属性
+func originalAttributes(attributes map[string]string) map[string]string {
+	result := make(map[string]string)
+	for name, value := range attributes {
+		switch name {
+		case attrDeadLetterReason, attrDeadLetteredAt, attrSourceMessageID, attrReceiveCount:
+			continue
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// MoveToDeadLetter 将重试次数用完的任务消息移入死信队列并从原队列删除
+// 死信中保存的是任务的 QueueMessage，重新投递后继续处理同一个任务；未配置死信队列时直接删除消息
+func (m *Manager) MoveToDeadLetter(message Message, reason string) error {
+	if m.deadLetter == nil {
+		return m.DeleteMessage(message)
+	}
+
+	body, err := json.Marshal(message.QueueMessage)
+	if err != nil {
+		return fmt.Errorf("序列化消息失败: %w", err)
+	}
+	return m.moveToDeadLetter(m.laneQueue(message.QueueMessage.Priority), RawMessage{
+		MessageID:     message.MessageID,
+		ReceiptHandle: message.ReceiptHandle,
+		Body:          string(body),
+		Attributes: map[string]string{
+			attrTaskID:   message.QueueMessage.TaskID,
+			attrPriority: task.NormalizePriority(message.QueueMessage.Priority),
+		},
+		ReceiveCount: message.ReceiveCount,
+	}, reason)
+}
+
+// moveToDeadLetter 将消息发送到死信队列后从原队列 source 删除
+func (m *Manager) moveToDeadLetter(source Queue, msg RawMessage, reason string) error {
+	attributes := originalAttributes(msg.Attributes)
+	attributes[attrDeadLetterReason] = reason
+	attributes[attrDeadLetteredAt] = time.Now().UTC().Format(time.RFC3339)
+	attributes[attrReceiveCount] = strconv.Itoa(msg.ReceiveCount)
+	if msg.MessageID != "" {
+		attributes[attrSourceMessageID] = msg.MessageID
+	}
+
+	deadID, err := m.deadLetter.Send(context.TODO(), msg.Body, attributes, 0)
+	if err != nil {
+		return fmt.Errorf("发送到死信队列失败: %w", err)
+	}
+	if err := source.Delete(context.TODO(), msg.ReceiptHandle); err != nil {
+		return fmt.Errorf("从原队列删除消息失败: %w", err)
+	}
+
+	log.Printf("☠️  消息已移入死信队列: %s -> %s (%s)", msg.MessageID, deadID, reason)
+	return nil
+}
+
+// DeadLetterCount 死信队列中的消息数（近似值）
+func (m *Manager) DeadLetterCount() (int, error) {
+	if m.deadLetter == nil {
+		return 0, ErrNoDeadLetterQueue
+	}
+	stats, err := m.deadLetter.Attributes(context.TODO())
+	if err != nil {
+		return 0, err
+	}
+	return stats.Visible + stats.InFlight + stats.Delayed, nil
+}
+
+// ListDeadLetters 查看死信队列中最多 limit 条消息（不删除）
+// 正在被其他请求查看的消息暂时不可见，因此结果可能不完整
+func (m *Manager) ListDeadLetters(limit int) ([]DeadLetterMessage, error) {
+	if m.deadLetter == nil {
+		return nil, ErrNoDeadLetterQueue
+	}
+
+	ctx := context.TODO()
+	var received []RawMessage
+	defer func() { m.releaseDeadLetters(ctx, received) }()
+
+	for len(received) < limit {
+		batch, err := m.deadLetter.Receive(ctx, min(deadLetterBatchSize, limit-len(received)), deadLetterWaitTime, deadLetterPeekTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		received = append(received, batch...)
+	}
+
+	result := make([]DeadLetterMessage, 0, len(received))
+	for _, msg := range received {
+		result = append(result, *newDeadLetterMessage(msg))
+	}
+	return result, nil
+}
+
+// GetDeadLetter 查看死信队列中的单条消息
+func (m *Manager) GetDeadLetter(messageID string) (*DeadLetterMessage, error) {
+	msg, err := m.takeDeadLetter(messageID)
+	if err != nil {
+		return nil, err
+	}
+	m.releaseDeadLetters(context.TODO(), []RawMessage{*msg})
+	return newDeadLetterMessage(*msg), nil
+}
+
+// RedriveDeadLetter 将死信消息重新发送到原优先级通道并从死信队列删除
+func (m *Manager) RedriveDeadLetter(messageID string) (*DeadLetterMessage, error) {
+	msg, err := m.takeDeadLetter(messageID)
+	if err != nil {
+		return nil, err
+	}
+	dead := newDeadLetterMessage(*msg)
+
+	if _, err := m.laneQueue(dead.Attributes[attrPriority]).Send(context.TODO(), msg.Body, dead.Attributes, 0); err != nil {
+		m.releaseDeadLetters(context.TODO(), []RawMessage{*msg})
+		return nil, fmt.Errorf("重新投递消息失败: %w", err)
+	}
+	if err := m.deadLetter.Delete(context.TODO(), msg.ReceiptHandle); err != nil {
+		// 消息已重新投递，死信会在查看超时后重新出现，需要手动删除
+		return nil, fmt.Errorf("消息已重新投递，但从死信队列删除失败: %w", err)
+	}
+
+	log.Printf("↩️  死信消息已重新投递: %s (TaskID=%s)", messageID, dead.TaskID)
+	return dead, nil
+}
+
+// DeleteDeadLetter 从死信队列删除消息
+func (m *Manager) DeleteDeadLetter(messageID string) error {
+	msg, err := m.takeDeadLetter(messageID)
+	if err != nil {
+		return err
+	}
+	if err := m.deadLetter.Delete(context.TODO(), msg.ReceiptHandle); err != nil {
+		return err
+	}
+
+	log.Printf("🗑️  死信消息已删除: %s", messageID)
+	return nil
+}
+
+// takeDeadLetter 在死信队列中查找消息，找到的消息保持不可见（由调用方删除或释放），
+// 扫描过的其他消息立即释放；没有找到时返回 ErrMessageNotFound
+func (m *Manager) takeDeadLetter(messageID string) (*RawMessage, error) {
+	if m.deadLetter == nil {
+		return nil, ErrNoDeadLetterQueue
+	}
+
+	ctx := context.TODO()
+	var scanned []RawMessage
+	defer func() { m.releaseDeadLetters(ctx, scanned) }()
+
+	for len(scanned) < deadLetterMaxScan {
+		batch, err := m.deadLetter.Receive(ctx, deadLetterBatchSize, deadLetterWaitTime, deadLetterPeekTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for i, msg := range batch {
+			if msg.MessageID == messageID {
+				scanned = append(scanned, batch[:i]...)
+				scanned = append(scanned, batch[i+1:]...)
+				return &msg, nil
+			}
+		}
+		scanned = append(scanned, batch...)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+}
+
+// releaseDeadLetters 立即释放查看过的死信消息
+func (m *Manager) releaseDeadLetters(ctx context.Context, messages []RawMessage) {
+	for _, msg := range messages {
+		if err := m.deadLetter.ChangeVisibility(ctx, msg.ReceiptHandle, 0); err != nil {
+			log.Printf("⚠️  释放死信消息失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// filePollInterval 磁盘队列为空时的轮询间隔
+const filePollInterval = 500 * time.Millisecond
+
+// FileQueue 基于本地磁盘的持久化队列
+// 每条消息保存为 <dir>/<message_id>.json，通过 flock 文件锁保证多进程（API服务器与GPU处理器）安全访问
+// （非 Unix 平台没有 flock，只能由单个进程使用），
+// 适合单机部署：进程重启后未删除的消息会在可见性超时后重新投递
+type FileQueue struct {
+	dir      string
+	lockPath string
+	mu       sync.Mutex // 同一进程内的协程互斥，flock 只负责跨进程
+}
+
+// NewFileQueue 创建磁盘队列
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("磁盘队列目录不能为空")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建队列目录失败: %w", err)
+	}
+	return &FileQueue{
+		dir:      dir,
+		lockPath: filepath.Join(dir, ".lock"),
+	}, nil
+}
+
+// Backend 返回后端类型
+func (q *FileQueue) Backend() string {
+	return BackendFile
+}
+
+// withLock 在进程内互斥锁和跨进程文件锁的保护下执行 fn
+func (q *FileQueue) withLock(fn func() error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	lockFile, err := os.OpenFile(q.lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("打开队列锁文件失败: %w", err)
+	}
+	defer lockFile.Close()
+
+	if err := lockFileExclusive(lockFile); err != nil {
+		return fmt.Errorf("获取队列锁失败: %w", err)
+	}
+	defer unlockFile(lockFile)
+
+	return fn()
+}
+
+// messagePath 消息文件路径
+func (q *FileQueue) messagePath(messageID string) string {
+	return filepath.Join(q.dir, messageID+".json")
+}
+
+// readMessage 读取单条消息
+func (q *FileQueue) readMessage(messageID string) (*storedMessage, error) {
+	data, err := os.ReadFile(q.messagePath(messageID))
+	if err != nil {
+		return nil, err
+	}
+	var msg storedMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("解析消息文件失败: %w", err)
+	}
+	return &msg, nil
+}
+
+// writeMessage 原子写入单条消息（先写临时文件再重命名）
+func (q *FileQueue) writeMessage(msg *storedMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化消息失败: %w", err)
+	}
+	tmpPath := filepath.Join(q.dir, "."+msg.MessageID+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("写入消息文件失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, q.messagePath(msg.MessageID)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("保存消息文件失败: %w", err)
+	}
+	return nil
+}
+
+// readAll 读取目录下所有消息，损坏的文件跳过并记录日志
+func (q *FileQueue) readAll() ([]*storedMessage, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取队列目录失败: %w", err)
+	}
+
+	var messages []*storedMessage
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		msg, err := q.readMessage(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			log.Printf("⚠️  跳过无法读取的队列消息 %s: %v", name, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// Send 发送消息
+func (q *FileQueue) Send(ctx context.Context, body string, attributes map[string]string, delay time.Duration) (string, error) {
+	msg := newStoredMessage(body, attributes, delay)
+	err := q.withLock(func() error {
+		return q.writeMessage(msg)
+	})
+	if err != nil {
+		return "", err
+	}
+	return msg.MessageID, nil
+}
+
+// Receive 接收消息，队列为空时按 filePollInterval 轮询，最多等待 waitTime
+func (q *FileQueue) Receive(ctx context.Context, maxMessages int, waitTime, visibilityTimeout time.Duration) ([]RawMessage, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		var result []RawMessage
+		err := q.withLock(func() error {
+			all, err := q.readAll()
+			if err != nil {
+				return err
+			}
+			for _, msg := range claimVisible(all, maxMessages, visibilityTimeout) {
+				if err := q.writeMessage(msg); err != nil {
+					return err
+				}
+				result = append(result, msg.toRaw())
+			}
+			return nil
+		})
+		if err != nil || len(result) > 0 {
+			return result, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		if remaining > filePollInterval {
+			remaining = filePollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(remaining):
+		}
+	}
+}
+
+// lookup 根据句柄查找消息，调用方需持有锁
+func (q *FileQueue) lookup(receiptHandle string) (*storedMessage, error) {
+	messageID, _, ok := strings.Cut(receiptHandle, ":")
+	if !ok {
+		return nil, ErrReceiptHandleInvalid
+	}
+	msg, err := q.readMessage(messageID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrReceiptHandleInvalid
+		}
+		return nil, err
+	}
+	if msg.ReceiptHandle != receiptHandle {
+		return nil, ErrReceiptHandleInvalid
+	}
+	return msg, nil
+}
+
+// Delete 删除消息
+func (q *FileQueue) Delete(ctx context.Context, receiptHandle string) error {
+	return q.withLock(func() error {
+		msg, err := q.lookup(receiptHandle)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(q.messagePath(msg.MessageID)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除消息文件失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// ChangeVisibility 修改消息可见性超时
+func (q *FileQueue) ChangeVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	return q.withLock(func() error {
+		msg, err := q.lookup(receiptHandle)
+		if err != nil {
+			return err
+		}
+		msg.VisibleAt = time.Now().Add(timeout)
+		return q.writeMessage(msg)
+	})
+}
+
+// Attributes 获取队列统计信息
+func (q *FileQueue) Attributes(ctx context.Context) (*Stats, error) {
+	var stats *Stats
+	err := q.withLock(func() error {
+		all, err := q.readAll()
+		if err != nil {
+			return err
+		}
+		stats = countStats(all)
+		return nil
+	})
+	return stats, err
+}
+
+// Purge 清空队列
+func (q *FileQueue) Purge(ctx context.Context) error {
+	return q.withLock(func() error {
+		all, err := q.readAll()
+		if err != nil {
+			return err
+		}
+		for _, msg := range all {
+			if err := os.Remove(q.messagePath(msg.MessageID)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("删除消息文件失败: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package queue
+
+import "os"
+
+// lockFileExclusive 非 Unix 平台没有 flock，只依靠进程内互斥锁，
+// 此时同一个队列目录只能由一个进程访问
+func lockFileExclusive(f *os.File) error {
+	return nil
+}
+
+// unlockFile 释放文件锁
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package queue
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFileExclusive 获取跨进程的排他文件锁（flock），阻塞直到获得
+func lockFileExclusive(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile 释放文件锁
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
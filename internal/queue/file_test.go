@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFileQueue(t *testing.T) {
+	testQueueBackend(t, func(t *testing.T) Queue {
+		q, err := NewFileQueue(t.TempDir())
+		if err != nil {
+			t.Fatalf("创建磁盘队列失败: %v", err)
+		}
+		return q
+	})
+}
+
+func TestNewFileQueueRequiresDir(t *testing.T) {
+	if _, err := NewFileQueue(""); err == nil {
+		t.Fatal("目录为空时应返回错误")
+	}
+}
+
+func TestFileQueuePersistsAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatalf("创建磁盘队列失败: %v", err)
+	}
+	messageID := send(t, first, "task-1", 0)
+	received := receiveOne(t, first, testVisibility)
+	if received == nil {
+		t.Fatal("应接收到消息")
+	}
+
+	// 模拟进程重启：新实例看到的消息仍处于不可见期，超时后重新投递且保留接收次数
+	second, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatalf("创建磁盘队列失败: %v", err)
+	}
+	stats, err := second.Attributes(ctx)
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if stats.InFlight != 1 {
+		t.Fatalf("统计不符: %+v", stats)
+	}
+
+	time.Sleep(testVisibility + 50*time.Millisecond)
+	msg := receiveOne(t, second, testVisibility)
+	if msg == nil || msg.MessageID != messageID || msg.ReceiveCount != 2 {
+		t.Fatalf("重启后应重新投递原消息: %+v", msg)
+	}
+	if err := first.Delete(ctx, msg.ReceiptHandle); err != nil {
+		t.Fatalf("其他实例应能用新句柄删除消息: %v", err)
+	}
+	if again := receiveOne(t, second, testVisibility); again != nil {
+		t.Fatalf("已删除的消息不应再投递: %+v", again)
+	}
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// laneWeights 各优先级通道的权重
+// 接收消息时按平滑加权轮询决定先查看哪个通道：每 10 次接收中 high 优先 6 次、normal 3 次、bulk 1 次，
+// 被选中的通道为空时再按优先级依次查看其他通道，因此高优先级通道有消息时总是先被处理，
+// 而大量高优先级消息也不会让低优先级通道完全饿死
+var laneWeights = map[string]int{
+	task.PriorityHigh:   6,
+	task.PriorityNormal: 3,
+	task.PriorityBulk:   1,
+}
+
+// lane 优先级通道
+type lane struct {
+	priority string
+	queue    Queue
+	weight   int
+	current  int // 平滑加权轮询的当前值
+}
+
+// SetLaneQueue 为优先级通道设置独立的队列，queue 为 nil 时该优先级的消息使用 normal 通道
+func (m *Manager) SetLaneQueue(priority string, queue Queue) {
+	if queue == nil || priority == task.PriorityNormal {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lanes := make([]*lane, 0, len(m.lanes)+1)
+	for _, p := range task.Priorities {
+		if p == priority {
+			lanes = append(lanes, &lane{priority: p, queue: queue, weight: laneWeights[p]})
+			continue
+		}
+		for _, l := range m.lanes {
+			if l.priority == p {
+				lanes = append(lanes, l)
+			}
+		}
+	}
+	m.lanes = lanes
+}
+
+// Lanes 返回已配置独立队列的优先级通道，从高到低排列
+func (m *Manager) Lanes() []string {
+	lanes := m.configuredLanes()
+	priorities := make([]string, 0, len(lanes))
+	for _, l := range lanes {
+		priorities = append(priorities, l.priority)
+	}
+	return priorities
+}
+
+// configuredLanes 已配置的通道快照
+func (m *Manager) configuredLanes() []*lane {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*lane(nil), m.lanes...)
+}
+
+// laneQueue 返回优先级对应的队列，未配置独立队列的优先级使用 normal 通道
+func (m *Manager) laneQueue(priority string) Queue {
+	priority = task.NormalizePriority(priority)
+	for _, l := range m.configuredLanes() {
+		if l.priority == priority {
+			return l.queue
+		}
+	}
+	return m.queue
+}
+
+// laneOrder 本次接收查看通道的顺序：平滑加权轮询选出的通道在前，其余按优先级从高到低
+func (m *Manager) laneOrder() []*lane {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	var picked *lane
+	for _, l := range m.lanes {
+		l.current += l.weight
+		total += l.weight
+		if picked == nil || l.current > picked.current {
+			picked = l
+		}
+	}
+	picked.current -= total
+
+	order := make([]*lane, 0, len(m.lanes))
+	order = append(order, picked)
+	for _, l := range m.lanes {
+		if l != picked {
+			order = append(order, l)
+		}
+	}
+	return order
+}
+
+// receiveFromLanes 从各通道接收消息，返回消息所在的通道
+// 只有一个通道时直接长轮询；多个通道时按 laneOrder 依次短轮询，都为空时在最高优先级通道上长轮询，
+// 长轮询期间其他通道到达的消息最多延迟 waitTime 被接收
+func (m *Manager) receiveFromLanes(ctx context.Context, maxMessages int, waitTime, visibilityTimeout time.Duration) (*lane, []RawMessage, error) {
+	order := m.laneOrder()
+	if len(order) == 1 {
+		messages, err := order[0].queue.Receive(ctx, maxMessages, waitTime, visibilityTimeout)
+		return order[0], messages, err
+	}
+
+	for _, l := range order {
+		messages, err := l.queue.Receive(ctx, maxMessages, 0, visibilityTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(messages) > 0 {
+			return l, messages, nil
+		}
+	}
+
+	top := m.configuredLanes()[0]
+	messages, err := top.queue.Receive(ctx, maxMessages, waitTime, visibilityTimeout)
+	return top, messages, err
+}
@@ -3,264 +3,280 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
-
+	"enhanced_video_transcoder/internal/ingest"
 	"enhanced_video_transcoder/internal/task"
 )
 
 type Manager struct {
-	sqsClient *sqs.Client
-	queueURL  string
+	queue      Queue // normal 通道
+	deadLetter Queue // 死信队列，nil 表示未配置
+
+	ingestRules *ingest.Manager // S3 事件接入规则，nil 表示使用默认转码类型
+
+	mu    sync.Mutex
+	lanes []*lane // 已配置的优先级通道，从高到低排列，总是包含 normal
 }
 
-func NewManager(sqsClient *sqs.Client, queueURL string) *Manager {
+func NewManager(queue Queue) *Manager {
 	return &Manager{
-		sqsClient: sqsClient,
-		queueURL:  queueURL,
+		queue: queue,
+		lanes: []*lane{{priority: task.PriorityNormal, queue: queue, weight: laneWeights[task.PriorityNormal]}},
 	}
 }
 
-// SendMessage 发送消息到队列
+// SetDeadLetterQueue 设置死信队列，无法解析的消息和重试次数用完的任务会被移入死信队列
+func (m *Manager) SetDeadLetterQueue(deadLetter Queue) {
+	m.deadLetter = deadLetter
+}
+
+// SetIngestRules 设置接入规则，S3 事件按规则决定是否转码以及使用的预设、输出前缀和优先级
+func (m *Manager) SetIngestRules(rules *ingest.Manager) {
+	m.ingestRules = rules
+}
+
+// Backend 返回队列后端类型
+func (m *Manager) Backend() string {
+	return m.queue.Backend()
+}
+
+// SendMessage 按消息的优先级发送到对应通道
 func (m *Manager) SendMessage(message *task.QueueMessage) error {
 	messageBody, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("序列化消息失败: %v", err)
+		return fmt.Errorf("序列化消息失败: %w", err)
 	}
 
-	_, err = m.sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
-		QueueUrl:    aws.String(m.queueURL),
-		MessageBody: aws.String(string(messageBody)),
-		MessageAttributes: map[string]types.MessageAttributeValue{
-			"TaskID": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(message.TaskID),
-			},
-		},
-	})
-
+	priority := task.NormalizePriority(message.Priority)
+	_, err = m.laneQueue(priority).Send(context.TODO(), string(messageBody), map[string]string{
+		attrTaskID:   message.TaskID,
+		attrPriority: priority,
+	}, 0)
 	if err != nil {
-		return fmt.Errorf("发送消息到SQS失败: %v", err)
+		return err
 	}
 
-	log.Printf("✅ 消息已发送到队列: TaskID=%s", message.TaskID)
+	log.Printf("✅ 消息已发送到队列: TaskID=%s, 优先级=%s", message.TaskID, priority)
 	return nil
 }
 
-// ReceiveMessages 从队列接收消息
-func (m *Manager) ReceiveMessages(maxMessages int32, waitTimeSeconds int32) ([]Message, error) {
-	result, err := m.sqsClient.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(m.queueURL),
-		MaxNumberOfMessages: maxMessages,
-		WaitTimeSeconds:     waitTimeSeconds,
-		MessageAttributeNames: []string{"All"},
-	})
+// ReceiveMessages 从队列接收消息，visibilityTimeout 为消息被接收后的不可见时长（<= 0 使用队列默认值）
+// 配置了多个优先级通道时按权重轮流优先接收各通道（见 receiveFromLanes），
+// 所有通道都为空时在最高优先级通道上长轮询
+func (m *Manager) ReceiveMessages(maxMessages int32, waitTimeSeconds int32, visibilityTimeout time.Duration) ([]Message, error) {
+	ctx := context.TODO()
+	waitTime := time.Duration(waitTimeSeconds) * time.Second
 
+	source, rawMessages, err := m.receiveFromLanes(ctx, int(maxMessages), waitTime, visibilityTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("从SQS接收消息失败: %v", err)
+		return nil, err
 	}
 
 	var messages []Message
-	for _, msg := range result.Messages {
-		queueMessage, err := m.parseMessage(*msg.Body)
+	for _, msg := range rawMessages {
+		jobs, err := m.parseMessage(msg.Body)
 		if err != nil {
-			log.Printf("⚠️  解析消息失败: %v", err)
+			m.handleUnparseable(source.queue, msg, err)
+			continue
+		}
+		// 接入规则指定了优先级的作业使用规则的优先级，其余由消息所在通道决定
+		for i := range jobs {
+			if jobs[i].Priority == "" {
+				jobs[i].Priority = source.priority
+			}
+		}
+		// 多个作业拆分为单独的消息；规则指定的优先级与所在通道不同时转发到对应通道
+		if len(jobs) > 1 || m.laneQueue(jobs[0].Priority) != source.queue {
+			m.splitMessage(source.queue, msg, jobs)
 			continue
 		}
 
 		messages = append(messages, Message{
-			ReceiptHandle: *msg.ReceiptHandle,
-			MessageID:     *msg.MessageId,
-			QueueMessage:  *queueMessage,
+			ReceiptHandle: msg.ReceiptHandle,
+			MessageID:     msg.MessageID,
+			ReceiveCount:  msg.ReceiveCount,
+			QueueMessage:  jobs[0],
 		})
 	}
 
 	return messages, nil
 }
 
-// parseMessage 解析消息，支持 API 格式和 S3 事件格式
-func (m *Manager) parseMessage(body string) (*task.QueueMessage, error) {
-	// 先尝试解析为 S3 事件消息
-	var s3Event task.S3EventMessage
-	if err := json.Unmarshal([]byte(body), &s3Event); err == nil && len(s3Event.Records) > 0 {
-		return m.parseS3Event(&s3Event)
+// splitMessage 将包含多个作业的消息（批量的 S3 事件）拆分为每个作业一条消息重新发送到各自优先级的通道，
+// 然后删除原消息，使每个作业独立处理、重试和确认。发送中途失败时保留原消息，重新投递后再次拆分，
+// 重复的转码作业由确定的任务ID去重
+func (m *Manager) splitMessage(source Queue, msg RawMessage, jobs []task.QueueMessage) {
+	for i := range jobs {
+		if err := m.SendMessage(&jobs[i]); err != nil {
+			log.Printf("⚠️  拆分消息失败，稍后重试: %s (%v)", msg.MessageID, err)
+			return
+		}
 	}
-
-	// 尝试解析为 API 发送的 QueueMessage
-	var queueMessage task.QueueMessage
-	if err := json.Unmarshal([]byte(body), &queueMessage); err != nil {
-		return nil, fmt.Errorf("无法解析消息: %v", err)
+	if err := source.Delete(context.TODO(), msg.ReceiptHandle); err != nil {
+		log.Printf("⚠️  删除已拆分的消息失败: %v", err)
+		return
 	}
-
-	return &queueMessage, nil
+	log.Printf("📦 消息已按作业拆分并发送到对应通道（%d 个作业）: %s", len(jobs), msg.MessageID)
 }
 
-// parseS3Event 解析 S3 事件消息并转换为 QueueMessage
-func (m *Manager) parseS3Event(s3Event *task.S3EventMessage) (*task.QueueMessage, error) {
-	if len(s3Event.Records) == 0 {
-		return nil, fmt.Errorf("S3事件记录为空")
-	}
+// errIgnoredMessage 不需要处理的消息（非视频文件、S3 测试事件等），直接从队列删除
+var errIgnoredMessage = errors.New("忽略的消息")
 
-	record := s3Event.Records[0]
-	
-	// 只处理 ObjectCreated 事件
-	if record.EventSource != "aws:s3" {
-		return nil, fmt.Errorf("非S3事件: %s", record.EventSource)
+// handleUnparseable 处理无法解析的消息：可忽略的消息直接删除，其余移入死信队列；
+// 未配置死信队列时保留在队列中，由 SQS 的 redrive policy 处理
+func (m *Manager) handleUnparseable(source Queue, msg RawMessage, parseErr error) {
+	if errors.Is(parseErr, errIgnoredMessage) {
+		log.Printf("⏭️  %v", parseErr)
+		if err := source.Delete(context.TODO(), msg.ReceiptHandle); err != nil {
+			log.Printf("⚠️  删除消息失败: %v", err)
+		}
+		return
 	}
 
-	// URL 解码 key (S3 事件中的 key 是 URL 编码的)
-	key, err := url.QueryUnescape(record.S3.Object.Key)
-	if err != nil {
-		key = record.S3.Object.Key
+	log.Printf("⚠️  解析消息失败: %v", parseErr)
+	if m.deadLetter == nil {
+		return
 	}
-
-	// 检查是否为视频文件
-	if !isVideoFile(key) {
-		return nil, fmt.Errorf("非视频文件，跳过: %s", key)
+	if err := m.moveToDeadLetter(source, msg, fmt.Sprintf("消息无法解析: %v", parseErr)); err != nil {
+		log.Printf("⚠️  移入死信队列失败: %v", err)
 	}
-
-	log.Printf("📥 收到S3事件: bucket=%s, key=%s, event=%s", 
-		record.S3.Bucket.Name, key, record.EventName)
-
-	// 生成任务ID
-	taskID := fmt.Sprintf("s3-%d", time.Now().UnixNano())
-
-	return &task.QueueMessage{
-		TaskID:         taskID,
-		InputBucket:    record.S3.Bucket.Name,
-		InputKey:       key,
-		OutputBucket:   "", // 将在处理时使用配置的默认输出桶
-		TranscodeTypes: []string{"mp4_standard", "mp4_smooth", "thumbnail"}, // 默认转码类型
-	}, nil
 }
 
-// isVideoFile 检查文件是否为视频文件
-func isVideoFile(key string) bool {
-	key = strings.ToLower(key)
-	videoExtensions := []string{".mp4", ".mov", ".avi", ".mkv", ".wmv", ".flv", ".webm", ".m4v", ".mpeg", ".mpg"}
-	for _, ext := range videoExtensions {
-		if strings.HasSuffix(key, ext) {
-			return true
-		}
-	}
-	return false
+// DeleteMessage 从消息所在通道删除消息
+func (m *Manager) DeleteMessage(message Message) error {
+	return m.laneQueue(message.QueueMessage.Priority).Delete(context.TODO(), message.ReceiptHandle)
 }
 
-// DeleteMessage 删除队列中的消息
-func (m *Manager) DeleteMessage(receiptHandle string) error {
-	_, err := m.sqsClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
-		QueueUrl:      aws.String(m.queueURL),
-		ReceiptHandle: aws.String(receiptHandle),
-	})
+// ChangeMessageVisibility 修改消息可见性超时，timeout 为 0 时立即释放消息供其他消费者接收
+func (m *Manager) ChangeMessageVisibility(message Message, timeout time.Duration) error {
+	return m.laneQueue(message.QueueMessage.Priority).ChangeVisibility(context.TODO(), message.ReceiptHandle, timeout)
+}
 
-	if err != nil {
-		return fmt.Errorf("删除SQS消息失败: %v", err)
+// KeepMessageInvisible 在 ctx 结束前每隔 timeout/3 将消息的可见性超时重置为 timeout，
+// 避免长时间处理的消息超时后被重新投递给其他消费者。阻塞直到 ctx 结束
+func (m *Manager) KeepMessageInvisible(ctx context.Context, message Message, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultVisibilityTimeout
+	}
+	source := m.laneQueue(message.QueueMessage.Priority)
+	ticker := time.NewTicker(timeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := source.ChangeVisibility(ctx, message.ReceiptHandle, timeout); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("⚠️  延长消息可见性失败: %v", err)
+				if errors.Is(err, ErrReceiptHandleInvalid) {
+					return
+				}
+			}
+		}
 	}
-
-	return nil
 }
 
-// GetQueueAttributes 获取队列属性
+// GetQueueAttributes 获取队列属性（所有通道合计，配置了多个通道时附带各通道的统计）
 func (m *Manager) GetQueueAttributes() (*task.QueueStatusResponse, error) {
-	result, err := m.sqsClient.GetQueueAttributes(context.TODO(), &sqs.GetQueueAttributesInput{
-		QueueUrl: aws.String(m.queueURL),
-		AttributeNames: []types.QueueAttributeName{
-			types.QueueAttributeNameApproximateNumberOfMessages,
-			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
-		},
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("获取队列属性失败: %v", err)
+	lanes := m.configuredLanes()
+	response := &task.QueueStatusResponse{}
+	if len(lanes) > 1 {
+		response.Lanes = make(map[string]task.LaneStatus, len(lanes))
 	}
-
-	status := &task.QueueStatusResponse{}
-
-	if val, ok := result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)]; ok {
-		if count, err := strconv.Atoi(val); err == nil {
-			status.ApproximateNumberOfMessages = count
+	for _, l := range lanes {
+		stats, err := l.queue.Attributes(context.TODO())
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if val, ok := result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)]; ok {
-		if count, err := strconv.Atoi(val); err == nil {
-			status.ApproximateNumberOfMessagesNotVisible = count
+		response.ApproximateNumberOfMessages += stats.Visible
+		response.ApproximateNumberOfMessagesNotVisible += stats.InFlight
+		if response.Lanes != nil {
+			response.Lanes[l.priority] = task.LaneStatus{
+				ApproximateNumberOfMessages:           stats.Visible,
+				ApproximateNumberOfMessagesNotVisible: stats.InFlight,
+				Weight:                                l.weight,
+			}
 		}
 	}
-
-	return status, nil
+	return response, nil
 }
 
-// PurgeQueue 清空队列
+// PurgeQueue 清空所有通道
 func (m *Manager) PurgeQueue() error {
-	_, err := m.sqsClient.PurgeQueue(context.TODO(), &sqs.PurgeQueueInput{
-		QueueUrl: aws.String(m.queueURL),
-	})
-
-	if err != nil {
-		return fmt.Errorf("清空队列失败: %v", err)
+	for _, l := range m.configuredLanes() {
+		if err := l.queue.Purge(context.TODO()); err != nil {
+			return err
+		}
 	}
 
 	log.Printf("✅ 队列已清空")
 	return nil
 }
 
-// RemoveMessageByTaskID 根据任务ID从队列中移除消息
+// RemoveMessageByTaskID 根据任务ID从队列中移除消息（依次查找各通道）
 func (m *Manager) RemoveMessageByTaskID(taskID string) (bool, error) {
-	// 接收队列中的消息（最多10条）
-	result, err := m.sqsClient.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(m.queueURL),
-		MaxNumberOfMessages: 10,
-		WaitTimeSeconds:     0, // 不等待
-		VisibilityTimeout:   30, // 30秒可见性超时
-		MessageAttributeNames: []string{"All"},
-	})
+	for _, l := range m.configuredLanes() {
+		found, err := m.removeFromLane(l.queue, taskID)
+		if err != nil || found {
+			return found, err
+		}
+	}
 
+	// 没有找到匹配的消息（可能已被处理或不在当前批次中）
+	log.Printf("⚠️  未在队列中找到任务: %s (可能已被处理)", taskID)
+	return false, nil
+}
+
+// removeFromLane 在单个通道中查找并删除任务的消息
+func (m *Manager) removeFromLane(source Queue, taskID string) (bool, error) {
+	// 接收队列中的消息（最多10条，不等待）
+	messages, err := source.Receive(context.TODO(), 10, 0, 30*time.Second)
 	if err != nil {
-		return false, fmt.Errorf("接收消息失败: %v", err)
+		return false, fmt.Errorf("接收消息失败: %w", err)
 	}
 
-	// 遍历消息查找匹配的任务ID
-	for _, msg := range result.Messages {
-		// 尝试从消息属性中获取TaskID
-		if attr, ok := msg.MessageAttributes["TaskID"]; ok && attr.StringValue != nil {
-			if *attr.StringValue == taskID {
-				// 找到匹配的消息，删除它
-				if err := m.DeleteMessage(*msg.ReceiptHandle); err != nil {
-					return false, err
-				}
-				log.Printf("✅ 已从队列移除任务: %s", taskID)
-				return true, nil
-			}
-		}
-
-		// 也尝试从消息体中解析TaskID
-		queueMessage, err := m.parseMessage(*msg.Body)
-		if err == nil && queueMessage.TaskID == taskID {
-			if err := m.DeleteMessage(*msg.ReceiptHandle); err != nil {
+	found := false
+	for _, msg := range messages {
+		if !found && m.messageMatchesTask(msg, taskID) {
+			// 找到匹配的消息，删除它
+			if err := source.Delete(context.TODO(), msg.ReceiptHandle); err != nil {
 				return false, err
 			}
 			log.Printf("✅ 已从队列移除任务: %s", taskID)
-			return true, nil
+			found = true
+			continue
+		}
+
+		// 不匹配的消息立即释放，避免其他任务被延迟处理
+		if err := source.ChangeVisibility(context.TODO(), msg.ReceiptHandle, 0); err != nil {
+			log.Printf("⚠️  释放消息失败: %v", err)
 		}
 	}
+	return found, nil
+}
 
-	// 没有找到匹配的消息（可能已被处理或不在当前批次中）
-	log.Printf("⚠️  未在队列中找到任务: %s (可能已被处理)", taskID)
-	return false, nil
+// messageMatchesTask 判断消息是否属于指定任务（优先检查消息属性，其次解析消息体）
+func (m *Manager) messageMatchesTask(msg RawMessage, taskID string) bool {
+	if value, ok := msg.Attributes[attrTaskID]; ok && value == taskID {
+		return true
+	}
+	// 包含多个作业的消息还会产生其他任务，不整体删除
+	jobs, err := m.parseMessage(msg.Body)
+	return err == nil && len(jobs) == 1 && jobs[0].TaskID == taskID
 }
 
 // Message 包装的消息结构
 type Message struct {
 	ReceiptHandle string
 	MessageID     string
+	ReceiveCount  int // 已接收次数（含本次）
 	QueueMessage  task.QueueMessage
 }
\ No newline at end of file
@@ -0,0 +1,227 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// storedMessage 内存队列和磁盘队列共用的消息状态
+type storedMessage struct {
+	MessageID     string            `json:"message_id"`
+	Body          string            `json:"body"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	SentAt        time.Time         `json:"sent_at"`
+	VisibleAt     time.Time         `json:"visible_at"`               // 早于该时间消息不可见（延迟投递或已被接收）
+	ReceiptHandle string            `json:"receipt_handle,omitempty"` // 最近一次接收分配的句柄
+	ReceiveCount  int               `json:"receive_count"`
+}
+
+// toRaw 转换为对外的原始消息
+func (m *storedMessage) toRaw() RawMessage {
+	attrs := make(map[string]string, len(m.Attributes))
+	for k, v := range m.Attributes {
+		attrs[k] = v
+	}
+	return RawMessage{
+		MessageID:     m.MessageID,
+		ReceiptHandle: m.ReceiptHandle,
+		Body:          m.Body,
+		Attributes:    attrs,
+		ReceiveCount:  m.ReceiveCount,
+		SentAt:        m.SentAt,
+	}
+}
+
+// newStoredMessage 创建待入队的消息
+func newStoredMessage(body string, attributes map[string]string, delay time.Duration) *storedMessage {
+	now := time.Now()
+	return &storedMessage{
+		MessageID:  uuid.New().String(),
+		Body:       body,
+		Attributes: attributes,
+		SentAt:     now,
+		VisibleAt:  now.Add(delay),
+	}
+}
+
+// claimVisible 从消息列表中按发送时间顺序领取最多 max 条可见消息，并设置新的不可见期
+func claimVisible(messages []*storedMessage, max int, visibilityTimeout time.Duration) []*storedMessage {
+	if visibilityTimeout <= 0 {
+		visibilityTimeout = defaultVisibilityTimeout
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].SentAt.Before(messages[j].SentAt) })
+
+	now := time.Now()
+	var claimed []*storedMessage
+	for _, msg := range messages {
+		if len(claimed) >= max {
+			break
+		}
+		if msg.VisibleAt.After(now) {
+			continue
+		}
+		msg.ReceiveCount++
+		msg.ReceiptHandle = msg.MessageID + ":" + uuid.New().String()
+		msg.VisibleAt = now.Add(visibilityTimeout)
+		claimed = append(claimed, msg)
+	}
+	return claimed
+}
+
+// countStats 统计消息状态
+func countStats(messages []*storedMessage) *Stats {
+	now := time.Now()
+	stats := &Stats{}
+	for _, msg := range messages {
+		switch {
+		case !msg.VisibleAt.After(now):
+			stats.Visible++
+		case msg.ReceiptHandle != "":
+			stats.InFlight++
+		default:
+			stats.Delayed++
+		}
+	}
+	return stats
+}
+
+// MemoryQueue 进程内内存队列
+// 消息只在当前进程内可见，进程退出即丢失，适合测试和 API/处理器同进程运行的场景
+type MemoryQueue struct {
+	mu       sync.Mutex
+	messages map[string]*storedMessage
+	notify   chan struct{} // 有新消息时关闭并替换，唤醒所有等待中的接收者
+}
+
+// NewMemoryQueue 创建内存队列
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		messages: make(map[string]*storedMessage),
+		notify:   make(chan struct{}),
+	}
+}
+
+// Backend 返回后端类型
+func (q *MemoryQueue) Backend() string {
+	return BackendMemory
+}
+
+// Send 发送消息
+func (q *MemoryQueue) Send(ctx context.Context, body string, attributes map[string]string, delay time.Duration) (string, error) {
+	msg := newStoredMessage(body, attributes, delay)
+
+	q.mu.Lock()
+	q.messages[msg.MessageID] = msg
+	close(q.notify)
+	q.notify = make(chan struct{})
+	q.mu.Unlock()
+
+	return msg.MessageID, nil
+}
+
+// Receive 接收消息，队列为空时最多等待 waitTime
+func (q *MemoryQueue) Receive(ctx context.Context, maxMessages int, waitTime, visibilityTimeout time.Duration) ([]RawMessage, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		q.mu.Lock()
+		all := make([]*storedMessage, 0, len(q.messages))
+		for _, msg := range q.messages {
+			all = append(all, msg)
+		}
+		claimed := claimVisible(all, maxMessages, visibilityTimeout)
+		notify := q.notify
+		q.mu.Unlock()
+
+		if len(claimed) > 0 {
+			result := make([]RawMessage, 0, len(claimed))
+			for _, msg := range claimed {
+				result = append(result, msg.toRaw())
+			}
+			return result, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		// 延迟消息或不可见消息到期不会触发通知，因此最多等待 1 秒后重新检查
+		if remaining > time.Second {
+			remaining = time.Second
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// lookup 根据句柄查找消息，调用方需持有锁
+func (q *MemoryQueue) lookup(receiptHandle string) (*storedMessage, error) {
+	for _, msg := range q.messages {
+		if msg.ReceiptHandle == receiptHandle {
+			return msg, nil
+		}
+	}
+	return nil, ErrReceiptHandleInvalid
+}
+
+// Delete 删除消息
+func (q *MemoryQueue) Delete(ctx context.Context, receiptHandle string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msg, err := q.lookup(receiptHandle)
+	if err != nil {
+		return err
+	}
+	delete(q.messages, msg.MessageID)
+	return nil
+}
+
+// ChangeVisibility 修改消息可见性超时
+func (q *MemoryQueue) ChangeVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msg, err := q.lookup(receiptHandle)
+	if err != nil {
+		return err
+	}
+	msg.VisibleAt = time.Now().Add(timeout)
+	if timeout <= 0 {
+		close(q.notify)
+		q.notify = make(chan struct{})
+	}
+	return nil
+}
+
+// Attributes 获取队列统计信息
+func (q *MemoryQueue) Attributes(ctx context.Context) (*Stats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	all := make([]*storedMessage, 0, len(q.messages))
+	for _, msg := range q.messages {
+		all = append(all, msg)
+	}
+	return countStats(all), nil
+}
+
+// Purge 清空队列
+func (q *MemoryQueue) Purge(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages = make(map[string]*storedMessage)
+	return nil
+}
@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	testQueueBackend(t, func(t *testing.T) Queue {
+		return NewMemoryQueue()
+	})
+}
+
+func TestMemoryQueueReceiveWakesOnSend(t *testing.T) {
+	q := NewMemoryQueue()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		q.Send(context.Background(), "task-1", nil, 0)
+	}()
+
+	start := time.Now()
+	messages, err := q.Receive(context.Background(), 1, 5*time.Second, testVisibility)
+	if err != nil {
+		t.Fatalf("接收消息失败: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatal("等待期间发送的消息应被接收")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("新消息应立即唤醒接收者，实际等待 %v", elapsed)
+	}
+}
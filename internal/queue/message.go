@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"enhanced_video_transcoder/internal/ingest"
+	"enhanced_video_transcoder/internal/task"
+)
+
+// defaultS3TranscodeTypes 没有接入规则匹配时 S3 事件触发的任务使用的默认转码类型
+var defaultS3TranscodeTypes = []string{"mp4_standard", "mp4_smooth", "thumbnail"}
+
+// parseMessage 解析消息为一个或多个作业，支持 API 格式和 S3 事件格式
+// S3 事件可以是直接投递的原始格式、经 SNS 转发的格式或 EventBridge 格式，一条消息可能包含多条记录
+func (m *Manager) parseMessage(body string) ([]task.QueueMessage, error) {
+	// 经 SNS 转发的通知，实际内容在 Message 字段中
+	var notification task.SNSNotification
+	if err := json.Unmarshal([]byte(body), &notification); err == nil && notification.Type == "Notification" && notification.Message != "" {
+		return m.parseMessage(notification.Message)
+	}
+
+	// S3 事件通知
+	var s3Event task.S3EventMessage
+	if err := json.Unmarshal([]byte(body), &s3Event); err == nil && len(s3Event.Records) > 0 {
+		return m.parseS3Event(&s3Event)
+	}
+
+	// EventBridge 格式的 S3 事件
+	var bridgeEvent task.EventBridgeS3Event
+	if err := json.Unmarshal([]byte(body), &bridgeEvent); err == nil && bridgeEvent.Source == "aws.s3" {
+		return m.parseEventBridgeEvent(&bridgeEvent)
+	}
+
+	// 配置 S3 事件通知时 S3 发送的测试消息
+	var testEvent struct {
+		Event string `json:"Event"`
+	}
+	if err := json.Unmarshal([]byte(body), &testEvent); err == nil && testEvent.Event == "s3:TestEvent" {
+		return nil, fmt.Errorf("%w: S3 测试事件", errIgnoredMessage)
+	}
+
+	// 尝试解析为 API 发送的 QueueMessage
+	var queueMessage task.QueueMessage
+	if err := json.Unmarshal([]byte(body), &queueMessage); err != nil {
+		return nil, fmt.Errorf("无法解析消息: %w", err)
+	}
+	if queueMessage.InputKey == "" || (queueMessage.TaskID == "" && queueMessage.Action != task.QueueActionCancel) {
+		return nil, fmt.Errorf("消息缺少 task_id 或 input_key")
+	}
+
+	return []task.QueueMessage{queueMessage}, nil
+}
+
+// parseS3Event 将 S3 事件中的每条记录转换为作业
+// ObjectCreated 创建转码作业，ObjectRemoved 创建取消作业，
+// 被接入规则忽略的文件、没有规则匹配的非视频文件和其他事件类型被忽略
+func (m *Manager) parseS3Event(s3Event *task.S3EventMessage) ([]task.QueueMessage, error) {
+	var jobs []task.QueueMessage
+	var skipped []string
+	for _, record := range s3Event.Records {
+		if record.EventSource != "aws:s3" {
+			skipped = append(skipped, fmt.Sprintf("非S3事件 %s", record.EventSource))
+			continue
+		}
+
+		// URL 解码 key (S3 事件中的 key 是 URL 编码的)
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+
+		// 按接入规则决定是否处理：匹配的规则决定转码类型、输出前缀和优先级，
+		// 没有规则匹配时处理常见视频格式并使用默认转码类型。删除事件不带大小，不检查大小范围
+		size := record.S3.Object.Size
+		if strings.HasPrefix(record.EventName, "ObjectRemoved:") {
+			size = -1
+		}
+		rule := m.matchIngestRule(record.S3.Bucket.Name, key, size)
+		if rule != nil && rule.Ignore {
+			skipped = append(skipped, fmt.Sprintf("接入规则 %s 忽略 %s", rule.Name, key))
+			continue
+		}
+		if rule == nil && !ingest.IsVideoFile(key) {
+			skipped = append(skipped, fmt.Sprintf("非视频文件 %s", key))
+			continue
+		}
+
+		log.Printf("📥 收到S3事件: bucket=%s, key=%s, event=%s",
+			record.S3.Bucket.Name, key, record.EventName)
+
+		switch {
+		case strings.HasPrefix(record.EventName, "ObjectCreated:"):
+			job := task.QueueMessage{
+				TaskID:         s3EventTaskID(record.S3.Bucket.Name, key, record.S3.Object),
+				InputBucket:    record.S3.Bucket.Name,
+				InputKey:       key,
+				OutputBucket:   "", // 将在处理时使用配置的默认输出桶
+				TranscodeTypes: defaultS3TranscodeTypes,
+			}
+			if rule != nil {
+				log.Printf("📐 匹配接入规则: %s (%s)", rule.Name, rule.RuleID)
+				job.TranscodeTypes = rule.TranscodeTypes
+				job.OutputPrefix = rule.OutputPrefix
+				job.Priority = rule.Priority
+				job.IngestRule = rule.RuleID
+			}
+			jobs = append(jobs, job)
+		case strings.HasPrefix(record.EventName, "ObjectRemoved:"):
+			jobs = append(jobs, task.QueueMessage{
+				InputBucket: record.S3.Bucket.Name,
+				InputKey:    key,
+				Action:      task.QueueActionCancel,
+			})
+		default:
+			skipped = append(skipped, fmt.Sprintf("不处理的事件类型 %s", record.EventName))
+		}
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s", errIgnoredMessage, strings.Join(skipped, "; "))
+	}
+	return jobs, nil
+}
+
+// parseEventBridgeEvent 将 EventBridge 格式的 S3 事件转换为 S3 事件记录后解析
+func (m *Manager) parseEventBridgeEvent(event *task.EventBridgeS3Event) ([]task.QueueMessage, error) {
+	var eventName string
+	switch event.DetailType {
+	case "Object Created":
+		eventName = "ObjectCreated:" + event.Detail.Reason
+	case "Object Deleted":
+		eventName = "ObjectRemoved:" + event.Detail.Reason
+	default:
+		return nil, fmt.Errorf("%w: 不处理的 EventBridge 事件 %s", errIgnoredMessage, event.DetailType)
+	}
+
+	object := event.Detail.Object
+	return m.parseS3Event(&task.S3EventMessage{
+		Records: []task.S3EventRecord{{
+			EventSource: "aws:s3",
+			EventName:   eventName,
+			EventTime:   event.Time,
+			S3: task.S3Entity{
+				Bucket: event.Detail.Bucket,
+				Object: task.S3Object{
+					Key:       object.Key,
+					Size:      object.Size,
+					ETag:      object.ETag,
+					VersionID: object.VersionID,
+					Sequencer: object.Sequencer,
+				},
+			},
+		}},
+	})
+}
+
+// s3EventTaskID 根据对象版本生成确定的任务ID
+// S3 事件至少投递一次，同一对象版本的重复事件得到相同的任务ID，由处理器去重；
+// 同一个 key 上传了新内容（ETag 或 versionId 不同）时生成新的任务
+func s3EventTaskID(bucket, key string, object task.S3Object) string {
+	version := object.VersionID + ":" + strings.Trim(object.ETag, `"`)
+	if version == ":" {
+		version = object.Sequencer
+	}
+	sum := sha256.Sum256([]byte(bucket + "\x00" + key + "\x00" + version))
+	return "s3-" + hex.EncodeToString(sum[:16])
+}
+
+// matchIngestRule 返回第一条匹配对象的接入规则，未配置规则或没有规则匹配时返回 nil
+func (m *Manager) matchIngestRule(bucket, key string, size int64) *ingest.Rule {
+	if m.ingestRules == nil {
+		return nil
+	}
+	return m.ingestRules.Match(bucket, key, size)
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"enhanced_video_transcoder/internal/ingest"
+	"enhanced_video_transcoder/internal/task"
+)
+
+// s3EventBody 构造包含多条记录的 S3 事件消息
+func s3EventBody(records ...string) string {
+	return `{"Records":[` + strings.Join(records, ",") + `]}`
+}
+
+// s3Record 构造一条 S3 事件记录
+func s3Record(eventName, key, eTag string) string {
+	return `{"eventSource":"aws:s3","eventName":"` + eventName + `","s3":{"bucket":{"name":"input"},"object":{"key":"` + key + `","size":1024,"eTag":"` + eTag + `","sequencer":"0A1B"}}}`
+}
+
+func TestParseMessage(t *testing.T) {
+	m := NewManager(NewMemoryQueue())
+
+	tests := []struct {
+		name        string
+		body        string
+		wantKeys    []string // 各作业的 input_key
+		wantActions []string // 各作业的动作
+		wantErr     error
+	}{
+		{
+			name:        "多条记录各生成一个作业",
+			body:        s3EventBody(s3Record("ObjectCreated:Put", "a.mp4", "e1"), s3Record("ObjectCreated:Put", "b.mov", "e2")),
+			wantKeys:    []string{"a.mp4", "b.mov"},
+			wantActions: []string{"", ""},
+		},
+		{
+			name:        "key 按 URL 编码解码",
+			body:        s3EventBody(s3Record("ObjectCreated:Put", "videos/my+clip%281%29.mp4", "e1")),
+			wantKeys:    []string{"videos/my clip(1).mp4"},
+			wantActions: []string{""},
+		},
+		{
+			name:        "删除事件生成取消作业",
+			body:        s3EventBody(s3Record("ObjectRemoved:Delete", "a.mp4", "")),
+			wantKeys:    []string{"a.mp4"},
+			wantActions: []string{task.QueueActionCancel},
+		},
+		{
+			name:        "非视频文件被跳过，其余记录照常处理",
+			body:        s3EventBody(s3Record("ObjectCreated:Put", "notes.txt", "e1"), s3Record("ObjectCreated:Put", "a.mp4", "e2")),
+			wantKeys:    []string{"a.mp4"},
+			wantActions: []string{""},
+		},
+		{
+			name:    "所有记录都被跳过时忽略消息",
+			body:    s3EventBody(s3Record("ObjectCreated:Put", "notes.txt", "e1"), s3Record("ObjectRestore:Post", "a.mp4", "e2")),
+			wantErr: errIgnoredMessage,
+		},
+		{
+			name:        "SNS 转发的 S3 事件",
+			body:        `{"Type":"Notification","Message":` + quoteJSON(s3EventBody(s3Record("ObjectCreated:Put", "a.mp4", "e1"))) + `}`,
+			wantKeys:    []string{"a.mp4"},
+			wantActions: []string{""},
+		},
+		{
+			name:        "EventBridge 创建事件",
+			body:        `{"source":"aws.s3","detail-type":"Object Created","detail":{"bucket":{"name":"input"},"object":{"key":"a.mp4","size":10,"etag":"e1"},"reason":"PutObject"}}`,
+			wantKeys:    []string{"a.mp4"},
+			wantActions: []string{""},
+		},
+		{
+			name:        "EventBridge 删除事件",
+			body:        `{"source":"aws.s3","detail-type":"Object Deleted","detail":{"bucket":{"name":"input"},"object":{"key":"a.mp4"},"reason":"DeleteObject"}}`,
+			wantKeys:    []string{"a.mp4"},
+			wantActions: []string{task.QueueActionCancel},
+		},
+		{
+			name:    "EventBridge 其他事件被忽略",
+			body:    `{"source":"aws.s3","detail-type":"Object Restore Completed","detail":{"bucket":{"name":"input"},"object":{"key":"a.mp4"}}}`,
+			wantErr: errIgnoredMessage,
+		},
+		{
+			name:    "S3 测试事件被忽略",
+			body:    `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"input"}`,
+			wantErr: errIgnoredMessage,
+		},
+		{
+			name:        "API 发送的消息",
+			body:        `{"task_id":"task-1","input_bucket":"input","input_key":"a.mp4"}`,
+			wantKeys:    []string{"a.mp4"},
+			wantActions: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := m.parseMessage(tt.body)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseMessage() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMessage() error = %v", err)
+			}
+			var keys []string
+			var actions []string
+			for _, job := range jobs {
+				keys = append(keys, job.InputKey)
+				actions = append(actions, job.Action)
+				if job.Action == "" && job.TaskID == "" {
+					t.Errorf("转码作业缺少任务ID: %+v", job)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) || !reflect.DeepEqual(actions, tt.wantActions) {
+				t.Errorf("作业 = %v %v, want %v %v", keys, actions, tt.wantKeys, tt.wantActions)
+			}
+		})
+	}
+}
+
+func TestParseMessageInvalid(t *testing.T) {
+	m := NewManager(NewMemoryQueue())
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "非法 JSON", body: `not json`},
+		{name: "缺少 task_id", body: `{"input_bucket":"input","input_key":"a.mp4"}`},
+		{name: "缺少 input_key", body: `{"task_id":"task-1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.parseMessage(tt.body); err == nil || errors.Is(err, errIgnoredMessage) {
+				t.Errorf("parseMessage() error = %v, want 解析错误", err)
+			}
+		})
+	}
+}
+
+func TestParseMessageIngestRules(t *testing.T) {
+	store, err := ingest.NewSQLiteStore(filepath.Join(t.TempDir(), "rules.db"))
+	if err != nil {
+		t.Fatalf("创建规则存储失败: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	rules := ingest.NewManager(store)
+	for _, rule := range []*ingest.Rule{
+		{Name: "忽略草稿", Order: 1, KeyPattern: "drafts/", Ignore: true},
+		{Name: "母带", Order: 2, KeyPattern: "masters/**", Extensions: []string{"mxf"}, TranscodeTypes: []string{"hls"}, OutputPrefix: "out", Priority: task.PriorityHigh},
+	} {
+		if err := rules.SaveRule(rule); err != nil {
+			t.Fatalf("保存规则失败: %v", err)
+		}
+	}
+
+	m := NewManager(NewMemoryQueue())
+	m.SetIngestRules(rules)
+
+	jobs, err := m.parseMessage(s3EventBody(
+		s3Record("ObjectCreated:Put", "drafts/a.mp4", "e1"),
+		s3Record("ObjectCreated:Put", "masters/2025/show.mxf", "e2"),
+		s3Record("ObjectCreated:Put", "uploads/b.mp4", "e3"),
+	))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("作业数 = %d, want 2: %+v", len(jobs), jobs)
+	}
+
+	master := jobs[0]
+	if master.InputKey != "masters/2025/show.mxf" || !reflect.DeepEqual(master.TranscodeTypes, []string{"hls"}) ||
+		master.OutputPrefix != "out/" || master.Priority != task.PriorityHigh || master.IngestRule == "" {
+		t.Errorf("匹配规则的作业不符: %+v", master)
+	}
+	fallback := jobs[1]
+	if fallback.InputKey != "uploads/b.mp4" || !reflect.DeepEqual(fallback.TranscodeTypes, defaultS3TranscodeTypes) || fallback.IngestRule != "" {
+		t.Errorf("未匹配规则的作业应使用默认转码类型: %+v", fallback)
+	}
+}
+
+func TestS3EventTaskID(t *testing.T) {
+	base := task.S3Object{ETag: `"etag-1"`, VersionID: "v1", Sequencer: "0001"}
+
+	tests := []struct {
+		name   string
+		bucket string
+		key    string
+		object task.S3Object
+		same   bool // 是否与 base 生成相同的任务ID
+	}{
+		{name: "重复投递的同一事件", bucket: "input", key: "a.mp4", object: base, same: true},
+		{name: "ETag 引号不影响结果", bucket: "input", key: "a.mp4", object: task.S3Object{ETag: "etag-1", VersionID: "v1", Sequencer: "0001"}, same: true},
+		{name: "有版本信息时忽略 sequencer", bucket: "input", key: "a.mp4", object: task.S3Object{ETag: `"etag-1"`, VersionID: "v1", Sequencer: "0002"}, same: true},
+		{name: "新版本生成新任务", bucket: "input", key: "a.mp4", object: task.S3Object{ETag: `"etag-1"`, VersionID: "v2", Sequencer: "0001"}},
+		{name: "新内容生成新任务", bucket: "input", key: "a.mp4", object: task.S3Object{ETag: `"etag-2"`, VersionID: "v1", Sequencer: "0001"}},
+		{name: "不同 key", bucket: "input", key: "b.mp4", object: base},
+		{name: "不同桶", bucket: "other", key: "a.mp4", object: base},
+	}
+
+	want := s3EventTaskID("input", "a.mp4", base)
+	if !strings.HasPrefix(want, "s3-") {
+		t.Fatalf("任务ID应以 s3- 开头: %s", want)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s3EventTaskID(tt.bucket, tt.key, tt.object)
+			if (got == want) != tt.same {
+				t.Errorf("s3EventTaskID() = %s, base = %s, same = %v", got, want, tt.same)
+			}
+		})
+	}
+
+	// 没有 ETag 和 versionId 时按 sequencer 区分
+	first := s3EventTaskID("input", "a.mp4", task.S3Object{Sequencer: "0001"})
+	if first != s3EventTaskID("input", "a.mp4", task.S3Object{Sequencer: "0001"}) {
+		t.Error("相同 sequencer 应生成相同的任务ID")
+	}
+	if first == s3EventTaskID("input", "a.mp4", task.S3Object{Sequencer: "0002"}) {
+		t.Error("不同 sequencer 应生成不同的任务ID")
+	}
+}
+
+// quoteJSON 将字符串编码为 JSON 字符串字面量
+func quoteJSON(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// 队列后端类型
+const (
+	BackendSQS    = "sqs"    // AWS SQS（默认）
+	BackendMemory = "memory" // 进程内内存队列，仅适合单进程和测试
+	BackendFile   = "file"   // 本地磁盘持久化队列，适合单机部署
+)
+
+// defaultVisibilityTimeout 接收消息时未指定可见性超时的默认值（与 SQS 默认值一致）
+const defaultVisibilityTimeout = 30 * time.Second
+
+// ErrReceiptHandleInvalid 消息句柄无效（消息已删除或已被重新投递）
+var ErrReceiptHandleInvalid = errors.New("消息句柄无效或已过期")
+
+// ErrNoDeadLetterQueue 未配置死信队列
+var ErrNoDeadLetterQueue = errors.New("未配置死信队列")
+
+// ErrMessageNotFound 死信队列中没有指定的消息
+var ErrMessageNotFound = errors.New("消息不存在")
+
+// RawMessage 队列后端返回的原始消息
+type RawMessage struct {
+	MessageID     string
+	ReceiptHandle string
+	Body          string
+	Attributes    map[string]string // 消息属性（如 TaskID）
+	ReceiveCount  int               // 已接收次数（含本次）
+	SentAt        time.Time
+}
+
+// Stats 队列统计信息
+type Stats struct {
+	Visible  int // 可被接收的消息数
+	InFlight int // 已被接收、处于不可见状态的消息数
+	Delayed  int // 延迟投递中的消息数
+}
+
+// Queue 队列后端接口，屏蔽 SQS / 内存 / 磁盘等具体实现
+// visibilityTimeout <= 0 时使用后端默认值；ChangeVisibility 传 0 表示立即释放消息
+type Queue interface {
+	Send(ctx context.Context, body string, attributes map[string]string, delay time.Duration) (string, error)
+	Receive(ctx context.Context, maxMessages int, waitTime, visibilityTimeout time.Duration) ([]RawMessage, error)
+	Delete(ctx context.Context, receiptHandle string) error
+	ChangeVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error
+	Attributes(ctx context.Context) (*Stats, error)
+	Purge(ctx context.Context) error
+	// Backend 返回后端类型，用于日志展示
+	Backend() string
+}
+
+// New 根据后端类型创建队列
+func New(backend string, sqsClient *sqs.Client, queueURL, dir string) (Queue, error) {
+	switch backend {
+	case "", BackendSQS:
+		if sqsClient == nil || queueURL == "" {
+			return nil, fmt.Errorf("SQS 队列需要 SQS 客户端和队列URL")
+		}
+		return NewSQSQueue(sqsClient, queueURL), nil
+	case BackendMemory:
+		return NewMemoryQueue(), nil
+	case BackendFile:
+		return NewFileQueue(dir)
+	default:
+		return nil, fmt.Errorf("未知的队列后端: %s", backend)
+	}
+}
+
+// NewOptional 根据后端类型创建可选的队列（死信队列、优先级通道）
+// SQS 后端未配置队列URL时返回 nil（不启用）；memory / file 后端总是创建，file 后端使用单独的目录
+func NewOptional(backend string, sqsClient *sqs.Client, queueURL, dir string) (Queue, error) {
+	if (backend == "" || backend == BackendSQS) && queueURL == "" {
+		return nil, nil
+	}
+	return New(backend, sqsClient, queueURL, dir)
+}
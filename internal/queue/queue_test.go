@@ -0,0 +1,200 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testVisibility 测试中使用的短可见性超时
+const testVisibility = 200 * time.Millisecond
+
+// receiveOne 立即接收一条消息，队列为空时返回 nil
+func receiveOne(t *testing.T, q Queue, visibilityTimeout time.Duration) *RawMessage {
+	t.Helper()
+	messages, err := q.Receive(context.Background(), 1, 0, visibilityTimeout)
+	if err != nil {
+		t.Fatalf("接收消息失败: %v", err)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return &messages[0]
+}
+
+// send 发送消息，失败时终止测试
+func send(t *testing.T, q Queue, body string, delay time.Duration) string {
+	t.Helper()
+	messageID, err := q.Send(context.Background(), body, map[string]string{"TaskID": body}, delay)
+	if err != nil {
+		t.Fatalf("发送消息失败: %v", err)
+	}
+	return messageID
+}
+
+// testQueueBackend 对内存队列和磁盘队列共用的行为测试
+func testQueueBackend(t *testing.T, newQueue func(t *testing.T) Queue) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, q Queue)
+	}{
+		{
+			name: "发送后可接收",
+			run: func(t *testing.T, q Queue) {
+				messageID := send(t, q, "task-1", 0)
+				msg := receiveOne(t, q, testVisibility)
+				if msg == nil {
+					t.Fatal("应接收到消息")
+				}
+				if msg.MessageID != messageID || msg.Body != "task-1" || msg.Attributes["TaskID"] != "task-1" {
+					t.Errorf("消息内容不符: %+v", msg)
+				}
+				if msg.ReceiveCount != 1 || msg.ReceiptHandle == "" {
+					t.Errorf("ReceiveCount = %d, ReceiptHandle = %q", msg.ReceiveCount, msg.ReceiptHandle)
+				}
+			},
+		},
+		{
+			name: "按发送顺序接收且不超过数量上限",
+			run: func(t *testing.T, q Queue) {
+				for _, body := range []string{"a", "b", "c"} {
+					send(t, q, body, 0)
+				}
+				messages, err := q.Receive(ctx, 2, 0, testVisibility)
+				if err != nil {
+					t.Fatalf("接收消息失败: %v", err)
+				}
+				if len(messages) != 2 || messages[0].Body != "a" || messages[1].Body != "b" {
+					t.Fatalf("接收结果不符: %+v", messages)
+				}
+				msg := receiveOne(t, q, testVisibility)
+				if msg == nil || msg.Body != "c" {
+					t.Fatalf("应接收到剩余消息 c: %+v", msg)
+				}
+			},
+		},
+		{
+			name: "可见性超时前不重复投递，超时后重新投递",
+			run: func(t *testing.T, q Queue) {
+				send(t, q, "task-1", 0)
+				first := receiveOne(t, q, testVisibility)
+				if first == nil {
+					t.Fatal("应接收到消息")
+				}
+				if msg := receiveOne(t, q, testVisibility); msg != nil {
+					t.Fatalf("不可见期内不应重复投递: %+v", msg)
+				}
+				stats, err := q.Attributes(ctx)
+				if err != nil {
+					t.Fatalf("获取统计失败: %v", err)
+				}
+				if stats.InFlight != 1 || stats.Visible != 0 {
+					t.Errorf("统计不符: %+v", stats)
+				}
+
+				time.Sleep(testVisibility + 50*time.Millisecond)
+				second := receiveOne(t, q, testVisibility)
+				if second == nil {
+					t.Fatal("超时后应重新投递")
+				}
+				if second.MessageID != first.MessageID || second.ReceiveCount != 2 {
+					t.Errorf("重新投递的消息不符: %+v", second)
+				}
+				if second.ReceiptHandle == first.ReceiptHandle {
+					t.Error("重新投递应分配新的句柄")
+				}
+				if err := q.Delete(ctx, first.ReceiptHandle); !errors.Is(err, ErrReceiptHandleInvalid) {
+					t.Errorf("旧句柄删除应返回 ErrReceiptHandleInvalid，实际: %v", err)
+				}
+			},
+		},
+		{
+			name: "可见性置零立即释放消息",
+			run: func(t *testing.T, q Queue) {
+				send(t, q, "task-1", 0)
+				msg := receiveOne(t, q, time.Minute)
+				if msg == nil {
+					t.Fatal("应接收到消息")
+				}
+				if err := q.ChangeVisibility(ctx, msg.ReceiptHandle, 0); err != nil {
+					t.Fatalf("修改可见性失败: %v", err)
+				}
+				if again := receiveOne(t, q, time.Minute); again == nil || again.MessageID != msg.MessageID {
+					t.Fatalf("释放后应可再次接收: %+v", again)
+				}
+			},
+		},
+		{
+			name: "延迟消息到期前不可见",
+			run: func(t *testing.T, q Queue) {
+				send(t, q, "task-1", testVisibility)
+				if msg := receiveOne(t, q, testVisibility); msg != nil {
+					t.Fatalf("延迟期内不应投递: %+v", msg)
+				}
+				stats, err := q.Attributes(ctx)
+				if err != nil {
+					t.Fatalf("获取统计失败: %v", err)
+				}
+				if stats.Delayed != 1 {
+					t.Errorf("统计不符: %+v", stats)
+				}
+
+				messages, err := q.Receive(ctx, 1, 2*time.Second, testVisibility)
+				if err != nil {
+					t.Fatalf("接收消息失败: %v", err)
+				}
+				if len(messages) != 1 {
+					t.Fatal("延迟到期后应投递")
+				}
+			},
+		},
+		{
+			name: "删除后不再投递",
+			run: func(t *testing.T, q Queue) {
+				send(t, q, "task-1", 0)
+				msg := receiveOne(t, q, testVisibility)
+				if msg == nil {
+					t.Fatal("应接收到消息")
+				}
+				if err := q.Delete(ctx, msg.ReceiptHandle); err != nil {
+					t.Fatalf("删除消息失败: %v", err)
+				}
+				if err := q.Delete(ctx, msg.ReceiptHandle); !errors.Is(err, ErrReceiptHandleInvalid) {
+					t.Errorf("重复删除应返回 ErrReceiptHandleInvalid，实际: %v", err)
+				}
+
+				time.Sleep(testVisibility + 50*time.Millisecond)
+				if again := receiveOne(t, q, testVisibility); again != nil {
+					t.Fatalf("已删除的消息不应再投递: %+v", again)
+				}
+				stats, err := q.Attributes(ctx)
+				if err != nil {
+					t.Fatalf("获取统计失败: %v", err)
+				}
+				if *stats != (Stats{}) {
+					t.Errorf("删除后队列应为空: %+v", stats)
+				}
+			},
+		},
+		{
+			name: "无效句柄",
+			run: func(t *testing.T, q Queue) {
+				if err := q.Delete(ctx, "missing:handle"); !errors.Is(err, ErrReceiptHandleInvalid) {
+					t.Errorf("Delete 应返回 ErrReceiptHandleInvalid，实际: %v", err)
+				}
+				if err := q.ChangeVisibility(ctx, "missing:handle", 0); !errors.Is(err, ErrReceiptHandleInvalid) {
+					t.Errorf("ChangeVisibility 应返回 ErrReceiptHandleInvalid，实际: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newQueue(t))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSQueue 基于 AWS SQS 的队列实现
+type SQSQueue struct {
+	sqsClient *sqs.Client
+	queueURL  string
+}
+
+// NewSQSQueue 创建 SQS 队列
+func NewSQSQueue(sqsClient *sqs.Client, queueURL string) *SQSQueue {
+	return &SQSQueue{
+		sqsClient: sqsClient,
+		queueURL:  queueURL,
+	}
+}
+
+// Backend 返回后端类型
+func (q *SQSQueue) Backend() string {
+	return BackendSQS
+}
+
+// Send 发送消息
+func (q *SQSQueue) Send(ctx context.Context, body string, attributes map[string]string, delay time.Duration) (string, error) {
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(body),
+	}
+	if len(attributes) > 0 {
+		input.MessageAttributes = make(map[string]types.MessageAttributeValue, len(attributes))
+		for name, value := range attributes {
+			input.MessageAttributes[name] = types.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+		}
+	}
+	if delay > 0 {
+		// SQS 单条消息最大延迟 15 分钟
+		if delay > 15*time.Minute {
+			delay = 15 * time.Minute
+		}
+		input.DelaySeconds = int32(delay.Seconds())
+	}
+
+	result, err := q.sqsClient.SendMessage(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("发送消息到SQS失败: %w", err)
+	}
+	return aws.ToString(result.MessageId), nil
+}
+
+// Receive 接收消息
+func (q *SQSQueue) Receive(ctx context.Context, maxMessages int, waitTime, visibilityTimeout time.Duration) ([]RawMessage, error) {
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(q.queueURL),
+		MaxNumberOfMessages:   int32(maxMessages),
+		WaitTimeSeconds:       int32(waitTime.Seconds()),
+		MessageAttributeNames: []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+			types.MessageSystemAttributeNameSentTimestamp,
+		},
+	}
+	if visibilityTimeout > 0 {
+		input.VisibilityTimeout = int32(visibilityTimeout.Seconds())
+	}
+
+	result, err := q.sqsClient.ReceiveMessage(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("从SQS接收消息失败: %w", err)
+	}
+
+	messages := make([]RawMessage, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		raw := RawMessage{
+			MessageID:     aws.ToString(msg.MessageId),
+			ReceiptHandle: aws.ToString(msg.ReceiptHandle),
+			Body:          aws.ToString(msg.Body),
+			Attributes:    make(map[string]string),
+		}
+		for name, attr := range msg.MessageAttributes {
+			if attr.StringValue != nil {
+				raw.Attributes[name] = *attr.StringValue
+			}
+		}
+		if val, ok := msg.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]; ok {
+			raw.ReceiveCount, _ = strconv.Atoi(val)
+		}
+		if val, ok := msg.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)]; ok {
+			if ms, err := strconv.ParseInt(val, 10, 64); err == nil {
+				raw.SentAt = time.UnixMilli(ms)
+			}
+		}
+		messages = append(messages, raw)
+	}
+
+	return messages, nil
+}
+
+// Delete 删除消息
+func (q *SQSQueue) Delete(ctx context.Context, receiptHandle string) error {
+	_, err := q.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	if err != nil {
+		return fmt.Errorf("删除SQS消息失败: %w", err)
+	}
+	return nil
+}
+
+// ChangeVisibility 修改消息可见性超时
+func (q *SQSQueue) ChangeVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	_, err := q.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.queueURL),
+		ReceiptHandle:     aws.String(receiptHandle),
+		VisibilityTimeout: int32(timeout.Seconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("修改SQS消息可见性失败: %w", err)
+	}
+	return nil
+}
+
+// Attributes 获取队列统计信息
+func (q *SQSQueue) Attributes(ctx context.Context) (*Stats, error) {
+	result, err := q.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(q.queueURL),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取队列属性失败: %w", err)
+	}
+
+	stats := &Stats{}
+	if val, ok := result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)]; ok {
+		stats.Visible, _ = strconv.Atoi(val)
+	}
+	if val, ok := result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)]; ok {
+		stats.InFlight, _ = strconv.Atoi(val)
+	}
+	if val, ok := result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesDelayed)]; ok {
+		stats.Delayed, _ = strconv.Atoi(val)
+	}
+	return stats, nil
+}
+
+// Purge 清空队列
+func (q *SQSQueue) Purge(ctx context.Context) error {
+	_, err := q.sqsClient.PurgeQueue(ctx, &sqs.PurgeQueueInput{
+		QueueUrl: aws.String(q.queueURL),
+	})
+	if err != nil {
+		return fmt.Errorf("清空队列失败: %w", err)
+	}
+	return nil
+}
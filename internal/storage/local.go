@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStorage 基于本地文件系统的存储实现
+// 目录结构: <root>/<bucket>/<key>，适合单机部署和测试
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage 创建本地文件系统存储
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("本地存储根目录不能为空")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("解析本地存储目录失败: %w", err)
+	}
+	if err := os.MkdirAll(absRoot, 0755); err != nil {
+		return nil, fmt.Errorf("创建本地存储目录失败: %w", err)
+	}
+	return &LocalStorage{root: absRoot}, nil
+}
+
+// Backend 返回后端类型
+func (l *LocalStorage) Backend() string {
+	return BackendLocal
+}
+
+// objectPath 计算对象的本地路径，防止 key 中的 .. 跳出桶目录
+func (l *LocalStorage) objectPath(bucket, key string) (string, error) {
+	if bucket == "" || key == "" {
+		return "", fmt.Errorf("bucket 和 key 不能为空")
+	}
+	bucketDir := filepath.Join(l.root, filepath.Clean("/"+bucket))
+	path := filepath.Join(bucketDir, filepath.Clean("/"+key))
+	if !strings.HasPrefix(path, bucketDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("非法的对象路径: %s/%s", bucket, key)
+	}
+	return path, nil
+}
+
+// Get 获取对象内容
+func (l *LocalStorage) Get(ctx context.Context, bucket, key string) (io.ReadCloser, *ObjectInfo, error) {
+	path, err := l.objectPath(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+		}
+		return nil, nil, fmt.Errorf("打开本地对象失败: %w", err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("获取本地对象信息失败: %w", err)
+	}
+
+	return file, fileObjectInfo(bucket, key, stat), nil
+}
+
+// Put 写入对象（先写临时文件再重命名，保证读者看不到半个文件）
+func (l *LocalStorage) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	path, err := l.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建对象目录失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入本地对象失败: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("写入本地对象失败: 期望 %d 字节，实际 %d 字节", size, written)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("保存本地对象失败: %w", err)
+	}
+	return nil
+}
+
+// Head 获取对象元信息
+func (l *LocalStorage) Head(ctx context.Context, bucket, key string) (*ObjectInfo, error) {
+	path, err := l.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+		}
+		return nil, fmt.Errorf("获取本地对象信息失败: %w", err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, key)
+	}
+
+	return fileObjectInfo(bucket, key, stat), nil
+}
+
+// List 列出指定前缀下的所有对象（按 key 排序，与 S3 一致）
+func (l *LocalStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	bucketDir := filepath.Join(l.root, filepath.Clean("/"+bucket))
+	var objects []ObjectInfo
+
+	err := filepath.WalkDir(bucketDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(bucketDir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *fileObjectInfo(bucket, key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出本地对象失败: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete 删除对象（对象不存在时不报错，与 S3 一致）
+func (l *LocalStorage) Delete(ctx context.Context, bucket, key string) error {
+	path, err := l.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除本地对象失败: %w", err)
+	}
+	return nil
+}
+
+// fileObjectInfo 根据文件信息构造对象元信息
+// ETag 使用修改时间和大小拼接，避免为计算 MD5 读取整个文件
+func fileObjectInfo(bucket, key string, stat os.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Bucket:       bucket,
+		Key:          key,
+		Size:         stat.Size(),
+		ETag:         fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+		ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+		LastModified: stat.ModTime(),
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Storage 基于 AWS S3 的存储实现
+type S3Storage struct {
+	s3Client *s3.Client
+}
+
+// NewS3Storage 创建 S3 存储
+func NewS3Storage(s3Client *s3.Client) *S3Storage {
+	return &S3Storage{s3Client: s3Client}
+}
+
+// Backend 返回后端类型
+func (s *S3Storage) Backend() string {
+	return BackendS3
+}
+
+// Get 获取对象内容
+func (s *S3Storage) Get(ctx context.Context, bucket, key string) (io.ReadCloser, *ObjectInfo, error) {
+	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, wrapS3Error(err, bucket, key)
+	}
+
+	info := &ObjectInfo{
+		Bucket:      bucket,
+		Key:         key,
+		Size:        aws.ToInt64(result.ContentLength),
+		ETag:        strings.Trim(aws.ToString(result.ETag), `"`),
+		ContentType: aws.ToString(result.ContentType),
+	}
+	if result.LastModified != nil {
+		info.LastModified = *result.LastModified
+	}
+	return result.Body, info, nil
+}
+
+// Put 上传对象
+func (s *S3Storage) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if size >= 0 {
+		input.ContentLength = aws.Int64(size)
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	if _, err := s.s3Client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("S3上传失败: %w", err)
+	}
+	return nil
+}
+
+// Head 获取对象元信息
+func (s *S3Storage) Head(ctx context.Context, bucket, key string) (*ObjectInfo, error) {
+	result, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapS3Error(err, bucket, key)
+	}
+
+	info := &ObjectInfo{
+		Bucket:      bucket,
+		Key:         key,
+		Size:        aws.ToInt64(result.ContentLength),
+		ETag:        strings.Trim(aws.ToString(result.ETag), `"`),
+		ContentType: aws.ToString(result.ContentType),
+	}
+	if result.LastModified != nil {
+		info.LastModified = *result.LastModified
+	}
+	return info, nil
+}
+
+// List 列出指定前缀下的所有对象
+func (s *S3Storage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("列出S3对象失败: %w", err)
+		}
+		for _, obj := range page.Contents {
+			info := ObjectInfo{
+				Bucket: bucket,
+				Key:    aws.ToString(obj.Key),
+				Size:   aws.ToInt64(obj.Size),
+				ETag:   strings.Trim(aws.ToString(obj.ETag), `"`),
+			}
+			if obj.LastModified != nil {
+				info.LastModified = *obj.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+
+	return objects, nil
+}
+
+// Delete 删除对象
+func (s *S3Storage) Delete(ctx context.Context, bucket, key string) error {
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("删除S3对象失败: %w", err)
+	}
+	return nil
+}
+
+// wrapS3Error 将 S3 的 NoSuchKey / NotFound 转换为 ErrNotFound
+func wrapS3Error(err error, bucket, key string) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%w: s3://%s/%s", ErrNotFound, bucket, key)
+	}
+	return fmt.Errorf("从S3获取对象失败: %w", err)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// 存储后端类型
+const (
+	BackendS3    = "s3"    // AWS S3（默认）
+	BackendLocal = "local" // 本地文件系统
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("对象不存在")
+
+// ObjectInfo 对象元信息
+type ObjectInfo struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Storage 对象存储接口，屏蔽 S3 / 本地磁盘等具体实现
+// Get 返回的 Body 由调用方负责关闭；Put 的 size 未知时传 -1
+type Storage interface {
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, *ObjectInfo, error)
+	Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error
+	Head(ctx context.Context, bucket, key string) (*ObjectInfo, error)
+	List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	Delete(ctx context.Context, bucket, key string) error
+	// Backend 返回后端类型，用于日志展示
+	Backend() string
+}
+
+// New 根据后端类型创建存储实现
+func New(backend, localRoot string, s3Client *s3.Client) (Storage, error) {
+	switch backend {
+	case "", BackendS3:
+		if s3Client == nil {
+			return nil, fmt.Errorf("S3 存储需要 S3 客户端")
+		}
+		return NewS3Storage(s3Client), nil
+	case BackendLocal:
+		return NewLocalStorage(localRoot)
+	default:
+		return nil, fmt.Errorf("未知的存储后端: %s", backend)
+	}
+}
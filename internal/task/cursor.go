@@ -0,0 +1,122 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// dateLayout 日期分区格式
+	dateLayout = "2006-01-02"
+	// DefaultListDays 未指定状态和日期时，列表默认查询最近的天数
+	DefaultListDays = 30
+	// MaxListDays 单次日期范围查询最多跨越的天数
+	MaxListDays = 366
+	// DefaultListLimit 未指定（limit <= 0）时每页返回的任务数
+	DefaultListLimit = 10
+)
+
+var (
+	// ErrInvalidCursor 分页游标无效（格式错误或与查询条件不匹配）
+	ErrInvalidCursor = errors.New("无效的分页游标")
+	// ErrInvalidFilter 查询条件无效（日期格式错误、范围过大等）
+	ErrInvalidFilter = errors.New("无效的查询条件")
+)
+
+// TaskPage 一页任务
+type TaskPage struct {
+	Tasks      []TranscodeTask
+	NextCursor string // 为空表示没有更多数据
+}
+
+// listCursor 分页游标内容，对客户端不透明
+// DynamoDB 使用 Date + Key（LastEvaluatedKey），SQLite 使用 CreatedAt + TaskID
+type listCursor struct {
+	Filter    string            `json:"f"`
+	Date      string            `json:"d,omitempty"`
+	Key       map[string]string `json:"k,omitempty"`
+	CreatedAt int64             `json:"c,omitempty"`
+	TaskID    string            `json:"t,omitempty"`
+}
+
+// encodeCursor 将游标编码为 URL 安全的字符串
+func encodeCursor(filter TaskFilter, cursor *listCursor) string {
+	cursor.Filter = filter.fingerprint()
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解析游标，空字符串返回 nil（第一页）
+func decodeCursor(filter TaskFilter, value string) (*listCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Filter != filter.fingerprint() {
+		return nil, fmt.Errorf("%w: 查询条件已变化", ErrInvalidCursor)
+	}
+	return &cursor, nil
+}
+
+// fingerprint 过滤条件摘要，用于校验游标与查询条件是否匹配
+func (f TaskFilter) fingerprint() string {
+	from, to, _ := f.dateRange()
+	return strings.Join([]string{f.Status, from, to, f.KeyPrefix, f.TranscodeType, f.CreatedBy, f.ErrorStage}, "|")
+}
+
+// dateRange 返回日期范围（含两端），未指定日期时 ok 为 false
+func (f TaskFilter) dateRange() (from, to string, ok bool) {
+	if f.Date != "" {
+		return f.Date, f.Date, true
+	}
+	if f.DateFrom == "" && f.DateTo == "" {
+		return "", "", false
+	}
+	from, to = f.DateFrom, f.DateTo
+	if to == "" {
+		to = time.Now().Format(dateLayout)
+	}
+	if from == "" {
+		from = to
+	}
+	return from, to, true
+}
+
+// datePartitions 按倒序返回日期范围内的所有日期分区
+func (f TaskFilter) datePartitions() ([]string, error) {
+	fromStr, toStr, ok := f.dateRange()
+	if !ok {
+		return nil, nil
+	}
+	from, err := time.Parse(dateLayout, fromStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的开始日期 %s", ErrInvalidFilter, fromStr)
+	}
+	to, err := time.Parse(dateLayout, toStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的结束日期 %s", ErrInvalidFilter, toStr)
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: 开始日期 %s 晚于结束日期 %s", ErrInvalidFilter, fromStr, toStr)
+	}
+
+	var dates []string
+	for day := to; !day.Before(from); day = day.AddDate(0, 0, -1) {
+		if len(dates) >= MaxListDays {
+			return nil, fmt.Errorf("%w: 日期范围不能超过 %d 天", ErrInvalidFilter, MaxListDays)
+		}
+		dates = append(dates, day.Format(dateLayout))
+	}
+	return dates, nil
+}
@@ -0,0 +1,789 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// DynamoStore 基于 DynamoDB 的任务存储
+// 依赖 date-index (date_partition + created_at) 和 status-index (status + created_at) 两个 GSI
+type DynamoStore struct {
+	dynamoClient *dynamodb.Client
+	tableName    string
+}
+
+// NewDynamoStore 创建 DynamoDB 任务存储
+func NewDynamoStore(dynamoClient *dynamodb.Client, tableName string) *DynamoStore {
+	return &DynamoStore{
+		dynamoClient: dynamoClient,
+		tableName:    tableName,
+	}
+}
+
+// Backend 返回后端类型
+func (s *DynamoStore) Backend() string {
+	return StoreBackendDynamoDB
+}
+
+// CreateTask 创建任务（task_id 已存在时失败）
+func (s *DynamoStore) CreateTask(ctx context.Context, task *TranscodeTask) error {
+	item, err := attributevalue.MarshalMap(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	_, err = s.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(task_id)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return fmt.Errorf("%w: %s", ErrTaskExists, task.TaskID)
+		}
+		return fmt.Errorf("保存任务到DynamoDB失败: %w", err)
+	}
+
+	return nil
+}
+
+// SaveTask 保存任务到DynamoDB
+func (s *DynamoStore) SaveTask(ctx context.Context, task *TranscodeTask) error {
+	item, err := attributevalue.MarshalMap(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	_, err = s.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+
+	if err != nil {
+		return fmt.Errorf("保存任务到DynamoDB失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetTask 根据ID获取任务
+func (s *DynamoStore) GetTask(ctx context.Context, taskID string) (*TranscodeTask, error) {
+	result, err := s.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"task_id": &types.AttributeValueMemberS{Value: taskID},
+		},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("从DynamoDB获取任务失败: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, notFoundError(taskID)
+	}
+
+	var task TranscodeTask
+	if err := attributevalue.UnmarshalMap(result.Item, &task); err != nil {
+		return nil, fmt.Errorf("反序列化任务失败: %w", err)
+	}
+
+	return &task, nil
+}
+
+// ClaimIdempotencyKey 登记幂等键，键不存在或已过期时登记为 taskID，返回键当前对应的任务ID
+// 幂等键保存在 <表名>-idempotency 表中，expires_at 为 Unix 秒，可配置为该表的 TTL 属性自动清理过期记录
+func (s *DynamoStore) ClaimIdempotencyKey(ctx context.Context, key, taskID string, expiresAt time.Time) (string, error) {
+	_, err := s.dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName + "-idempotency"),
+		Item: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+			"task_id":         &types.AttributeValueMemberS{Value: taskID},
+			"expires_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(idempotency_key) OR expires_at <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err == nil {
+		return taskID, nil
+	}
+
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		if existing, ok := condErr.Item["task_id"].(*types.AttributeValueMemberS); ok {
+			return existing.Value, nil
+		}
+	}
+	return "", fmt.Errorf("登记幂等键失败: %w", err)
+}
+
+// UpdateTask 字段级条件更新（UpdateItem），返回更新后的任务
+// 进度和输出文件按 map 的单个键更新（SET progress.#t = :v），不会覆盖其他字段
+func (s *DynamoStore) UpdateTask(ctx context.Context, taskID string, update *TaskUpdate) (*TranscodeTask, error) {
+	expr, err := buildDynamoUpdate(update, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"task_id": &types.AttributeValueMemberS{Value: taskID},
+		},
+		UpdateExpression:                    aws.String(expr.updateExpression()),
+		ConditionExpression:                 aws.String(strings.Join(expr.conditions, " AND ")),
+		ExpressionAttributeNames:            expr.names,
+		ExpressionAttributeValues:           expr.values,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	result, err := s.dynamoClient.UpdateItem(ctx, input)
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			if len(condErr.Item) == 0 {
+				return nil, notFoundError(taskID)
+			}
+			var current TranscodeTask
+			if err := attributevalue.UnmarshalMap(condErr.Item, &current); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrConditionFailed, taskID)
+			}
+			if err := update.checkCondition(&current); err != nil {
+				return nil, err
+			}
+			// 返回的旧值必然不满足条件，这里仅作兜底
+			return nil, conflictError(&current, 0)
+		}
+		return nil, fmt.Errorf("更新DynamoDB任务失败: %w", err)
+	}
+
+	var task TranscodeTask
+	if err := attributevalue.UnmarshalMap(result.Attributes, &task); err != nil {
+		return nil, fmt.Errorf("反序列化任务失败: %w", err)
+	}
+	return &task, nil
+}
+
+// dynamoUpdate UpdateItem 表达式构造器
+type dynamoUpdate struct {
+	sets       []string
+	adds       []string
+	removes    []string
+	conditions []string
+	names      map[string]string
+	values     map[string]types.AttributeValue
+}
+
+// value 注册表达式值并返回占位符
+func (u *dynamoUpdate) value(v any) (string, error) {
+	av, err := attributevalue.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("序列化更新字段失败: %w", err)
+	}
+	return u.attributeValue(av), nil
+}
+
+// attributeValue 注册已构造好的表达式值并返回占位符
+func (u *dynamoUpdate) attributeValue(av types.AttributeValue) string {
+	placeholder := fmt.Sprintf(":v%d", len(u.values))
+	u.values[placeholder] = av
+	return placeholder
+}
+
+// name 注册属性名并返回占位符
+func (u *dynamoUpdate) name(attr string) string {
+	placeholder := fmt.Sprintf("#n%d", len(u.names))
+	u.names[placeholder] = attr
+	return placeholder
+}
+
+// set 添加 SET 子句
+func (u *dynamoUpdate) set(path string, v any) error {
+	placeholder, err := u.value(v)
+	if err != nil {
+		return err
+	}
+	u.sets = append(u.sets, path+" = "+placeholder)
+	return nil
+}
+
+// setMapEntries 逐个更新 map 属性中的键
+func setMapEntries[V any](u *dynamoUpdate, attr string, entries map[string]V) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	attrName := u.name(attr)
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := u.set(attrName+"."+u.name(key), entries[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateExpression 拼接最终的更新表达式
+func (u *dynamoUpdate) updateExpression() string {
+	expr := "SET " + strings.Join(u.sets, ", ")
+	if len(u.adds) > 0 {
+		expr += " ADD " + strings.Join(u.adds, ", ")
+	}
+	if len(u.removes) > 0 {
+		expr += " REMOVE " + strings.Join(u.removes, ", ")
+	}
+	return expr
+}
+
+// buildDynamoUpdate 将 TaskUpdate 转换为 UpdateItem 表达式
+func buildDynamoUpdate(update *TaskUpdate, now time.Time) (*dynamoUpdate, error) {
+	expr := &dynamoUpdate{
+		conditions: []string{"attribute_exists(task_id)"},
+		names:      make(map[string]string),
+		values:     make(map[string]types.AttributeValue),
+	}
+
+	if err := expr.set(expr.name("updated_at"), now); err != nil {
+		return nil, err
+	}
+
+	// 版本号加一（兼容没有 version 属性的旧任务）
+	version := expr.name("version")
+	zero, err := expr.value(0)
+	if err != nil {
+		return nil, err
+	}
+	one, err := expr.value(1)
+	if err != nil {
+		return nil, err
+	}
+	expr.sets = append(expr.sets, fmt.Sprintf("%s = if_not_exists(%s, %s) + %s", version, version, zero, one))
+	if update.ExpectVersion != nil {
+		expected, err := expr.value(*update.ExpectVersion)
+		if err != nil {
+			return nil, err
+		}
+		if *update.ExpectVersion == 0 {
+			expr.conditions = append(expr.conditions, fmt.Sprintf("(attribute_not_exists(%s) OR %s = %s)", version, version, expected))
+		} else {
+			expr.conditions = append(expr.conditions, fmt.Sprintf("%s = %s", version, expected))
+		}
+	}
+
+	if update.Status != nil {
+		if err := expr.set(expr.name("status"), *update.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.ErrorMessage != nil {
+		if *update.ErrorMessage == "" {
+			expr.removes = append(expr.removes, expr.name("error_message"))
+		} else if err := expr.set(expr.name("error_message"), *update.ErrorMessage); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.MessageID != nil {
+		if err := expr.set(expr.name("message_id"), *update.MessageID); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.MediaInfo != nil {
+		if err := expr.set(expr.name("media_info"), update.MediaInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.ClearTimes {
+		if update.StartedAt == nil {
+			expr.removes = append(expr.removes, expr.name("started_at"))
+		}
+		if update.CompletedAt == nil {
+			expr.removes = append(expr.removes, expr.name("completed_at"))
+		}
+	}
+	if update.StartedAt != nil {
+		startedAt := expr.name("started_at")
+		placeholder, err := expr.value(*update.StartedAt)
+		if err != nil {
+			return nil, err
+		}
+		if update.KeepStartedAt && !update.ClearTimes {
+			expr.sets = append(expr.sets, fmt.Sprintf("%s = if_not_exists(%s, %s)", startedAt, startedAt, placeholder))
+		} else {
+			expr.sets = append(expr.sets, startedAt+" = "+placeholder)
+		}
+	}
+	if update.CompletedAt != nil {
+		if err := expr.set(expr.name("completed_at"), *update.CompletedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setMapEntries(expr, "progress", update.Progress); err != nil {
+		return nil, err
+	}
+
+	// 重置时整体写入（可能为空 map），保证属性存在，之后的实时进度只写入嵌套路径
+	if update.ResetProgressDetails {
+		progressDetails := make(map[string]ProgressDetail, len(update.ProgressDetails))
+		for transcodeType, detail := range update.ProgressDetails {
+			progressDetails[transcodeType] = detail
+		}
+		if err := expr.set(expr.name("progress_details"), progressDetails); err != nil {
+			return nil, err
+		}
+	} else if err := setMapEntries(expr, "progress_details", update.ProgressDetails); err != nil {
+		return nil, err
+	}
+
+	// 同一表达式中不能既整体覆盖 map 又修改其中的键，重置时直接写入完整 map
+	if update.ResetOutputFiles {
+		outputFiles := make(map[string]string, len(update.OutputFiles))
+		for transcodeType, outputKey := range update.OutputFiles {
+			outputFiles[transcodeType] = outputKey
+		}
+		if err := expr.set(expr.name("output_files"), outputFiles); err != nil {
+			return nil, err
+		}
+	} else if err := setMapEntries(expr, "output_files", update.OutputFiles); err != nil {
+		return nil, err
+	}
+
+	// 只在需要时注册属性名，DynamoDB 不允许表达式中存在未使用的属性名
+	if update.ClearErrorDetails || len(update.AppendErrors) > 0 {
+		errorDetails := expr.name("error_details")
+		switch {
+		case update.ClearErrorDetails && len(update.AppendErrors) > 0:
+			if err := expr.set(errorDetails, update.AppendErrors); err != nil {
+				return nil, err
+			}
+		case update.ClearErrorDetails:
+			expr.removes = append(expr.removes, errorDetails)
+		case len(update.AppendErrors) > 0:
+			appended, err := expr.value(update.AppendErrors)
+			if err != nil {
+				return nil, err
+			}
+			empty, err := expr.value([]ErrorDetail{})
+			if err != nil {
+				return nil, err
+			}
+			expr.sets = append(expr.sets, fmt.Sprintf("%s = list_append(if_not_exists(%s, %s), %s)", errorDetails, errorDetails, empty, appended))
+		}
+	}
+
+	// 出错阶段集合：追加时用 ADD 合并到字符串集合
+	if stages := update.errorStages(); len(stages) > 0 || update.ClearErrorDetails {
+		errorStages := expr.name("error_stages")
+		switch {
+		case len(stages) == 0:
+			expr.removes = append(expr.removes, errorStages)
+		case update.ClearErrorDetails:
+			placeholder := expr.attributeValue(&types.AttributeValueMemberSS{Value: stages})
+			expr.sets = append(expr.sets, errorStages+" = "+placeholder)
+		default:
+			placeholder := expr.attributeValue(&types.AttributeValueMemberSS{Value: stages})
+			expr.adds = append(expr.adds, errorStages+" "+placeholder)
+		}
+	}
+
+	if update.ResetRetryCount {
+		expr.sets = append(expr.sets, expr.name("retry_count")+" = "+zero)
+	} else if update.IncrementRetry {
+		retryCount := expr.name("retry_count")
+		expr.sets = append(expr.sets, fmt.Sprintf("%s = %s + %s", retryCount, retryCount, one))
+	}
+
+	if len(update.ExpectStatus) > 0 {
+		placeholders := make([]string, 0, len(update.ExpectStatus))
+		for _, status := range update.ExpectStatus {
+			placeholder, err := expr.value(status)
+			if err != nil {
+				return nil, err
+			}
+			placeholders = append(placeholders, placeholder)
+		}
+		expr.conditions = append(expr.conditions, fmt.Sprintf("%s IN (%s)", expr.name("status"), strings.Join(placeholders, ", ")))
+	}
+
+	return expr, nil
+}
+
+// ListTasks 获取一页任务
+// 有日期范围时按日期倒序逐个查询 date-index 分区，只有状态时查询 status-index，其余条件作为过滤表达式；
+// 游标记录当前日期分区和 LastEvaluatedKey，翻页不需要重新读取前面的数据
+func (s *DynamoStore) ListTasks(ctx context.Context, filter TaskFilter, limit int, cursorValue string) (*TaskPage, error) {
+	dates, err := filter.datePartitions()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(filter, cursorValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	var startKey map[string]types.AttributeValue
+	if cursor != nil && cursor.Key != nil {
+		startKey = decodeDynamoKey(cursor.Key)
+	}
+
+	if len(dates) > 0 {
+		// 有日期，使用 date-index GSI
+		return s.listTasksByDates(ctx, filter, dates, limit, cursor, startKey)
+	}
+
+	// 有状态但没日期使用 status-index GSI；没有任何索引条件时只能 Scan，结果顺序不保证
+	// （Manager 在没有状态和日期时会补上最近日期范围）
+	query := s.taskQuery(filter, "")
+	tasks, lastKey, err := query.collect(ctx, s.dynamoClient, limit, startKey)
+	if s.statusIndexMissing(query, err) {
+		tasks, lastKey, err = s.buildTaskQuery(filter, "", false).collect(ctx, s.dynamoClient, limit, startKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.page(filter, tasks, "", lastKey)
+}
+
+// listTasksByDates 按日期分区倒序查询，当前分区读完后继续下一个分区
+func (s *DynamoStore) listTasksByDates(ctx context.Context, filter TaskFilter, dates []string, limit int, cursor *listCursor, startKey map[string]types.AttributeValue) (*TaskPage, error) {
+	startIndex := 0
+	if cursor != nil {
+		startIndex = -1
+		for i, date := range dates {
+			if date == cursor.Date {
+				startIndex = i
+				break
+			}
+		}
+		if startIndex < 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	tasks := []TranscodeTask{}
+	for i := startIndex; i < len(dates); i++ {
+		query := s.taskQuery(filter, dates[i])
+		dateTasks, lastKey, err := query.collect(ctx, s.dynamoClient, limit-len(tasks), startKey)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, dateTasks...)
+		startKey = nil
+
+		if lastKey != nil {
+			// 当前分区还有数据
+			return s.page(filter, tasks, dates[i], lastKey)
+		}
+		if len(tasks) >= limit {
+			// 页已满，下一页从下一个分区开始
+			if i+1 < len(dates) {
+				return &TaskPage{Tasks: tasks, NextCursor: encodeCursor(filter, &listCursor{Date: dates[i+1]})}, nil
+			}
+			break
+		}
+	}
+	return &TaskPage{Tasks: tasks}, nil
+}
+
+// page 根据 LastEvaluatedKey 构造分页结果
+func (s *DynamoStore) page(filter TaskFilter, tasks []TranscodeTask, date string, lastKey map[string]types.AttributeValue) (*TaskPage, error) {
+	page := &TaskPage{Tasks: tasks}
+	if lastKey != nil {
+		key, err := encodeDynamoKey(lastKey)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = encodeCursor(filter, &listCursor{Date: date, Key: key})
+	}
+	return page, nil
+}
+
+// encodeDynamoKey 将 LastEvaluatedKey 转换为可序列化的形式（表和索引的键均为字符串）
+func encodeDynamoKey(key map[string]types.AttributeValue) (map[string]string, error) {
+	encoded := make(map[string]string, len(key))
+	for name, value := range key {
+		str, ok := value.(*types.AttributeValueMemberS)
+		if !ok {
+			return nil, fmt.Errorf("不支持的分页键类型: %s", name)
+		}
+		encoded[name] = str.Value
+	}
+	return encoded, nil
+}
+
+// decodeDynamoKey 将游标中的键还原为 ExclusiveStartKey
+func decodeDynamoKey(key map[string]string) map[string]types.AttributeValue {
+	decoded := make(map[string]types.AttributeValue, len(key))
+	for name, value := range key {
+		decoded[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return decoded
+}
+
+// dynamoPageSize 列表查询每次请求读取的条数
+// 有过滤条件时每次读取的记录大多被过滤掉，固定读取一批，避免选择性强的查询拆成大量小请求
+const dynamoPageSize = 100
+
+// dynamoTaskQuery 任务列表的一次 Query（走 GSI）或 Scan
+type dynamoTaskQuery struct {
+	query *dynamodb.QueryInput
+	scan  *dynamodb.ScanInput
+	// keyAttributes 分页键包含的属性：表主键，走 GSI 时还有索引键
+	keyAttributes []string
+}
+
+// taskQuery 根据过滤条件构造查询
+// date 不为空时查询 date-index 的该分区；否则有状态时查询 status-index，都没有时 Scan
+func (s *DynamoStore) taskQuery(filter TaskFilter, date string) *dynamoTaskQuery {
+	return s.buildTaskQuery(filter, date, true)
+}
+
+// buildTaskQuery 构造查询，不属于索引键的条件都放入 FilterExpression；
+// useStatusIndex 为 false 时状态也作为过滤条件（status-index 不可用时回退 Scan）
+func (s *DynamoStore) buildTaskQuery(filter TaskFilter, date string, useStatusIndex bool) *dynamoTaskQuery {
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	var filters []string
+
+	str := func(v string) *types.AttributeValueMemberS {
+		return &types.AttributeValueMemberS{Value: v}
+	}
+
+	var indexName, keyCondition string
+	switch {
+	case date != "":
+		indexName = "date-index"
+		keyCondition = "date_partition = :date"
+		values[":date"] = str(date)
+		if filter.Status != "" {
+			filters = append(filters, "#status = :status")
+		}
+	case filter.Status != "" && useStatusIndex:
+		indexName = "status-index"
+		keyCondition = "#status = :status"
+	default:
+		if filter.Status != "" {
+			filters = append(filters, "#status = :status")
+		}
+	}
+	if filter.Status != "" {
+		names["#status"] = "status"
+		values[":status"] = str(filter.Status)
+	}
+
+	if filter.KeyPrefix != "" {
+		filters = append(filters, "begins_with(input_key, :key_prefix)")
+		values[":key_prefix"] = str(filter.KeyPrefix)
+	}
+	if filter.TranscodeType != "" {
+		filters = append(filters, "contains(transcode_types, :transcode_type)")
+		values[":transcode_type"] = str(filter.TranscodeType)
+	}
+	if filter.CreatedBy != "" {
+		filters = append(filters, "created_by = :created_by")
+		values[":created_by"] = str(filter.CreatedBy)
+	}
+	if filter.ErrorStage != "" {
+		filters = append(filters, "contains(error_stages, :error_stage)")
+		values[":error_stage"] = str(filter.ErrorStage)
+	}
+
+	var filterExpression *string
+	if len(filters) > 0 {
+		filterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	if len(names) == 0 {
+		names = nil
+	}
+	if len(values) == 0 {
+		values = nil
+	}
+
+	if indexName == "" {
+		return &dynamoTaskQuery{scan: &dynamodb.ScanInput{
+			TableName:                 aws.String(s.tableName),
+			FilterExpression:          filterExpression,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}, keyAttributes: []string{"task_id"}}
+	}
+	indexKey := "date_partition"
+	if indexName == "status-index" {
+		indexKey = "status"
+	}
+	return &dynamoTaskQuery{keyAttributes: []string{"task_id", indexKey, "created_at"}, query: &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		IndexName:                 aws.String(indexName),
+		KeyConditionExpression:    aws.String(keyCondition),
+		FilterExpression:          filterExpression,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+	}}
+}
+
+// statusIndexMissing 判断 status-index 查询是否因表上没有该 GSI 而失败，是则需要回退到 Scan
+// ListTasks 和 CountTasks 共用该判断，保证同一过滤条件的列表和总数走同样的读取方式；
+// 限流等其他错误直接返回，不回退
+func (s *DynamoStore) statusIndexMissing(query *dynamoTaskQuery, err error) bool {
+	if err == nil || query.query == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ValidationException" || !strings.Contains(apiErr.ErrorMessage(), "index") {
+		return false
+	}
+	log.Printf("⚠️  status-index GSI 不可用，回退到 Scan: %v", err)
+	return true
+}
+
+// fetch 执行一次请求，limit 为 0 表示不限制
+func (q *dynamoTaskQuery) fetch(ctx context.Context, client *dynamodb.Client, limit int32, startKey map[string]types.AttributeValue) ([]map[string]types.AttributeValue, int32, map[string]types.AttributeValue, error) {
+	var pageLimit *int32
+	if limit > 0 {
+		pageLimit = aws.Int32(limit)
+	}
+
+	if q.scan != nil {
+		q.scan.Limit = pageLimit
+		q.scan.ExclusiveStartKey = startKey
+		result, err := client.Scan(ctx, q.scan)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("扫描任务失败: %w", err)
+		}
+		return result.Items, result.Count, result.LastEvaluatedKey, nil
+	}
+
+	q.query.Limit = pageLimit
+	q.query.ExclusiveStartKey = startKey
+	result, err := client.Query(ctx, q.query)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	return result.Items, result.Count, result.LastEvaluatedKey, nil
+}
+
+// collect 分批读取直到凑满 limit 条或数据读完
+// 每批固定读取 dynamoPageSize 条，凑满时本批还有剩余记录的，以最后一条已返回记录的键作为下一页的起点
+func (q *dynamoTaskQuery) collect(ctx context.Context, client *dynamodb.Client, limit int, startKey map[string]types.AttributeValue) ([]TranscodeTask, map[string]types.AttributeValue, error) {
+	tasks := []TranscodeTask{}
+	key := startKey
+	for len(tasks) < limit {
+		items, _, lastKey, err := q.fetch(ctx, client, dynamoPageSize, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, item := range items {
+			var task TranscodeTask
+			if err := attributevalue.UnmarshalMap(item, &task); err != nil {
+				log.Printf("⚠️  反序列化任务失败: %v", err)
+			} else {
+				tasks = append(tasks, task)
+			}
+			if len(tasks) == limit && i < len(items)-1 {
+				return tasks, q.itemKey(item), nil
+			}
+		}
+		if lastKey == nil {
+			return tasks, nil, nil
+		}
+		key = lastKey
+	}
+	return tasks, key, nil
+}
+
+// itemKey 从记录中取出分页键
+func (q *dynamoTaskQuery) itemKey(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := make(map[string]types.AttributeValue, len(q.keyAttributes))
+	for _, name := range q.keyAttributes {
+		if value, ok := item[name]; ok {
+			key[name] = value
+		}
+	}
+	return key
+}
+
+// count 使用 SELECT COUNT 遍历统计数量
+func (q *dynamoTaskQuery) count(ctx context.Context, client *dynamodb.Client) (int, error) {
+	if q.scan != nil {
+		q.scan.Select = types.SelectCount
+	} else {
+		q.query.Select = types.SelectCount
+	}
+
+	var total int
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		_, count, lastKey, err := q.fetch(ctx, client, 0, lastEvaluatedKey)
+		if err != nil {
+			return 0, err
+		}
+		total += int(count)
+
+		if lastKey == nil {
+			break
+		}
+		lastEvaluatedKey = lastKey
+	}
+	return total, nil
+}
+
+// CountTasks 统计任务数量（使用 SELECT COUNT 统计，日期范围按分区累加）
+func (s *DynamoStore) CountTasks(ctx context.Context, filter TaskFilter) (int, error) {
+	dates, err := filter.datePartitions()
+	if err != nil {
+		return 0, err
+	}
+	if len(dates) > 0 {
+		// 有日期，使用 date-index GSI
+		total := 0
+		for _, date := range dates {
+			count, err := s.taskQuery(filter, date).count(ctx, s.dynamoClient)
+			if err != nil {
+				return 0, fmt.Errorf("统计任务失败: %w", err)
+			}
+			total += count
+		}
+		return total, nil
+	}
+
+	query := s.taskQuery(filter, "")
+	total, err := query.count(ctx, s.dynamoClient)
+	if s.statusIndexMissing(query, err) {
+		total, err = s.buildTaskQuery(filter, "", false).count(ctx, s.dynamoClient)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("统计任务失败: %w", err)
+	}
+
+	log.Printf("📊 统计任务 [%+v] 数量: %d", filter, total)
+	return total, nil
+}
@@ -0,0 +1,74 @@
+package task
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestBuildDynamoUpdateProgressDetails(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    TaskUpdate
+		wantSet   string // 期望出现的 SET 子句（属性名已展开）
+		wantEmpty bool   // 整体写入的值是否为空 map
+	}{
+		{
+			name:      "重置时写入空 map 而不是删除属性",
+			update:    TaskUpdate{ResetProgressDetails: true},
+			wantSet:   "progress_details = ",
+			wantEmpty: true,
+		},
+		{
+			name:    "重置并写入实时进度时整体写入",
+			update:  TaskUpdate{ResetProgressDetails: true, ProgressDetails: map[string]ProgressDetail{"hls": {Percent: 10}}},
+			wantSet: "progress_details = ",
+		},
+		{
+			name:    "单个类型的实时进度写入嵌套路径",
+			update:  TaskUpdate{ProgressDetails: map[string]ProgressDetail{"hls": {Percent: 10}}},
+			wantSet: "progress_details.hls = ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := buildDynamoUpdate(&tt.update, time.Now())
+			if err != nil {
+				t.Fatalf("buildDynamoUpdate() error = %v", err)
+			}
+			var matched string
+			for _, set := range expr.sets {
+				if clause := expandNames(set, expr.names); strings.HasPrefix(clause, tt.wantSet) {
+					matched = set
+				}
+			}
+			if matched == "" {
+				t.Fatalf("SET 子句 %v 中没有 %q", expr.sets, tt.wantSet)
+			}
+			if tt.wantEmpty {
+				placeholder := matched[strings.LastIndex(matched, " ")+1:]
+				value, ok := expr.values[placeholder].(*types.AttributeValueMemberM)
+				if !ok || len(value.Value) != 0 {
+					t.Errorf("progress_details 应写入空 map: %#v", expr.values[placeholder])
+				}
+			}
+			for _, remove := range expr.removes {
+				if expr.names[remove] == "progress_details" {
+					t.Errorf("不应删除 progress_details 属性: %v", expr.removes)
+				}
+			}
+		})
+	}
+}
+
+// expandNames 将表达式中的属性名占位符替换为属性名
+func expandNames(clause string, names map[string]string) string {
+	for placeholder, name := range names {
+		clause = strings.ReplaceAll(clause, placeholder+" ", name+" ")
+		clause = strings.ReplaceAll(clause, placeholder+".", name+".")
+	}
+	return clause
+}
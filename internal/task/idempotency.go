@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultIdempotencyTTL 幂等键的默认保留时间
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// MaxIdempotencyKeyLength 幂等键的最大长度
+const MaxIdempotencyKeyLength = 255
+
+// ErrIdempotencyKeyReused 幂等键在保留期内被用于参数不同的请求
+var ErrIdempotencyKeyReused = errors.New("幂等键已用于参数不同的请求")
+
+// SetIdempotencyTTL 设置幂等键的保留时间，保留期过后同一个键会创建新任务
+func (m *Manager) SetIdempotencyTTL(ttl time.Duration) {
+	if ttl > 0 {
+		m.idempotencyTTL = ttl
+	}
+}
+
+// IdempotencyTTL 返回幂等键的保留时间
+func (m *Manager) IdempotencyTTL() time.Duration {
+	return m.idempotencyTTL
+}
+
+// CreateTaskIdempotent 按客户端提供的幂等键创建任务
+// 保留期内同一用户重复提交相同的键时返回原任务（created 为 false），参数不同时返回 ErrIdempotencyKeyReused
+func (m *Manager) CreateTaskIdempotent(idempotencyKey, inputBucket, inputKey, outputBucket string, transcodeTypes []string, createdBy, priority string) (task *TranscodeTask, created bool, err error) {
+	recordKey := idempotencyRecordKey(createdBy, idempotencyKey)
+	taskID, err := m.store.ClaimIdempotencyKey(context.TODO(), recordKey, uuid.New().String(), time.Now().Add(m.idempotencyTTL))
+	if err != nil {
+		return nil, false, fmt.Errorf("登记幂等键失败: %w", err)
+	}
+
+	existing, err := m.GetTask(taskID)
+	switch {
+	case err == nil:
+		if !sameSubmission(existing, inputBucket, inputKey, transcodeTypes, priority) {
+			return nil, false, fmt.Errorf("%w: %s", ErrIdempotencyKeyReused, idempotencyKey)
+		}
+		log.Printf("♻️  幂等键重复提交，返回原任务: %s", taskID)
+		return existing, false, nil
+	case !errors.Is(err, ErrTaskNotFound):
+		return nil, false, err
+	}
+
+	// 新登记的键，或上次请求登记后未能创建任务
+	task = newTask(taskID, inputBucket, inputKey, outputBucket, transcodeTypes, createdBy, priority)
+	task.IdempotencyKey = idempotencyKey
+	if err := m.insertTask(task); err != nil {
+		if errors.Is(err, ErrTaskExists) {
+			// 并发的相同请求先创建了任务
+			return m.CreateTaskIdempotent(idempotencyKey, inputBucket, inputKey, outputBucket, transcodeTypes, createdBy, priority)
+		}
+		return nil, false, err
+	}
+	return task, true, nil
+}
+
+// idempotencyRecordKey 幂等键按用户隔离，不同用户使用相同的键互不影响
+func idempotencyRecordKey(createdBy, idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(createdBy + "\x00" + idempotencyKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// sameSubmission 判断已有任务是否由相同参数的请求创建
+func sameSubmission(task *TranscodeTask, inputBucket, inputKey string, transcodeTypes []string, priority string) bool {
+	return task.InputBucket == inputBucket &&
+		task.InputKey == inputKey &&
+		slices.Equal(task.TranscodeTypes, transcodeTypes) &&
+		NormalizePriority(task.Priority) == NormalizePriority(priority)
+}
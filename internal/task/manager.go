@@ -2,36 +2,62 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/google/uuid"
 )
 
 type Manager struct {
-	dynamoClient *dynamodb.Client
-	tableName    string
+	store          TaskStore
+	idempotencyTTL time.Duration
 }
 
-func NewManager(dynamoClient *dynamodb.Client, tableName string) *Manager {
+func NewManager(store TaskStore) *Manager {
 	return &Manager{
-		dynamoClient: dynamoClient,
-		tableName:    tableName,
+		store:          store,
+		idempotencyTTL: DefaultIdempotencyTTL,
 	}
 }
 
-// CreateTask 创建新任务
-func (m *Manager) CreateTask(inputBucket, inputKey, outputBucket string, transcodeTypes []string) (*TranscodeTask, error) {
-	return m.CreateTaskWithID(uuid.New().String(), inputBucket, inputKey, outputBucket, transcodeTypes)
+// Backend 返回任务存储后端类型
+func (m *Manager) Backend() string {
+	return m.store.Backend()
+}
+
+// CreatorS3Event S3 事件触发的任务的创建者
+const CreatorS3Event = "s3-event"
+
+// CreateTask 创建新任务，createdBy 为创建者用户名，priority 为空时使用 normal
+func (m *Manager) CreateTask(inputBucket, inputKey, outputBucket string, transcodeTypes []string, createdBy, priority string) (*TranscodeTask, error) {
+	return m.CreateTaskWithID(uuid.New().String(), inputBucket, inputKey, outputBucket, transcodeTypes, createdBy, priority)
 }
 
 // CreateTaskWithID 使用指定ID创建任务
-func (m *Manager) CreateTaskWithID(taskID, inputBucket, inputKey, outputBucket string, transcodeTypes []string) (*TranscodeTask, error) {
+func (m *Manager) CreateTaskWithID(taskID, inputBucket, inputKey, outputBucket string, transcodeTypes []string, createdBy, priority string) (*TranscodeTask, error) {
+	task := newTask(taskID, inputBucket, inputKey, outputBucket, transcodeTypes, createdBy, priority)
+	if err := m.insertTask(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// CreateTaskFrom 按队列消息中的任务信息创建任务（S3 事件触发的任务），
+// 保留消息携带的任务ID、输出前缀和接入规则
+func (m *Manager) CreateTaskFrom(template *TranscodeTask, createdBy string) (*TranscodeTask, error) {
+	task := newTask(template.TaskID, template.InputBucket, template.InputKey, template.OutputBucket, template.TranscodeTypes, createdBy, template.Priority)
+	task.OutputPrefix = template.OutputPrefix
+	task.IngestRule = template.IngestRule
+	if err := m.insertTask(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// newTask 构造待处理的新任务
+func newTask(taskID, inputBucket, inputKey, outputBucket string, transcodeTypes []string, createdBy, priority string) *TranscodeTask {
 	now := time.Now()
 	task := &TranscodeTask{
 		TaskID:         taskID,
@@ -40,6 +66,8 @@ func (m *Manager) CreateTaskWithID(taskID, inputBucket, inputKey, outputBucket s
 		InputKey:       inputKey,
 		OutputBucket:   outputBucket,
 		TranscodeTypes: transcodeTypes,
+		CreatedBy:      createdBy,
+		Priority:       NormalizePriority(priority),
 		Status:         TaskStatusPending,
 		CreatedAt:      now,
 		UpdatedAt:      now,
@@ -47,551 +75,357 @@ func (m *Manager) CreateTaskWithID(taskID, inputBucket, inputKey, outputBucket s
 		MaxRetries:     3,
 		Progress:       make(map[string]string),
 		OutputFiles:    make(map[string]string),
+		Version:        1,
 	}
 
 	// 初始化进度
 	for _, transcodeType := range transcodeTypes {
 		task.Progress[transcodeType] = "pending"
 	}
-
-	if err := m.SaveTask(task); err != nil {
-		return nil, fmt.Errorf("保存任务失败: %v", err)
-	}
-
-	log.Printf("✅ 创建任务成功: %s", task.TaskID)
-	return task, nil
+	return task
 }
 
-// SaveTask 保存任务到DynamoDB
-func (m *Manager) SaveTask(task *TranscodeTask) error {
-	task.UpdatedAt = time.Now()
-
-	item, err := attributevalue.MarshalMap(task)
-	if err != nil {
-		return fmt.Errorf("序列化任务失败: %v", err)
-	}
-
-	_, err = m.dynamoClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(m.tableName),
-		Item:      item,
-	})
-
-	if err != nil {
-		return fmt.Errorf("保存任务到DynamoDB失败: %v", err)
+// insertTask 保存新任务，ID 已存在时返回 ErrTaskExists
+func (m *Manager) insertTask(task *TranscodeTask) error {
+	if err := m.store.CreateTask(context.TODO(), task); err != nil {
+		return fmt.Errorf("保存任务失败: %w", err)
 	}
 
+	log.Printf("✅ 创建任务成功: %s", task.TaskID)
 	return nil
 }
 
 // GetTask 根据ID获取任务
 func (m *Manager) GetTask(taskID string) (*TranscodeTask, error) {
-	result, err := m.dynamoClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String(m.tableName),
-		Key: map[string]types.AttributeValue{
-			"task_id": &types.AttributeValueMemberS{Value: taskID},
-		},
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("从DynamoDB获取任务失败: %v", err)
-	}
+	return m.store.GetTask(context.TODO(), taskID)
+}
 
-	if result.Item == nil {
-		return nil, fmt.Errorf("任务不存在: %s", taskID)
-	}
+// ListTasks 获取一页任务，cursor 为上一页返回的 NextCursor（第一页传空）
+// 未指定状态和日期时默认只查询最近 DefaultListDays 天，避免全表扫描
+func (m *Manager) ListTasks(filter TaskFilter, limit int, cursor string) (*TaskPage, error) {
+	filter = withDefaultRange(filter)
+	log.Printf("📋 ListTasks 请求: filter=%+v, limit=%d, cursor=%t", filter, limit, cursor != "")
+	return m.store.ListTasks(context.TODO(), filter, limit, cursor)
+}
 
-	var task TranscodeTask
-	if err := attributevalue.UnmarshalMap(result.Item, &task); err != nil {
-		return nil, fmt.Errorf("反序列化任务失败: %v", err)
-	}
+// CountTasks 统计符合条件的任务数量（与 ListTasks 使用相同的默认日期范围）
+func (m *Manager) CountTasks(filter TaskFilter) (int, error) {
+	return m.store.CountTasks(context.TODO(), withDefaultRange(filter))
+}
 
-	return &task, nil
+// TaskSearchResult 任务搜索结果
+type TaskSearchResult struct {
+	Tasks      []TranscodeTask
+	NextCursor string
+	Total      *int // 仅在 withCount 为 true 时统计
 }
 
-// ListTasks 获取任务列表
-// 优先使用 GSI 查询：有日期用 date-index，有状态用 status-index，都没有用 Scan
-func (m *Manager) ListTasks(status, date string, limit, offset int) ([]TranscodeTask, int, error) {
-	log.Printf("📋 ListTasks 请求: status=%q, date=%q, limit=%d, offset=%d", status, date, limit, offset)
-	
-	// 先获取总数
-	total, err := m.countTasks(status, date)
+// SearchTasks 按组合条件搜索任务（状态、日期范围、key 前缀、转码类型、创建者、出错阶段）
+// 例如最近 7 天 campaign/2026/ 下包含 hdlbr_h265 的失败任务：
+//
+//	TaskFilter{Status: "failed", DateFrom: "2026-01-08", KeyPrefix: "campaign/2026/", TranscodeType: "hdlbr_h265"}
+func (m *Manager) SearchTasks(filter TaskFilter, limit int, cursor string, withCount bool) (*TaskSearchResult, error) {
+	page, err := m.ListTasks(filter, limit, cursor)
 	if err != nil {
-		log.Printf("❌ countTasks 失败: %v", err)
-		return nil, 0, err
-	}
-	log.Printf("📊 countTasks 返回: total=%d", total)
-
-	// 如果 offset 超出范围，直接返回空
-	if offset >= total {
-		return []TranscodeTask{}, total, nil
+		return nil, err
 	}
 
-	// 获取分页数据
-	var tasks []TranscodeTask
-	if date != "" {
-		// 有日期，使用 date-index GSI
-		tasks, err = m.fetchTasksByDate(status, date, limit, offset)
-	} else if status != "" {
-		// 有状态但没日期，使用 status-index GSI（更高效）
-		tasks, err = m.fetchTasksByStatusIndex(status, limit, offset)
-	} else {
-		// 都没有，使用 Scan
-		tasks, err = m.fetchTasksByScan(status, limit, offset)
+	result := &TaskSearchResult{
+		Tasks:      page.Tasks,
+		NextCursor: page.NextCursor,
 	}
-
-	if err != nil {
-		return nil, 0, err
+	if withCount {
+		total, err := m.CountTasks(filter)
+		if err != nil {
+			return nil, err
+		}
+		result.Total = &total
 	}
-
-	return tasks, total, nil
+	return result, nil
 }
 
-// countTasks 统计任务数量（使用 SELECT COUNT 高效统计）
-func (m *Manager) countTasks(status, date string) (int, error) {
-	if date != "" {
-		// 有日期，使用 date-index GSI
-		return m.countTasksByDate(status, date)
+// withDefaultRange 没有状态和日期条件时补上最近 DefaultListDays 天的日期范围
+func withDefaultRange(filter TaskFilter) TaskFilter {
+	if filter.Status != "" {
+		return filter
 	}
-	if status != "" {
-		// 有状态但没日期，使用 status-index GSI（更高效）
-		return m.countTasksByStatusIndex(status)
+	if _, _, ok := filter.dateRange(); ok {
+		return filter
 	}
-	// 都没有，使用 Scan
-	return m.countTasksByScan(status)
+	now := time.Now()
+	filter.DateFrom = now.AddDate(0, 0, -(DefaultListDays - 1)).Format(dateLayout)
+	filter.DateTo = now.Format(dateLayout)
+	return filter
 }
 
-// countTasksByDate 按日期统计任务数量
-func (m *Manager) countTasksByDate(status, date string) (int, error) {
-	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String(m.tableName),
-		IndexName:              aws.String("date-index"),
-		KeyConditionExpression: aws.String("date_partition = :date"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":date": &types.AttributeValueMemberS{Value: date},
-		},
-		Select: types.SelectCount,
-	}
-
-	if status != "" {
-		queryInput.FilterExpression = aws.String("#status = :status")
-		queryInput.ExpressionAttributeNames = map[string]string{
-			"#status": "status",
+// maxConflictRetries 未指定期望版本时，版本冲突后重新读取并重试的次数
+const maxConflictRetries = 5
+
+// mutate 基于版本号的条件更新
+// 读取任务后由 build 根据当前内容生成更新，写入时要求版本号未变化。
+// expectedVersion > 0 时（调用方持有的版本）冲突直接返回 *ConflictError；
+// 否则冲突说明期间有其他写入，重新读取后按最新内容重试
+func (m *Manager) mutate(taskID string, expectedVersion int64, build func(task *TranscodeTask) (*TaskUpdate, error)) (*TranscodeTask, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxConflictRetries; attempt++ {
+		task, err := m.GetTask(taskID)
+		if err != nil {
+			return nil, err
 		}
-		queryInput.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
-	}
-
-	var total int
-	var lastEvaluatedKey map[string]types.AttributeValue
-	for {
-		if lastEvaluatedKey != nil {
-			queryInput.ExclusiveStartKey = lastEvaluatedKey
+		if expectedVersion > 0 && task.Version != expectedVersion {
+			return nil, conflictError(task, expectedVersion)
 		}
 
-		result, err := m.dynamoClient.Query(context.TODO(), queryInput)
+		update, err := build(task)
 		if err != nil {
-			return 0, fmt.Errorf("统计任务失败: %v", err)
+			return nil, err
 		}
+		version := task.Version
+		update.ExpectVersion = &version
 
-		total += int(result.Count)
+		updated, err := m.store.UpdateTask(context.TODO(), taskID, update)
+		if err == nil {
+			return updated, nil
+		}
 
-		if result.LastEvaluatedKey == nil {
-			break
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) || conflict.CurrentVersion == version || expectedVersion > 0 {
+			// 非版本冲突（如状态条件不满足）或调用方指定了版本，不再重试
+			return nil, err
 		}
-		lastEvaluatedKey = result.LastEvaluatedKey
+		lastErr = err
+		log.Printf("🔁 任务 %s 版本冲突，重试更新 (%d/%d)", taskID, attempt+1, maxConflictRetries)
+		time.Sleep(time.Duration(attempt+1) * 20 * time.Millisecond)
 	}
-
-	return total, nil
+	return nil, lastErr
 }
 
-// countTasksByScan 使用 Scan 统计任务数量
-func (m *Manager) countTasksByScan(status string) (int, error) {
-	scanInput := &dynamodb.ScanInput{
-		TableName: aws.String(m.tableName),
-		Select:    types.SelectCount,
-	}
-
-	if status != "" {
-		scanInput.FilterExpression = aws.String("#status = :status")
-		scanInput.ExpressionAttributeNames = map[string]string{
-			"#status": "status",
-		}
-		scanInput.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":status": &types.AttributeValueMemberS{Value: status},
-		}
+// requireStatus 检查任务当前状态是否属于 expect，为空表示不检查
+func requireStatus(task *TranscodeTask, expect []TaskStatus) error {
+	if len(expect) == 0 {
+		return nil
 	}
-
-	var total int
-	var lastEvaluatedKey map[string]types.AttributeValue
-	for {
-		if lastEvaluatedKey != nil {
-			scanInput.ExclusiveStartKey = lastEvaluatedKey
-		}
-
-		result, err := m.dynamoClient.Scan(context.TODO(), scanInput)
-		if err != nil {
-			return 0, fmt.Errorf("统计任务失败: %v", err)
+	for _, status := range expect {
+		if task.Status == status {
+			return nil
 		}
-
-		total += int(result.Count)
-		log.Printf("📊 Scan 统计 [status=%s]: Count=%d, ScannedCount=%d", status, result.Count, result.ScannedCount)
-
-		if result.LastEvaluatedKey == nil {
-			break
-		}
-		lastEvaluatedKey = result.LastEvaluatedKey
 	}
-
-	log.Printf("📊 Scan 统计状态 [%s] 任务总数: %d", status, total)
-	return total, nil
+	return conflictError(task, 0)
 }
 
-// fetchTasksByDate 按日期获取任务列表（带分页）
-func (m *Manager) fetchTasksByDate(status, date string, limit, offset int) ([]TranscodeTask, error) {
-	var tasks []TranscodeTask
-
-	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String(m.tableName),
-		IndexName:              aws.String("date-index"),
-		KeyConditionExpression: aws.String("date_partition = :date"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":date": &types.AttributeValueMemberS{Value: date},
-		},
-		ScanIndexForward: aws.Bool(false),
-	}
+// UpdateTaskStatus 更新任务状态，迁移不合法时返回 *TransitionError
+func (m *Manager) UpdateTaskStatus(taskID string, status TaskStatus, errorMessage string) error {
+	_, err := m.TransitionTask(taskID, 0, status, errorMessage)
+	return err
+}
 
-	if status != "" {
-		queryInput.FilterExpression = aws.String("#status = :status")
-		queryInput.ExpressionAttributeNames = map[string]string{
-			"#status": "status",
+// TransitionTask 按状态迁移表更新任务状态
+// expectedVersion 为调用方看到的任务版本，0 表示不检查；迁移不合法时返回 *TransitionError
+func (m *Manager) TransitionTask(taskID string, expectedVersion int64, status TaskStatus, errorMessage string) (*TranscodeTask, error) {
+	return m.mutate(taskID, expectedVersion, func(task *TranscodeTask) (*TaskUpdate, error) {
+		if err := checkTransition(task, status); err != nil {
+			return nil, err
 		}
-		queryInput.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: status}
-	}
-
-	// 跳过 offset 条记录，获取 limit 条
-	skipped := 0
-	collected := 0
-	var lastEvaluatedKey map[string]types.AttributeValue
 
-	for collected < limit {
-		if lastEvaluatedKey != nil {
-			queryInput.ExclusiveStartKey = lastEvaluatedKey
+		now := time.Now()
+		update := &TaskUpdate{
+			Status: &status,
 		}
 
-		result, err := m.dynamoClient.Query(context.TODO(), queryInput)
-		if err != nil {
-			return nil, fmt.Errorf("查询任务失败: %v", err)
+		if status == TaskStatusProcessing {
+			update.StartedAt = &now
+			update.KeepStartedAt = true
 		}
 
-		for _, item := range result.Items {
-			if skipped < offset {
-				skipped++
-				continue
-			}
-
-			if collected >= limit {
-				break
-			}
-
-			var task TranscodeTask
-			if err := attributevalue.UnmarshalMap(item, &task); err != nil {
-				log.Printf("⚠️  反序列化任务失败: %v", err)
-				continue
-			}
-			tasks = append(tasks, task)
-			collected++
+		if status.IsTerminal() {
+			update.CompletedAt = &now
 		}
 
-		if result.LastEvaluatedKey == nil || collected >= limit {
-			break
+		if errorMessage != "" {
+			update.ErrorMessage = &errorMessage
 		}
-		lastEvaluatedKey = result.LastEvaluatedKey
-	}
-
-	return tasks, nil
+		return update, nil
+	})
 }
 
-// fetchTasksByScan 使用 Scan 获取任务列表（带分页）
-func (m *Manager) fetchTasksByScan(status string, limit, offset int) ([]TranscodeTask, error) {
-	var allTasks []TranscodeTask
-
-	scanInput := &dynamodb.ScanInput{
-		TableName: aws.String(m.tableName),
-	}
-
-	if status != "" {
-		scanInput.FilterExpression = aws.String("#status = :status")
-		scanInput.ExpressionAttributeNames = map[string]string{
-			"#status": "status",
-		}
-		scanInput.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":status": &types.AttributeValueMemberS{Value: status},
-		}
-	}
-
-	// Scan 无法保证顺序，需要获取足够数据后排序
-	needTotal := offset + limit
-	var lastEvaluatedKey map[string]types.AttributeValue
-
-	for len(allTasks) < needTotal {
-		if lastEvaluatedKey != nil {
-			scanInput.ExclusiveStartKey = lastEvaluatedKey
-		}
-
-		result, err := m.dynamoClient.Scan(context.TODO(), scanInput)
-		if err != nil {
-			return nil, fmt.Errorf("扫描任务失败: %v", err)
-		}
-
-		for _, item := range result.Items {
-			var task TranscodeTask
-			if err := attributevalue.UnmarshalMap(item, &task); err != nil {
-				log.Printf("⚠️  反序列化任务失败: %v", err)
-				continue
-			}
-			allTasks = append(allTasks, task)
+// StartProcessing 处理器开始处理任务：状态置为 processing 并记录处理该任务的队列消息ID
+// 同一条消息重新投递（处理器崩溃或关闭时放回队列）时继续处理；
+// 任务正由另一条消息处理时（如 S3 重复投递的事件）返回 ErrDuplicateMessage
+func (m *Manager) StartProcessing(taskID, messageID string) (*TranscodeTask, error) {
+	return m.mutate(taskID, 0, func(task *TranscodeTask) (*TaskUpdate, error) {
+		if err := checkTransition(task, TaskStatusProcessing); err != nil {
+			return nil, err
 		}
-
-		if result.LastEvaluatedKey == nil {
-			break
+		if task.Status == TaskStatusProcessing && task.MessageID != "" && messageID != "" && task.MessageID != messageID {
+			return nil, fmt.Errorf("%w: 任务 %s 正由消息 %s 处理", ErrDuplicateMessage, taskID, task.MessageID)
 		}
-		lastEvaluatedKey = result.LastEvaluatedKey
-	}
 
-	// 按创建时间倒序排序
-	sortTasksByCreatedAtDesc(allTasks)
-
-	// 应用分页
-	if offset >= len(allTasks) {
-		return []TranscodeTask{}, nil
-	}
-
-	end := offset + limit
-	if end > len(allTasks) {
-		end = len(allTasks)
-	}
-
-	return allTasks[offset:end], nil
+		// 实时进度整体置为空 map，之后各转码类型只写入其中自己的键
+		status := TaskStatusProcessing
+		now := time.Now()
+		return &TaskUpdate{
+			Status:               &status,
+			StartedAt:            &now,
+			KeepStartedAt:        true,
+			MessageID:            &messageID,
+			ResetProgressDetails: true,
+		}, nil
+	})
 }
 
-// sortTasksByCreatedAtDesc 按创建时间倒序排序
-func sortTasksByCreatedAtDesc(tasks []TranscodeTask) {
-	for i := 0; i < len(tasks)-1; i++ {
-		for j := i + 1; j < len(tasks); j++ {
-			if tasks[i].CreatedAt.Before(tasks[j].CreatedAt) {
-				tasks[i], tasks[j] = tasks[j], tasks[i]
-			}
-		}
-	}
+// patchProcessing 处理中任务的字段级更新，只要求任务仍处于 processing，不检查版本号
+// 每个转码类型只写入 progress / output_files 中自己的键，互不覆盖，
+// 若按版本号条件更新，同一任务的其他写入会让这类写入无谓地冲突；整体状态迁移仍由 mutate 做版本检查。
+// 任务已被中止或取消时返回 *ConflictError，迟到的写入不会覆盖中止结果
+func (m *Manager) patchProcessing(taskID string, update *TaskUpdate) error {
+	update.ExpectStatus = []TaskStatus{TaskStatusProcessing}
+	_, err := m.store.UpdateTask(context.TODO(), taskID, update)
+	return err
 }
 
-// ListTasksByStatus 使用 status-index GSI 按状态查询任务
-func (m *Manager) ListTasksByStatus(status string, limit, offset int) ([]TranscodeTask, int, error) {
-	// 先统计总数
-	total, err := m.countTasksByStatusIndex(status)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	if offset >= total {
-		return []TranscodeTask{}, total, nil
-	}
-
-	// 获取分页数据
-	tasks, err := m.fetchTasksByStatusIndex(status, limit, offset)
-	if err != nil {
-		return nil, 0, err
-	}
+// UpdateTaskProgress 更新单个转码类型的进度（仅处理中的任务）
+// 任务已被中止或取消时返回 *ConflictError，迟到的进度写入不会覆盖中止结果
+func (m *Manager) UpdateTaskProgress(taskID, transcodeType, progress string) error {
+	return m.patchProcessing(taskID, &TaskUpdate{
+		Progress: map[string]string{transcodeType: progress},
+	})
+}
 
-	return tasks, total, nil
+// UpdateProgressDetail 更新单个转码类型的实时进度（仅处理中的任务）
+// 只写入该类型自己的键，progress_details 已由 StartProcessing 初始化，不需要先读取任务
+func (m *Manager) UpdateProgressDetail(taskID, transcodeType string, detail ProgressDetail) error {
+	detail.UpdatedAt = time.Now()
+	return m.patchProcessing(taskID, &TaskUpdate{
+		ProgressDetails: map[string]ProgressDetail{transcodeType: detail},
+	})
 }
 
-// countTasksByStatusIndex 使用 status-index GSI 统计任务数量
-func (m *Manager) countTasksByStatusIndex(status string) (int, error) {
-	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String(m.tableName),
-		IndexName:              aws.String("status-index"),
-		KeyConditionExpression: aws.String("#status = :status"),
-		ExpressionAttributeNames: map[string]string{
-			"#status": "status",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status": &types.AttributeValueMemberS{Value: status},
-		},
-		Select: types.SelectCount,
-	}
+// AddOutputFile 添加输出文件（仅处理中的任务）
+func (m *Manager) AddOutputFile(taskID, transcodeType, outputKey string) error {
+	return m.patchProcessing(taskID, &TaskUpdate{
+		OutputFiles: map[string]string{transcodeType: outputKey},
+	})
+}
 
-	var total int
-	var lastEvaluatedKey map[string]types.AttributeValue
-	for {
-		if lastEvaluatedKey != nil {
-			queryInput.ExclusiveStartKey = lastEvaluatedKey
+// SetMediaInfo 记录输入文件的媒体信息（处理中的任务）
+func (m *Manager) SetMediaInfo(taskID string, info *MediaInfo) error {
+	_, err := m.mutate(taskID, 0, func(task *TranscodeTask) (*TaskUpdate, error) {
+		if err := requireStatus(task, []TaskStatus{TaskStatusProcessing}); err != nil {
+			return nil, err
 		}
+		return &TaskUpdate{
+			MediaInfo: info,
+		}, nil
+	})
+	return err
+}
 
-		result, err := m.dynamoClient.Query(context.TODO(), queryInput)
-		if err != nil {
-			log.Printf("⚠️  status-index GSI 查询失败，回退到 Scan: %v", err)
-			// GSI 可能不存在，回退到 Scan
-			return m.countTasksByScan(status)
+// RetryTask 重新运行已结束（完成、失败、中止、取消）的任务（手动重试、死信重新投递）
+// 重试次数清零，重新运行的任务拥有完整的 MaxRetries 次自动重试；
+// expectedVersion 为调用方看到的任务版本，0 表示不检查
+func (m *Manager) RetryTask(taskID string, expectedVersion int64) (*TranscodeTask, error) {
+	return m.mutate(taskID, expectedVersion, func(task *TranscodeTask) (*TaskUpdate, error) {
+		// 只有终态任务可以重新运行（processing -> retrying 仅用于处理器自动重试）
+		if !task.Status.IsTerminal() {
+			return nil, &TransitionError{TaskID: task.TaskID, From: task.Status, To: TaskStatusRetrying}
+		}
+		if err := checkTransition(task, TaskStatusRetrying); err != nil {
+			return nil, err
 		}
 
-		total += int(result.Count)
-
-		if result.LastEvaluatedKey == nil {
-			break
+		// 重置进度
+		progress := make(map[string]string, len(task.Progress))
+		for transcodeType := range task.Progress {
+			progress[transcodeType] = "pending"
 		}
-		lastEvaluatedKey = result.LastEvaluatedKey
-	}
 
-	log.Printf("📊 统计状态 [%s] 任务数量: %d", status, total)
-	return total, nil
+		status := TaskStatusRetrying
+		noError := ""
+		return &TaskUpdate{
+			Status:               &status,
+			ErrorMessage:         &noError,
+			ClearTimes:           true,
+			Progress:             progress,
+			ResetProgressDetails: true,
+			ResetOutputFiles:     true,
+			ClearErrorDetails:    true,
+			ResetRetryCount:      true,
+		}, nil
+	})
 }
 
-// fetchTasksByStatusIndex 使用 status-index GSI 获取任务列表
-func (m *Manager) fetchTasksByStatusIndex(status string, limit, offset int) ([]TranscodeTask, error) {
-	var tasks []TranscodeTask
-
-	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String(m.tableName),
-		IndexName:              aws.String("status-index"),
-		KeyConditionExpression: aws.String("#status = :status"),
-		ExpressionAttributeNames: map[string]string{
-			"#status": "status",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status": &types.AttributeValueMemberS{Value: status},
-		},
-		ScanIndexForward: aws.Bool(false),
-	}
-
-	skipped := 0
-	collected := 0
-	var lastEvaluatedKey map[string]types.AttributeValue
-
-	for collected < limit {
-		if lastEvaluatedKey != nil {
-			queryInput.ExclusiveStartKey = lastEvaluatedKey
+// ScheduleRetry 处理中的任务遇到临时故障后安排自动重试
+// 任务置为 retrying 并增加重试次数，未完成的转码类型重置为 pending，已完成的类型及其输出保留，
+// 消息重新投递后只处理未完成的类型；重试次数已达 MaxRetries 时返回 ErrRetriesExhausted，
+// 任务不在处理中（如已被中止）时返回 *ConflictError
+func (m *Manager) ScheduleRetry(taskID, reason string) (*TranscodeTask, error) {
+	return m.mutate(taskID, 0, func(task *TranscodeTask) (*TaskUpdate, error) {
+		if err := requireStatus(task, []TaskStatus{TaskStatusProcessing}); err != nil {
+			return nil, err
 		}
-
-		result, err := m.dynamoClient.Query(context.TODO(), queryInput)
-		if err != nil {
-			return nil, fmt.Errorf("查询任务失败: %v", err)
+		if task.RetryCount >= task.MaxRetries {
+			return nil, fmt.Errorf("%w: 任务 %s 已重试 %d 次", ErrRetriesExhausted, task.TaskID, task.RetryCount)
 		}
 
-		for _, item := range result.Items {
-			if skipped < offset {
-				skipped++
-				continue
+		progress := make(map[string]string)
+		for transcodeType, status := range task.Progress {
+			if status != "completed" {
+				progress[transcodeType] = "pending"
 			}
-
-			if collected >= limit {
-				break
-			}
-
-			var task TranscodeTask
-			if err := attributevalue.UnmarshalMap(item, &task); err != nil {
-				log.Printf("⚠️  反序列化任务失败: %v", err)
-				continue
-			}
-			tasks = append(tasks, task)
-			collected++
-		}
-
-		if result.LastEvaluatedKey == nil || collected >= limit {
-			break
 		}
-		lastEvaluatedKey = result.LastEvaluatedKey
-	}
-
-	return tasks, nil
-}
-
-// UpdateTaskStatus 更新任务状态
-func (m *Manager) UpdateTaskStatus(taskID string, status TaskStatus, errorMessage string) error {
-	task, err := m.GetTask(taskID)
-	if err != nil {
-		return err
-	}
 
-	task.Status = status
-	task.UpdatedAt = time.Now()
-
-	if status == TaskStatusProcessing && task.StartedAt == nil {
-		now := time.Now()
-		task.StartedAt = &now
-	}
-
-	if status == TaskStatusCompleted || status == TaskStatusFailed {
-		now := time.Now()
-		task.CompletedAt = &now
-	}
-
-	if errorMessage != "" {
-		task.ErrorMessage = errorMessage
-	}
-
-	return m.SaveTask(task)
-}
-
-// UpdateTaskProgress 更新任务进度
-func (m *Manager) UpdateTaskProgress(taskID, transcodeType, progress string) error {
-	task, err := m.GetTask(taskID)
-	if err != nil {
-		return err
-	}
-
-	task.Progress[transcodeType] = progress
-	return m.SaveTask(task)
+		status := TaskStatusRetrying
+		return &TaskUpdate{
+			Status:               &status,
+			ErrorMessage:         &reason,
+			Progress:             progress,
+			ResetProgressDetails: true,
+			IncrementRetry:       true,
+		}, nil
+	})
 }
 
-// AddOutputFile 添加输出文件
-func (m *Manager) AddOutputFile(taskID, transcodeType, outputKey string) error {
-	task, err := m.GetTask(taskID)
-	if err != nil {
-		return err
-	}
-
-	task.OutputFiles[transcodeType] = outputKey
-	return m.SaveTask(task)
+// CancelTask 取消尚未开始处理的任务
+// expectedVersion 为调用方看到的任务版本，0 表示不检查
+func (m *Manager) CancelTask(taskID string, expectedVersion int64, reason string) (*TranscodeTask, error) {
+	return m.TransitionTask(taskID, expectedVersion, TaskStatusCancelled, reason)
 }
 
-// RetryTask 重试任务（支持任意状态的任务）
-func (m *Manager) RetryTask(taskID string) error {
-	task, err := m.GetTask(taskID)
-	if err != nil {
-		return err
-	}
-
-	// 如果任务正在处理中，不允许重试
-	if task.Status == TaskStatusProcessing {
-		return fmt.Errorf("任务正在处理中，无法重试")
-	}
-
-	task.RetryCount++
-	task.Status = TaskStatusRetrying
-	task.ErrorMessage = ""
-	task.ErrorDetails = nil // 清空错误详情
-	task.UpdatedAt = time.Now()
-	task.StartedAt = nil
-	task.CompletedAt = nil
-
-	// 重置进度
-	for transcodeType := range task.Progress {
-		task.Progress[transcodeType] = "pending"
+// CancelTasksForInput 取消输入文件对应的所有待处理任务（pending / retrying），返回被取消的任务ID
+// 用于输入文件被删除时（S3 ObjectRemoved 事件），处理中的任务不受影响
+func (m *Manager) CancelTasksForInput(inputBucket, inputKey, reason string) ([]string, error) {
+	var cancelled []string
+	for _, status := range []TaskStatus{TaskStatusPending, TaskStatusRetrying} {
+		cursor := ""
+		for {
+			page, err := m.ListTasks(TaskFilter{Status: string(status), KeyPrefix: inputKey}, 100, cursor)
+			if err != nil {
+				return cancelled, err
+			}
+			for _, task := range page.Tasks {
+				if task.InputBucket != inputBucket || task.InputKey != inputKey {
+					continue
+				}
+				if _, err := m.CancelTask(task.TaskID, 0, reason); err != nil {
+					// 期间已开始处理或被其他请求修改
+					if errors.Is(err, ErrInvalidTransition) {
+						continue
+					}
+					return cancelled, err
+				}
+				cancelled = append(cancelled, task.TaskID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
 	}
-
-	// 重置输出文件
-	task.OutputFiles = make(map[string]string)
-
-	return m.SaveTask(task)
+	return cancelled, nil
 }
 
-// AddErrorDetail 添加错误详情
+// AddErrorDetail 添加错误详情（追加写入）
 func (m *Manager) AddErrorDetail(taskID string, detail ErrorDetail) error {
-	task, err := m.GetTask(taskID)
-	if err != nil {
-		return err
-	}
-
 	detail.Timestamp = time.Now()
 
 	// 限制输出日志长度，避免 DynamoDB 存储过大
@@ -602,33 +436,48 @@ func (m *Manager) AddErrorDetail(taskID string, detail ErrorDetail) error {
 		detail.Command = detail.Command[:1000] + "... [命令已截断]"
 	}
 
-	task.ErrorDetails = append(task.ErrorDetails, detail)
-	return m.SaveTask(task)
+	_, err := m.mutate(taskID, 0, func(task *TranscodeTask) (*TaskUpdate, error) {
+		return &TaskUpdate{
+			AppendErrors: []ErrorDetail{detail},
+		}, nil
+	})
+	return err
 }
 
-// IsTaskAborted 检查任务是否被中止（状态变为 failed 且错误信息包含"中止"）
+// IsTaskAborted 检查任务是否已被用户中止
 func (m *Manager) IsTaskAborted(taskID string) bool {
 	task, err := m.GetTask(taskID)
 	if err != nil {
 		return false
 	}
-	// 如果任务状态不是 processing，说明被中止或已完成
-	return task.Status != TaskStatusProcessing
+	return task.Status == TaskStatusAborted
 }
 
-// MarkIncompleteProgressAsFailed 将未完成的转码类型状态设置为 failed
-func (m *Manager) MarkIncompleteProgressAsFailed(taskID string) error {
-	task, err := m.GetTask(taskID)
-	if err != nil {
-		return err
-	}
+// AbortTask 中止处理中的任务
+// 在一次条件更新中将任务置为 aborted 并将未完成的转码类型标记为 aborted，
+// 处理器检测到中止后会终止正在运行的转码；
+// expectedVersion 为调用方看到的任务版本，0 表示不检查
+func (m *Manager) AbortTask(taskID string, expectedVersion int64, reason string) (*TranscodeTask, error) {
+	return m.mutate(taskID, expectedVersion, func(task *TranscodeTask) (*TaskUpdate, error) {
+		if err := checkTransition(task, TaskStatusAborted); err != nil {
+			return nil, err
+		}
 
-	// 遍历所有转码类型，将非 completed 状态的设置为 failed
-	for transcodeType, status := range task.Progress {
-		if status != "completed" {
-			task.Progress[transcodeType] = "failed"
+		// 未完成的转码类型标记为 aborted（已失败的保持 failed）
+		progress := make(map[string]string)
+		for transcodeType, status := range task.Progress {
+			if status != "completed" && status != "failed" {
+				progress[transcodeType] = "aborted"
+			}
 		}
-	}
 
-	return m.SaveTask(task)
-}
\ No newline at end of file
+		now := time.Now()
+		status := TaskStatusAborted
+		return &TaskUpdate{
+			Status:       &status,
+			ErrorMessage: &reason,
+			CompletedAt:  &now,
+			Progress:     progress,
+		}, nil
+	})
+}
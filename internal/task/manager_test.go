@@ -0,0 +1,161 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestManager 基于临时 SQLite 存储创建任务管理器
+func newTestManager(t *testing.T) (*Manager, *SQLiteStore) {
+	t.Helper()
+	store := newTestSQLiteStore(t)
+	return NewManager(store), store
+}
+
+func TestManagerConcurrentTypeUpdates(t *testing.T) {
+	manager, store := newTestManager(t)
+	createTestTask(t, store, "task-1", time.Now(), TaskStatusProcessing)
+
+	// 并行的转码类型写入 progress / output_files 中不同的键，互相不应冲突
+	const types = 12
+	var wg sync.WaitGroup
+	errs := make(chan error, types*2)
+	for i := 0; i < types; i++ {
+		transcodeType := fmt.Sprintf("type_%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := manager.AddOutputFile("task-1", transcodeType, transcodeType+".mp4"); err != nil {
+				errs <- err
+			}
+			if err := manager.UpdateTaskProgress("task-1", transcodeType, "completed"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("并发更新失败: %v", err)
+	}
+
+	task, err := manager.GetTask("task-1")
+	if err != nil {
+		t.Fatalf("获取任务失败: %v", err)
+	}
+	for i := 0; i < types; i++ {
+		transcodeType := fmt.Sprintf("type_%d", i)
+		if task.Progress[transcodeType] != "completed" || task.OutputFiles[transcodeType] != transcodeType+".mp4" {
+			t.Errorf("转码类型 %s 的更新丢失: progress=%q output=%q", transcodeType, task.Progress[transcodeType], task.OutputFiles[transcodeType])
+		}
+	}
+}
+
+func TestManagerTypeUpdatesRequireProcessing(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  TaskStatus
+		wantErr error
+	}{
+		{name: "处理中的任务可以写入", status: TaskStatusProcessing},
+		{name: "已中止的任务拒绝迟到的写入", status: TaskStatusAborted, wantErr: ErrConditionFailed},
+		{name: "已取消的任务拒绝迟到的写入", status: TaskStatusCancelled, wantErr: ErrConditionFailed},
+		{name: "待处理的任务拒绝写入", status: TaskStatusPending, wantErr: ErrConditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, store := newTestManager(t)
+			createTestTask(t, store, "task-1", time.Now(), tt.status)
+
+			if err := manager.UpdateTaskProgress("task-1", "mp4_720p", "completed"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateTaskProgress() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := manager.AddOutputFile("task-1", "mp4_720p", "out.mp4"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AddOutputFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := manager.UpdateProgressDetail("task-1", "mp4_720p", ProgressDetail{}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateProgressDetail() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagerRetryTaskResetsRetryCount(t *testing.T) {
+	manager, store := newTestManager(t)
+	createTestTask(t, store, "task-1", time.Now(), TaskStatusProcessing)
+
+	// 用完自动重试次数后任务失败
+	for {
+		if _, err := manager.StartProcessing("task-1", ""); err != nil {
+			t.Fatalf("开始处理失败: %v", err)
+		}
+		if _, err := manager.ScheduleRetry("task-1", "临时故障"); err != nil {
+			if !errors.Is(err, ErrRetriesExhausted) {
+				t.Fatalf("ScheduleRetry() error = %v", err)
+			}
+			break
+		}
+	}
+	if err := manager.UpdateTaskStatus("task-1", TaskStatusFailed, "已达到最大重试次数"); err != nil {
+		t.Fatalf("标记失败失败: %v", err)
+	}
+
+	// 手动重试后重新获得完整的自动重试次数
+	retried, err := manager.RetryTask("task-1", 0)
+	if err != nil {
+		t.Fatalf("RetryTask() error = %v", err)
+	}
+	if retried.RetryCount != 0 {
+		t.Errorf("手动重试后 RetryCount = %d, want 0", retried.RetryCount)
+	}
+	if _, err := manager.StartProcessing("task-1", ""); err != nil {
+		t.Fatalf("开始处理失败: %v", err)
+	}
+	if _, err := manager.ScheduleRetry("task-1", "临时故障"); err != nil {
+		t.Errorf("手动重试后第一次临时故障应安排自动重试: %v", err)
+	}
+}
+
+func TestManagerProgressDetailsPerType(t *testing.T) {
+	manager, store := newTestManager(t)
+	createTestTask(t, store, "task-1", time.Now(), TaskStatusPending)
+	if _, err := manager.StartProcessing("task-1", "message-1"); err != nil {
+		t.Fatalf("开始处理失败: %v", err)
+	}
+
+	// 并行的转码类型各自写入实时进度，后写入的类型不应清掉先写入的类型
+	const types = 8
+	var wg sync.WaitGroup
+	for i := 0; i < types; i++ {
+		transcodeType := fmt.Sprintf("type_%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := manager.UpdateProgressDetail("task-1", transcodeType, ProgressDetail{Percent: 50}); err != nil {
+				t.Errorf("更新实时进度失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	task, err := manager.GetTask("task-1")
+	if err != nil {
+		t.Fatalf("获取任务失败: %v", err)
+	}
+	if len(task.ProgressDetails) != types {
+		t.Errorf("实时进度条数 = %d, want %d: %+v", len(task.ProgressDetails), types, task.ProgressDetails)
+	}
+
+	// 安排重试时清空实时进度
+	retried, err := manager.ScheduleRetry("task-1", "临时故障")
+	if err != nil {
+		t.Fatalf("ScheduleRetry() error = %v", err)
+	}
+	if len(retried.ProgressDetails) != 0 {
+		t.Errorf("重试后实时进度应为空: %+v", retried.ProgressDetails)
+	}
+}
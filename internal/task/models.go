@@ -14,39 +14,121 @@ const (
 	TaskStatusFailed     TaskStatus = "failed"     // 失败
 	TaskStatusRetrying   TaskStatus = "retrying"   // 重试中
 	TaskStatusCancelled  TaskStatus = "cancelled"  // 已取消
+	TaskStatusAborted    TaskStatus = "aborted"    // 处理中被用户中止
 )
 
 // TranscodeTask 转码任务结构
 type TranscodeTask struct {
-	TaskID         string            `json:"task_id" dynamodbav:"task_id"`
-	DatePartition  string            `json:"date_partition" dynamodbav:"date_partition"` // 日期分区键，格式: 2025-01-15
-	InputBucket    string            `json:"input_bucket" dynamodbav:"input_bucket"`
-	InputKey       string            `json:"input_key" dynamodbav:"input_key"`
-	OutputBucket   string            `json:"output_bucket" dynamodbav:"output_bucket"`
-	TranscodeTypes []string          `json:"transcode_types" dynamodbav:"transcode_types"`
-	Status         TaskStatus        `json:"status" dynamodbav:"status"`
-	CreatedAt      time.Time         `json:"created_at" dynamodbav:"created_at"`
-	UpdatedAt      time.Time         `json:"updated_at" dynamodbav:"updated_at"`
-	StartedAt      *time.Time        `json:"started_at,omitempty" dynamodbav:"started_at,omitempty"`
-	CompletedAt    *time.Time        `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
-	ErrorMessage   string            `json:"error_message,omitempty" dynamodbav:"error_message,omitempty"`
-	ErrorDetails   []ErrorDetail     `json:"error_details,omitempty" dynamodbav:"error_details,omitempty"` // 详细错误信息
-	RetryCount     int               `json:"retry_count" dynamodbav:"retry_count"`
-	MaxRetries     int               `json:"max_retries" dynamodbav:"max_retries"`
-	Progress       map[string]string `json:"progress" dynamodbav:"progress"`       // 各转码类型的进度
-	OutputFiles    map[string]string `json:"output_files" dynamodbav:"output_files"` // 输出文件映射
+	TaskID          string                    `json:"task_id" dynamodbav:"task_id"`
+	DatePartition   string                    `json:"date_partition" dynamodbav:"date_partition"` // 日期分区键，格式: 2025-01-15
+	InputBucket     string                    `json:"input_bucket" dynamodbav:"input_bucket"`
+	InputKey        string                    `json:"input_key" dynamodbav:"input_key"`
+	OutputBucket    string                    `json:"output_bucket" dynamodbav:"output_bucket"`
+	TranscodeTypes  []string                  `json:"transcode_types" dynamodbav:"transcode_types"`
+	CreatedBy       string                    `json:"created_by,omitempty" dynamodbav:"created_by,omitempty"`           // 创建者用户名，S3 事件触发的任务为 s3-event
+	Priority        string                    `json:"priority,omitempty" dynamodbav:"priority,omitempty"`               // 优先级 high/normal/bulk，为空表示 normal
+	IdempotencyKey  string                    `json:"idempotency_key,omitempty" dynamodbav:"idempotency_key,omitempty"` // 客户端提交时携带的幂等键
+	OutputPrefix    string                    `json:"output_prefix,omitempty" dynamodbav:"output_prefix,omitempty"`     // 输出文件 key 前缀（由接入规则指定）
+	IngestRule      string                    `json:"ingest_rule,omitempty" dynamodbav:"ingest_rule,omitempty"`         // 创建该任务的接入规则ID
+	Status          TaskStatus                `json:"status" dynamodbav:"status"`
+	MessageID       string                    `json:"message_id,omitempty" dynamodbav:"message_id,omitempty"` // 最近一次开始处理该任务的队列消息ID
+	CreatedAt       time.Time                 `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt       time.Time                 `json:"updated_at" dynamodbav:"updated_at"`
+	StartedAt       *time.Time                `json:"started_at,omitempty" dynamodbav:"started_at,omitempty"`
+	CompletedAt     *time.Time                `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+	ErrorMessage    string                    `json:"error_message,omitempty" dynamodbav:"error_message,omitempty"`
+	ErrorDetails    []ErrorDetail             `json:"error_details,omitempty" dynamodbav:"error_details,omitempty"`         // 详细错误信息
+	ErrorStages     []string                  `json:"error_stages,omitempty" dynamodbav:"error_stages,omitempty,stringset"` // 出错阶段集合（由 error_details 汇总，用于按阶段搜索）
+	RetryCount      int                       `json:"retry_count" dynamodbav:"retry_count"`
+	MaxRetries      int                       `json:"max_retries" dynamodbav:"max_retries"`
+	Progress        map[string]string         `json:"progress" dynamodbav:"progress"`                                     // 各转码类型的进度
+	ProgressDetails map[string]ProgressDetail `json:"progress_details,omitempty" dynamodbav:"progress_details,omitempty"` // 各转码类型的实时进度（百分比、速度、预计剩余时间）
+	OutputFiles     map[string]string         `json:"output_files" dynamodbav:"output_files"`                             // 输出文件映射
+	MediaInfo       *MediaInfo                `json:"media_info,omitempty" dynamodbav:"media_info,omitempty"`             // 输入文件的媒体信息（ffprobe 探测结果）
+	Version         int64                     `json:"version" dynamodbav:"version"`                                       // 乐观锁版本号，每次更新加一
 }
 
 // ErrorDetail 错误详情
 type ErrorDetail struct {
 	TranscodeType string    `json:"transcode_type" dynamodbav:"transcode_type"` // 转码类型
-	Stage         string    `json:"stage" dynamodbav:"stage"`                   // 失败阶段: download/transcode/upload
+	Stage         string    `json:"stage" dynamodbav:"stage"`                   // 失败阶段: download/probe/transcode/upload
 	Error         string    `json:"error" dynamodbav:"error"`                   // 错误信息
 	Command       string    `json:"command,omitempty" dynamodbav:"command,omitempty"` // 执行的命令
 	Output        string    `json:"output,omitempty" dynamodbav:"output,omitempty"`   // 命令输出/日志
 	Timestamp     time.Time `json:"timestamp" dynamodbav:"timestamp"`           // 错误发生时间
 }
 
+// ProgressDetail 单个转码类型的实时进度（由 FFmpeg -progress 输出解析）
+type ProgressDetail struct {
+	Percent    float64   `json:"percent" dynamodbav:"percent"`         // 完成百分比 0-100，无法获取时长时为 0
+	FPS        float64   `json:"fps" dynamodbav:"fps"`                 // 当前编码帧率
+	Speed      float64   `json:"speed" dynamodbav:"speed"`             // 编码速度（相对实时的倍数）
+	ETASeconds int64     `json:"eta_seconds" dynamodbav:"eta_seconds"` // 预计剩余秒数，-1 表示未知
+	UpdatedAt  time.Time `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// MediaInfo 输入文件的媒体信息（下载后由 ffprobe 探测）
+// 顶层的视频字段取自主视频流，便于列表展示和后续按源规格选择输出
+type MediaInfo struct {
+	Container       string        `json:"container" dynamodbav:"container"`                         // 封装格式，如 mov,mp4,m4a,3gp,3g2,mj2
+	DurationSeconds float64       `json:"duration_seconds" dynamodbav:"duration_seconds"`           // 时长（秒），无法获取时为 0
+	Size            int64         `json:"size,omitempty" dynamodbav:"size,omitempty"`               // 文件大小（字节）
+	BitRate         int64         `json:"bit_rate,omitempty" dynamodbav:"bit_rate,omitempty"`       // 总码率（bit/s）
+	VideoCodec      string        `json:"video_codec,omitempty" dynamodbav:"video_codec,omitempty"` // 主视频流编码
+	AudioCodec      string        `json:"audio_codec,omitempty" dynamodbav:"audio_codec,omitempty"` // 第一条音频流编码，无音频时为空
+	Width           int           `json:"width,omitempty" dynamodbav:"width,omitempty"`             // 编码宽度（未考虑旋转）
+	Height          int           `json:"height,omitempty" dynamodbav:"height,omitempty"`           // 编码高度（未考虑旋转）
+	FrameRate       float64       `json:"frame_rate,omitempty" dynamodbav:"frame_rate,omitempty"`   // 帧率
+	Rotation        int           `json:"rotation,omitempty" dynamodbav:"rotation,omitempty"`       // 顺时针旋转角度 0/90/180/270
+	HDR             string        `json:"hdr,omitempty" dynamodbav:"hdr,omitempty"`                 // HDR 格式 HDR10/HLG/DolbyVision，SDR 为空
+	Streams         []MediaStream `json:"streams" dynamodbav:"streams"`                             // 全部流
+	ProbedAt        time.Time     `json:"probed_at" dynamodbav:"probed_at"`
+}
+
+// MediaStream 单条媒体流信息
+type MediaStream struct {
+	Index          int     `json:"index" dynamodbav:"index"`
+	Type           string  `json:"type" dynamodbav:"type"` // video/audio/subtitle/data/attachment
+	Codec          string  `json:"codec,omitempty" dynamodbav:"codec,omitempty"`
+	Profile        string  `json:"profile,omitempty" dynamodbav:"profile,omitempty"`
+	BitRate        int64   `json:"bit_rate,omitempty" dynamodbav:"bit_rate,omitempty"`
+	Language       string  `json:"language,omitempty" dynamodbav:"language,omitempty"`
+	AttachedPic    bool    `json:"attached_pic,omitempty" dynamodbav:"attached_pic,omitempty"` // 封面图（不是真正的视频流）
+	Width          int     `json:"width,omitempty" dynamodbav:"width,omitempty"`
+	Height         int     `json:"height,omitempty" dynamodbav:"height,omitempty"`
+	FrameRate      float64 `json:"frame_rate,omitempty" dynamodbav:"frame_rate,omitempty"`
+	PixelFormat    string  `json:"pix_fmt,omitempty" dynamodbav:"pix_fmt,omitempty"`
+	BitDepth       int     `json:"bit_depth,omitempty" dynamodbav:"bit_depth,omitempty"`
+	ColorSpace     string  `json:"color_space,omitempty" dynamodbav:"color_space,omitempty"`
+	ColorTransfer  string  `json:"color_transfer,omitempty" dynamodbav:"color_transfer,omitempty"`
+	ColorPrimaries string  `json:"color_primaries,omitempty" dynamodbav:"color_primaries,omitempty"`
+	ColorRange     string  `json:"color_range,omitempty" dynamodbav:"color_range,omitempty"`
+	Rotation       int     `json:"rotation,omitempty" dynamodbav:"rotation,omitempty"`
+	Channels       int     `json:"channels,omitempty" dynamodbav:"channels,omitempty"`
+	ChannelLayout  string  `json:"channel_layout,omitempty" dynamodbav:"channel_layout,omitempty"`
+	SampleRate     int     `json:"sample_rate,omitempty" dynamodbav:"sample_rate,omitempty"`
+}
+
+// 任务优先级，每个优先级对应一个队列通道
+const (
+	PriorityHigh   = "high"   // 紧急任务（如编辑手动上传的单个文件）
+	PriorityNormal = "normal" // 默认
+	PriorityBulk   = "bulk"   // 批量任务（如历史文件回填）
+)
+
+// Priorities 所有优先级，从高到低
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityBulk}
+
+// NormalizePriority 返回规范的优先级，空值和未知值视为 normal
+func NormalizePriority(priority string) string {
+	for _, p := range Priorities {
+		if priority == p {
+			return p
+		}
+	}
+	return PriorityNormal
+}
+
 // QueueMessage SQS队列消息结构 (API发送的格式)
 type QueueMessage struct {
 	TaskID         string   `json:"task_id"`
@@ -54,8 +136,15 @@ type QueueMessage struct {
 	InputKey       string   `json:"input_key"`
 	OutputBucket   string   `json:"output_bucket"`
 	TranscodeTypes []string `json:"transcode_types"`
+	Priority       string   `json:"priority,omitempty"`      // 为空表示 normal
+	Action         string   `json:"action,omitempty"`        // 为空表示转码，cancel 表示取消该输入文件的待处理任务
+	OutputPrefix   string   `json:"output_prefix,omitempty"` // 输出文件 key 前缀
+	IngestRule     string   `json:"ingest_rule,omitempty"`   // 匹配的接入规则ID
 }
 
+// QueueActionCancel 输入文件已被删除（S3 ObjectRemoved 事件），取消该文件的待处理任务
+const QueueActionCancel = "cancel"
+
 // S3EventMessage S3事件通知消息结构
 type S3EventMessage struct {
 	Records []S3EventRecord `json:"Records"`
@@ -83,25 +172,67 @@ type S3Bucket struct {
 
 // S3Object S3对象信息
 type S3Object struct {
-	Key  string `json:"key"`
-	Size int64  `json:"size"`
-	ETag string `json:"eTag"`
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"eTag"`
+	VersionID string `json:"versionId"` // 桶开启版本控制时才有
+	Sequencer string `json:"sequencer"` // 同一个 key 的事件按 sequencer 排序
+}
+
+// SNSNotification 经 SNS 转发到 SQS 的通知（订阅未开启 raw message delivery 时）
+type SNSNotification struct {
+	Type     string `json:"Type"`
+	TopicArn string `json:"TopicArn"`
+	Message  string `json:"Message"` // 原始消息（S3 事件 JSON）
+}
+
+// EventBridgeS3Event EventBridge 格式的 S3 事件
+type EventBridgeS3Event struct {
+	Source     string            `json:"source"`      // aws.s3
+	DetailType string            `json:"detail-type"` // Object Created / Object Deleted
+	Time       string            `json:"time"`
+	Detail     EventBridgeDetail `json:"detail"`
+}
+
+// EventBridgeDetail EventBridge S3 事件详情
+type EventBridgeDetail struct {
+	Bucket S3Bucket          `json:"bucket"`
+	Object EventBridgeObject `json:"object"`
+	Reason string            `json:"reason"` // PutObject、CopyObject、DeleteObject 等
+}
+
+// EventBridgeObject EventBridge S3 事件中的对象信息
+type EventBridgeObject struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag"`
+	VersionID string `json:"version-id"`
+	Sequencer string `json:"sequencer"`
 }
 
 // TaskListRequest 任务列表请求
 type TaskListRequest struct {
-	Status string `form:"status"`
-	Date   string `form:"date"`   // 日期过滤，格式: 2025-01-15
-	Limit  int    `form:"limit"`
-	Offset int    `form:"offset"`
+	Status   string `form:"status"`
+	Date     string `form:"date"`      // 日期过滤，格式: 2025-01-15
+	DateFrom string `form:"date_from"` // 日期范围开始（含）
+	DateTo   string `form:"date_to"`   // 日期范围结束（含）
+	Days     int    `form:"days"`      // 最近 N 天（未指定日期时生效）
+	Limit    int    `form:"limit"`
+	Cursor   string `form:"cursor"` // 上一页返回的 next_cursor
+	Count    bool   `form:"count"`  // 是否返回总数（需要额外统计）
+
+	KeyPrefix     string `form:"key_prefix"`     // 输入文件 key 前缀
+	TranscodeType string `form:"transcode_type"` // 包含的转码类型
+	CreatedBy     string `form:"created_by"`     // 创建者用户名
+	ErrorStage    string `form:"error_stage"`    // 出过错的阶段
 }
 
 // TaskListResponse 任务列表响应
 type TaskListResponse struct {
-	Tasks  []TranscodeTask `json:"tasks"`
-	Total  int             `json:"total"`
-	Limit  int             `json:"limit"`
-	Offset int             `json:"offset"`
+	Tasks      []TranscodeTask `json:"tasks"`
+	Total      *int            `json:"total,omitempty"` // 仅在请求 count=true 时返回
+	Limit      int             `json:"limit"`
+	NextCursor string          `json:"next_cursor,omitempty"` // 为空表示没有更多数据
 }
 
 // AddTaskRequest 添加任务请求
@@ -109,10 +240,20 @@ type AddTaskRequest struct {
 	InputBucket    string   `json:"input_bucket" binding:"required"`
 	InputKey       string   `json:"input_key" binding:"required"`
 	TranscodeTypes []string `json:"transcode_types" binding:"required"`
+	Priority       string   `json:"priority" binding:"omitempty,oneof=high normal bulk"` // 默认 normal
+	IdempotencyKey string   `json:"idempotency_key"`                                     // 也可通过 Idempotency-Key 请求头提供
 }
 
 // QueueStatusResponse 队列状态响应
 type QueueStatusResponse struct {
+	ApproximateNumberOfMessages           int                   `json:"approximate_number_of_messages"`
+	ApproximateNumberOfMessagesNotVisible int                   `json:"approximate_number_of_messages_not_visible"`
+	Lanes                                 map[string]LaneStatus `json:"lanes,omitempty"` // 各优先级通道的统计，仅配置了多个通道时返回
+}
+
+// LaneStatus 优先级通道状态
+type LaneStatus struct {
 	ApproximateNumberOfMessages           int `json:"approximate_number_of_messages"`
 	ApproximateNumberOfMessagesNotVisible int `json:"approximate_number_of_messages_not_visible"`
+	Weight                                int `json:"weight"` // 接收时的轮询权重
 }
\ No newline at end of file
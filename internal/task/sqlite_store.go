@@ -0,0 +1,335 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema 任务表结构
+// 完整任务以 JSON 保存在 data 列，常用过滤字段单独成列并建立索引
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tasks (
+	task_id        TEXT PRIMARY KEY,
+	date_partition TEXT NOT NULL,
+	status         TEXT NOT NULL,
+	input_bucket   TEXT NOT NULL DEFAULT '',
+	input_key      TEXT NOT NULL DEFAULT '',
+	created_at     INTEGER NOT NULL,
+	updated_at     INTEGER NOT NULL,
+	data           TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_date ON tasks (date_partition, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks (status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_creator ON tasks (json_extract(data, '$.created_by'), created_at DESC);
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	idempotency_key TEXT PRIMARY KEY,
+	task_id         TEXT NOT NULL,
+	expires_at      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_expires ON idempotency_keys (expires_at);
+`
+
+// SQLiteStore 基于嵌入式 SQLite 的任务存储
+// 使用 WAL 模式，API服务器与GPU处理器可在同一台机器上共享同一个数据库文件
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore 打开（必要时创建）SQLite 任务数据库
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLite 数据库路径不能为空")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+	}
+
+	// busy_timeout 让跨进程写冲突时等待而不是立即报错；_txlock=immediate 避免读后写升级锁时死锁
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开SQLite数据库失败: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化SQLite表结构失败: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Backend 返回后端类型
+func (s *SQLiteStore) Backend() string {
+	return StoreBackendSQLite
+}
+
+// Close 关闭数据库
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// taskRow 任务在 SQLite 中的行数据
+func taskRow(task *TranscodeTask) ([]any, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("序列化任务失败: %w", err)
+	}
+	return []any{
+		task.TaskID,
+		task.DatePartition,
+		string(task.Status),
+		task.InputBucket,
+		task.InputKey,
+		task.CreatedAt.UnixNano(),
+		task.UpdatedAt.UnixNano(),
+		string(data),
+	}, nil
+}
+
+// CreateTask 创建任务（task_id 已存在时失败）
+func (s *SQLiteStore) CreateTask(ctx context.Context, task *TranscodeTask) error {
+	row, err := taskRow(task)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `INSERT INTO tasks
+		(task_id, date_partition, status, input_bucket, input_key, created_at, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (task_id) DO NOTHING`, row...)
+	if err != nil {
+		return fmt.Errorf("保存任务到SQLite失败: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: %s", ErrTaskExists, task.TaskID)
+	}
+	return nil
+}
+
+// SaveTask 整体写入任务
+func (s *SQLiteStore) SaveTask(ctx context.Context, task *TranscodeTask) error {
+	row, err := taskRow(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT OR REPLACE INTO tasks
+		(task_id, date_partition, status, input_bucket, input_key, created_at, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, row...)
+	if err != nil {
+		return fmt.Errorf("保存任务到SQLite失败: %w", err)
+	}
+	return nil
+}
+
+// GetTask 根据ID获取任务
+func (s *SQLiteStore) GetTask(ctx context.Context, taskID string) (*TranscodeTask, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM tasks WHERE task_id = ?`, taskID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, notFoundError(taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("从SQLite获取任务失败: %w", err)
+	}
+
+	var task TranscodeTask
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return nil, fmt.Errorf("反序列化任务失败: %w", err)
+	}
+	return &task, nil
+}
+
+// UpdateTask 字段级条件更新
+// 在同一个写事务中完成读取、条件检查和写回，_txlock=immediate 保证跨进程互斥
+func (s *SQLiteStore) UpdateTask(ctx context.Context, taskID string, update *TaskUpdate) (*TranscodeTask, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启SQLite事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT data FROM tasks WHERE task_id = ?`, taskID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, notFoundError(taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("从SQLite获取任务失败: %w", err)
+	}
+
+	var task TranscodeTask
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return nil, fmt.Errorf("反序列化任务失败: %w", err)
+	}
+
+	if err := update.checkCondition(&task); err != nil {
+		return nil, err
+	}
+	update.apply(&task, time.Now())
+
+	row, err := taskRow(&task)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO tasks
+		(task_id, date_partition, status, input_bucket, input_key, created_at, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, row...); err != nil {
+		return nil, fmt.Errorf("保存任务到SQLite失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交SQLite事务失败: %w", err)
+	}
+	return &task, nil
+}
+
+// ClaimIdempotencyKey 登记幂等键，键不存在或已过期时登记为 taskID，返回键当前对应的任务ID
+// 同时清理已过期的键
+func (s *SQLiteStore) ClaimIdempotencyKey(ctx context.Context, key, taskID string, expiresAt time.Time) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("开启SQLite事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, now); err != nil {
+		return "", fmt.Errorf("清理过期幂等键失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO idempotency_keys (idempotency_key, task_id, expires_at)
+		VALUES (?, ?, ?) ON CONFLICT (idempotency_key) DO NOTHING`, key, taskID, expiresAt.UnixNano()); err != nil {
+		return "", fmt.Errorf("登记幂等键失败: %w", err)
+	}
+
+	var claimed string
+	if err := tx.QueryRowContext(ctx, `SELECT task_id FROM idempotency_keys WHERE idempotency_key = ?`, key).Scan(&claimed); err != nil {
+		return "", fmt.Errorf("查询幂等键失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("提交SQLite事务失败: %w", err)
+	}
+	return claimed, nil
+}
+
+// whereClause 根据过滤条件构造 WHERE 条件
+func (s *SQLiteStore) whereClause(filter TaskFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if from, to, ok := filter.dateRange(); ok {
+		conditions = append(conditions, "date_partition BETWEEN ? AND ?")
+		args = append(args, from, to)
+	}
+	if filter.KeyPrefix != "" {
+		// substr 按字符计数且区分大小写（LIKE 对 ASCII 不区分大小写）
+		conditions = append(conditions, "substr(input_key, 1, ?) = ?")
+		args = append(args, utf8.RuneCountInString(filter.KeyPrefix), filter.KeyPrefix)
+	}
+	if filter.TranscodeType != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(data, '$.transcode_types') WHERE value = ?)")
+		args = append(args, filter.TranscodeType)
+	}
+	if filter.CreatedBy != "" {
+		conditions = append(conditions, "json_extract(data, '$.created_by') = ?")
+		args = append(args, filter.CreatedBy)
+	}
+	if filter.ErrorStage != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(data, '$.error_stages') WHERE value = ?)")
+		args = append(args, filter.ErrorStage)
+	}
+
+	return conditions, args
+}
+
+// joinWhere 拼接 WHERE 子句
+func joinWhere(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// ListTasks 按条件获取一页任务（按创建时间倒序，基于 created_at + task_id 的键集分页）
+func (s *SQLiteStore) ListTasks(ctx context.Context, filter TaskFilter, limit int, cursorValue string) (*TaskPage, error) {
+	if _, err := filter.datePartitions(); err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(filter, cursorValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	conditions, args := s.whereClause(filter)
+	if cursor != nil {
+		conditions = append(conditions, "(created_at < ? OR (created_at = ? AND task_id < ?))")
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.TaskID)
+	}
+	// 多取一条用于判断是否还有下一页
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM tasks`+joinWhere(conditions)+` ORDER BY created_at DESC, task_id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []TranscodeTask{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("读取任务失败: %w", err)
+		}
+		var task TranscodeTask
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return nil, fmt.Errorf("反序列化任务失败: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+
+	page := &TaskPage{Tasks: tasks}
+	if len(tasks) > limit {
+		page.Tasks = tasks[:limit]
+		last := page.Tasks[limit-1]
+		page.NextCursor = encodeCursor(filter, &listCursor{
+			CreatedAt: last.CreatedAt.UnixNano(),
+			TaskID:    last.TaskID,
+		})
+	}
+	return page, nil
+}
+
+// CountTasks 按条件统计任务数量
+func (s *SQLiteStore) CountTasks(ctx context.Context, filter TaskFilter) (int, error) {
+	if _, err := filter.datePartitions(); err != nil {
+		return 0, err
+	}
+	conditions, args := s.whereClause(filter)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tasks`+joinWhere(conditions), args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("统计任务失败: %w", err)
+	}
+	return total, nil
+}
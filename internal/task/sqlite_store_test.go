@@ -0,0 +1,252 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteStore 在临时目录中创建 SQLite 任务存储
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tasks.db"))
+	if err != nil {
+		t.Fatalf("创建SQLite存储失败: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// createTestTask 创建指定创建时间和状态的任务
+func createTestTask(t *testing.T, store TaskStore, taskID string, createdAt time.Time, status TaskStatus) *TranscodeTask {
+	t.Helper()
+	task := newTask(taskID, "input", "videos/"+taskID+".mp4", "output", []string{"mp4_720p"}, "tester", "")
+	task.DatePartition = createdAt.Format(dateLayout)
+	task.CreatedAt = createdAt
+	task.UpdatedAt = createdAt
+	task.Status = status
+	if err := store.CreateTask(context.Background(), task); err != nil {
+		t.Fatalf("创建任务失败: %v", err)
+	}
+	return task
+}
+
+func TestSQLiteStoreUpdateTaskVersion(t *testing.T) {
+	ctx := context.Background()
+	processing := TaskStatusProcessing
+	version := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name        string
+		taskID      string
+		update      *TaskUpdate
+		wantErr     error
+		wantVersion int64 // 操作后任务的版本
+		wantStatus  TaskStatus
+	}{
+		{
+			name:        "版本匹配时更新并递增版本",
+			taskID:      "task-1",
+			update:      &TaskUpdate{Status: &processing, ExpectVersion: version(1)},
+			wantVersion: 2,
+			wantStatus:  TaskStatusProcessing,
+		},
+		{
+			name:        "未指定版本时不检查",
+			taskID:      "task-1",
+			update:      &TaskUpdate{Status: &processing},
+			wantVersion: 2,
+			wantStatus:  TaskStatusProcessing,
+		},
+		{
+			name:        "版本过期时返回冲突且不修改任务",
+			taskID:      "task-1",
+			update:      &TaskUpdate{Status: &processing, ExpectVersion: version(5)},
+			wantErr:     ErrConditionFailed,
+			wantVersion: 1,
+			wantStatus:  TaskStatusPending,
+		},
+		{
+			name:    "任务不存在",
+			taskID:  "missing",
+			update:  &TaskUpdate{Status: &processing, ExpectVersion: version(1)},
+			wantErr: ErrTaskNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestSQLiteStore(t)
+			createTestTask(t, store, "task-1", time.Now(), TaskStatusPending)
+
+			updated, err := store.UpdateTask(ctx, tt.taskID, tt.update)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateTask() error = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(tt.wantErr, ErrConditionFailed) {
+				var conflict *ConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("冲突错误应为 *ConflictError: %T", err)
+				}
+				if conflict.ExpectedVersion != *tt.update.ExpectVersion || conflict.CurrentVersion != 1 {
+					t.Errorf("冲突信息不符: %+v", conflict)
+				}
+			}
+			if err == nil && (updated.Version != tt.wantVersion || updated.Status != tt.wantStatus) {
+				t.Errorf("返回的任务版本 %d 状态 %s，期望版本 %d 状态 %s", updated.Version, updated.Status, tt.wantVersion, tt.wantStatus)
+			}
+			if errors.Is(tt.wantErr, ErrTaskNotFound) {
+				return
+			}
+
+			stored, err := store.GetTask(ctx, tt.taskID)
+			if err != nil {
+				t.Fatalf("获取任务失败: %v", err)
+			}
+			if stored.Version != tt.wantVersion || stored.Status != tt.wantStatus {
+				t.Errorf("存储的任务版本 %d 状态 %s，期望版本 %d 状态 %s", stored.Version, stored.Status, tt.wantVersion, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSQLiteStoreUpdateTaskStaleWriter(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	createTestTask(t, store, "task-1", time.Now(), TaskStatusPending)
+
+	// 两个写入方基于同一版本更新，只有先提交的一方成功
+	expected := int64(1)
+	processing, cancelled := TaskStatusProcessing, TaskStatusCancelled
+	if _, err := store.UpdateTask(ctx, "task-1", &TaskUpdate{Status: &processing, ExpectVersion: &expected}); err != nil {
+		t.Fatalf("第一次更新失败: %v", err)
+	}
+	_, err := store.UpdateTask(ctx, "task-1", &TaskUpdate{Status: &cancelled, ExpectVersion: &expected})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("第二次更新应返回 *ConflictError，实际: %v", err)
+	}
+	if conflict.CurrentVersion != 2 || conflict.CurrentStatus != TaskStatusProcessing {
+		t.Errorf("冲突信息应反映第一次更新后的任务: %+v", conflict)
+	}
+}
+
+func TestSQLiteStoreListTasksPagination(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+
+	base := time.Date(2025, 1, 15, 12, 0, 0, 0, time.Local)
+	createTestTask(t, store, "task-a", base, TaskStatusCompleted)
+	createTestTask(t, store, "task-b", base.Add(time.Minute), TaskStatusFailed)
+	// task-c 与 task-d 创建时间相同，按 task_id 倒序排列
+	createTestTask(t, store, "task-c", base.Add(2*time.Minute), TaskStatusCompleted)
+	createTestTask(t, store, "task-d", base.Add(2*time.Minute), TaskStatusCompleted)
+	createTestTask(t, store, "task-e", base.AddDate(0, 0, 1), TaskStatusCompleted)
+
+	tests := []struct {
+		name      string
+		filter    TaskFilter
+		limit     int
+		wantPages [][]string
+	}{
+		{
+			name:      "按创建时间倒序分页",
+			limit:     2,
+			wantPages: [][]string{{"task-e", "task-d"}, {"task-c", "task-b"}, {"task-a"}},
+		},
+		{
+			name:      "数量恰好整除时最后一页没有游标",
+			limit:     5,
+			wantPages: [][]string{{"task-e", "task-d", "task-c", "task-b", "task-a"}},
+		},
+		{
+			name:      "按状态过滤",
+			filter:    TaskFilter{Status: string(TaskStatusCompleted)},
+			limit:     1,
+			wantPages: [][]string{{"task-e"}, {"task-d"}, {"task-c"}, {"task-a"}},
+		},
+		{
+			name:      "按日期过滤",
+			filter:    TaskFilter{Date: "2025-01-15"},
+			limit:     3,
+			wantPages: [][]string{{"task-d", "task-c", "task-b"}, {"task-a"}},
+		},
+		{
+			name:      "limit 为 0 时使用默认页大小",
+			limit:     0,
+			wantPages: [][]string{{"task-e", "task-d", "task-c", "task-b", "task-a"}},
+		},
+		{
+			name:      "limit 为负数时使用默认页大小",
+			limit:     -1,
+			wantPages: [][]string{{"task-e", "task-d", "task-c", "task-b", "task-a"}},
+		},
+		{
+			name:      "没有匹配的任务",
+			filter:    TaskFilter{Status: string(TaskStatusRetrying)},
+			limit:     2,
+			wantPages: [][]string{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages [][]string
+			cursor := ""
+			for {
+				page, err := store.ListTasks(ctx, tt.filter, tt.limit, cursor)
+				if err != nil {
+					t.Fatalf("ListTasks() error = %v", err)
+				}
+				ids := []string{}
+				for _, task := range page.Tasks {
+					ids = append(ids, task.TaskID)
+				}
+				pages = append(pages, ids)
+				if page.NextCursor == "" || len(pages) > len(tt.wantPages) {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			if !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("分页结果 = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestSQLiteStoreListTasksInvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	base := time.Now()
+	for _, taskID := range []string{"task-a", "task-b"} {
+		createTestTask(t, store, taskID, base, TaskStatusCompleted)
+	}
+
+	page, err := store.ListTasks(ctx, TaskFilter{}, 1, "")
+	if err != nil {
+		t.Fatalf("ListTasks() error = %v", err)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("应返回下一页游标")
+	}
+
+	tests := []struct {
+		name   string
+		filter TaskFilter
+		cursor string
+	}{
+		{name: "格式错误", cursor: "not-a-cursor!"},
+		{name: "查询条件已变化", filter: TaskFilter{Status: string(TaskStatusCompleted)}, cursor: page.NextCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.ListTasks(ctx, tt.filter, 1, tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ListTasks() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition 状态迁移不合法，具体信息见 *TransitionError
+var ErrInvalidTransition = errors.New("不允许的任务状态迁移")
+
+// ErrRetriesExhausted 自动重试次数已达到任务的 MaxRetries
+var ErrRetriesExhausted = errors.New("已达到最大重试次数")
+
+// ErrDuplicateMessage 任务正由另一条队列消息处理
+var ErrDuplicateMessage = errors.New("任务正由其他消息处理")
+
+// transitions 任务状态迁移表：当前状态 -> 允许迁移到的状态
+//
+//	pending/retrying -> processing（处理器开始处理）、cancelled（用户取消）
+//	processing       -> processing（消息重新投递后继续处理）、completed、failed、aborted（用户中止）、
+//	                    retrying（临时故障后自动重试）
+//	completed/failed/aborted/cancelled -> retrying（重新运行）
+var transitions = map[TaskStatus][]TaskStatus{
+	TaskStatusPending:    {TaskStatusProcessing, TaskStatusCancelled},
+	TaskStatusRetrying:   {TaskStatusProcessing, TaskStatusCancelled},
+	TaskStatusProcessing: {TaskStatusProcessing, TaskStatusCompleted, TaskStatusFailed, TaskStatusAborted, TaskStatusRetrying},
+	TaskStatusCompleted:  {TaskStatusRetrying},
+	TaskStatusFailed:     {TaskStatusRetrying},
+	TaskStatusAborted:    {TaskStatusRetrying},
+	TaskStatusCancelled:  {TaskStatusRetrying},
+}
+
+// TransitionError 状态迁移被状态机拒绝
+type TransitionError struct {
+	TaskID string
+	From   TaskStatus
+	To     TaskStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%v: 任务 %s 当前状态为 %s，不能变为 %s", ErrInvalidTransition, e.TaskID, e.From, e.To)
+}
+
+// Is 使 errors.Is(err, ErrInvalidTransition) 成立
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// CanTransition 判断是否允许从 from 迁移到 to
+func CanTransition(from, to TaskStatus) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal 是否为终态（只能通过重新运行离开）
+func (s TaskStatus) IsTerminal() bool {
+	switch s {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusAborted, TaskStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// checkTransition 校验任务从当前状态迁移到 to 是否合法
+func checkTransition(task *TranscodeTask, to TaskStatus) error {
+	if !CanTransition(task.Status, to) {
+		return &TransitionError{TaskID: task.TaskID, From: task.Status, To: to}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// allStatuses 所有任务状态
+var allStatuses = []TaskStatus{
+	TaskStatusPending,
+	TaskStatusProcessing,
+	TaskStatusCompleted,
+	TaskStatusFailed,
+	TaskStatusRetrying,
+	TaskStatusCancelled,
+	TaskStatusAborted,
+}
+
+func TestCanTransition(t *testing.T) {
+	// 允许的迁移，未列出的组合都应被拒绝
+	allowed := map[TaskStatus][]TaskStatus{
+		TaskStatusPending:    {TaskStatusProcessing, TaskStatusCancelled},
+		TaskStatusRetrying:   {TaskStatusProcessing, TaskStatusCancelled},
+		TaskStatusProcessing: {TaskStatusProcessing, TaskStatusCompleted, TaskStatusFailed, TaskStatusAborted, TaskStatusRetrying},
+		TaskStatusCompleted:  {TaskStatusRetrying},
+		TaskStatusFailed:     {TaskStatusRetrying},
+		TaskStatusAborted:    {TaskStatusRetrying},
+		TaskStatusCancelled:  {TaskStatusRetrying},
+	}
+
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := false
+			for _, status := range allowed[from] {
+				if status == to {
+					want = true
+				}
+			}
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	if CanTransition("unknown", TaskStatusProcessing) {
+		t.Error("未知状态不应允许任何迁移")
+	}
+}
+
+func TestTaskStatusIsTerminal(t *testing.T) {
+	tests := []struct {
+		status TaskStatus
+		want   bool
+	}{
+		{TaskStatusPending, false},
+		{TaskStatusProcessing, false},
+		{TaskStatusRetrying, false},
+		{TaskStatusCompleted, true},
+		{TaskStatusFailed, true},
+		{TaskStatusAborted, true},
+		{TaskStatusCancelled, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.want {
+			t.Errorf("%s.IsTerminal() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestManagerTransitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       TaskStatus
+		action     func(m *Manager) error
+		wantErr    error
+		wantStatus TaskStatus
+	}{
+		{
+			name: "取消待处理的任务",
+			from: TaskStatusPending,
+			action: func(m *Manager) error {
+				_, err := m.CancelTask("task-1", 0, "用户取消")
+				return err
+			},
+			wantStatus: TaskStatusCancelled,
+		},
+		{
+			name: "处理中的任务不能取消",
+			from: TaskStatusProcessing,
+			action: func(m *Manager) error {
+				_, err := m.CancelTask("task-1", 0, "用户取消")
+				return err
+			},
+			wantErr:    ErrInvalidTransition,
+			wantStatus: TaskStatusProcessing,
+		},
+		{
+			name: "中止处理中的任务",
+			from: TaskStatusProcessing,
+			action: func(m *Manager) error {
+				_, err := m.AbortTask("task-1", 0, "用户中止")
+				return err
+			},
+			wantStatus: TaskStatusAborted,
+		},
+		{
+			name: "已中止的任务不会被迟到的完成状态覆盖",
+			from: TaskStatusAborted,
+			action: func(m *Manager) error {
+				return m.UpdateTaskStatus("task-1", TaskStatusCompleted, "")
+			},
+			wantErr:    ErrInvalidTransition,
+			wantStatus: TaskStatusAborted,
+		},
+		{
+			name: "已完成的任务可以重新运行",
+			from: TaskStatusCompleted,
+			action: func(m *Manager) error {
+				_, err := m.RetryTask("task-1", 0)
+				return err
+			},
+			wantStatus: TaskStatusRetrying,
+		},
+		{
+			name: "处理中的任务不能手动重试",
+			from: TaskStatusProcessing,
+			action: func(m *Manager) error {
+				_, err := m.RetryTask("task-1", 0)
+				return err
+			},
+			wantErr:    ErrInvalidTransition,
+			wantStatus: TaskStatusProcessing,
+		},
+		{
+			name: "已取消的任务不能开始处理",
+			from: TaskStatusCancelled,
+			action: func(m *Manager) error {
+				_, err := m.StartProcessing("task-1", "message-1")
+				return err
+			},
+			wantErr:    ErrInvalidTransition,
+			wantStatus: TaskStatusCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, store := newTestManager(t)
+			createTestTask(t, store, "task-1", time.Now(), tt.from)
+
+			if err := tt.action(manager); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			task, err := manager.GetTask("task-1")
+			if err != nil {
+				t.Fatalf("获取任务失败: %v", err)
+			}
+			if task.Status != tt.wantStatus {
+				t.Errorf("任务状态 = %s, want %s", task.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// 任务存储后端类型
+const (
+	StoreBackendDynamoDB = "dynamodb" // AWS DynamoDB（默认）
+	StoreBackendSQLite   = "sqlite"   // 嵌入式 SQLite，适合单机部署
+)
+
+var (
+	// ErrTaskNotFound 任务不存在
+	ErrTaskNotFound = errors.New("任务不存在")
+	// ErrTaskExists 任务已存在（创建时 ID 冲突）
+	ErrTaskExists = errors.New("任务已存在")
+)
+
+// TaskFilter 任务列表过滤条件，空字段表示不过滤
+type TaskFilter struct {
+	Status   string
+	Date     string // 单个日期分区，格式: 2025-01-15（优先于日期范围）
+	DateFrom string // 日期范围开始（含）
+	DateTo   string // 日期范围结束（含），为空表示今天
+
+	KeyPrefix     string // 输入文件 key 前缀
+	TranscodeType string // 包含的转码类型
+	CreatedBy     string // 创建者用户名
+	ErrorStage    string // 出过错的阶段（download/transcode/upload 等）
+}
+
+// TaskStore 任务持久化接口
+// 列表结果统一按创建时间倒序返回，使用不透明游标分页
+type TaskStore interface {
+	// CreateTask 创建任务，ID 已存在时返回 ErrTaskExists
+	CreateTask(ctx context.Context, task *TranscodeTask) error
+	// GetTask 获取任务，不存在时返回 ErrTaskNotFound
+	GetTask(ctx context.Context, taskID string) (*TranscodeTask, error)
+	// SaveTask 整体写入任务（创建或覆盖）
+	SaveTask(ctx context.Context, task *TranscodeTask) error
+	// UpdateTask 原子地检查前置条件并更新指定字段，返回更新后的任务
+	// 任务不存在时返回 ErrTaskNotFound，条件不满足时返回 ErrConditionFailed
+	UpdateTask(ctx context.Context, taskID string, update *TaskUpdate) (*TranscodeTask, error)
+	// ListTasks 按条件获取一页任务，cursor 为上一页返回的 NextCursor（第一页传空），
+	// 游标无效时返回 ErrInvalidCursor
+	ListTasks(ctx context.Context, filter TaskFilter, limit int, cursor string) (*TaskPage, error)
+	// CountTasks 按条件统计任务数量（需要遍历索引，仅在调用方需要总数时使用）
+	CountTasks(ctx context.Context, filter TaskFilter) (int, error)
+	// ClaimIdempotencyKey 原子地登记幂等键：键不存在或已过期时登记为 taskID，
+	// 否则保持原登记不变；返回键当前对应的任务ID
+	ClaimIdempotencyKey(ctx context.Context, key, taskID string, expiresAt time.Time) (string, error)
+	// Backend 返回后端类型，用于日志展示
+	Backend() string
+}
+
+// notFoundError 构造带任务ID的 ErrTaskNotFound
+func notFoundError(taskID string) error {
+	return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+}
+
+// NewStore 根据后端类型创建任务存储
+func NewStore(backend string, dynamoClient *dynamodb.Client, tableName, sqlitePath string) (TaskStore, error) {
+	switch backend {
+	case "", StoreBackendDynamoDB:
+		if dynamoClient == nil {
+			return nil, fmt.Errorf("DynamoDB 任务存储需要 DynamoDB 客户端")
+		}
+		return NewDynamoStore(dynamoClient, tableName), nil
+	case StoreBackendSQLite:
+		return NewSQLiteStore(sqlitePath)
+	default:
+		return nil, fmt.Errorf("未知的任务存储后端: %s", backend)
+	}
+}
@@ -0,0 +1,177 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConditionFailed 条件更新失败（任务版本或状态不满足更新前置条件）
+// 具体信息见 *ConflictError，可用 errors.Is(err, ErrConditionFailed) 判断
+var ErrConditionFailed = errors.New("任务状态已变化，更新条件不满足")
+
+// ConflictError 并发冲突：任务在调用方读取之后已被其他写入方修改
+type ConflictError struct {
+	TaskID          string
+	ExpectedVersion int64 // 调用方期望的版本，0 表示未指定
+	CurrentVersion  int64
+	CurrentStatus   TaskStatus
+}
+
+func (e *ConflictError) Error() string {
+	if e.ExpectedVersion > 0 && e.ExpectedVersion != e.CurrentVersion {
+		return fmt.Sprintf("%v: 任务 %s 期望版本 %d，当前版本 %d（状态 %s）",
+			ErrConditionFailed, e.TaskID, e.ExpectedVersion, e.CurrentVersion, e.CurrentStatus)
+	}
+	return fmt.Sprintf("%v: 任务 %s 当前状态为 %s（版本 %d）", ErrConditionFailed, e.TaskID, e.CurrentStatus, e.CurrentVersion)
+}
+
+// Is 使 errors.Is(err, ErrConditionFailed) 成立
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConditionFailed
+}
+
+// conflictError 根据任务当前状态构造冲突错误
+func conflictError(task *TranscodeTask, expectedVersion int64) *ConflictError {
+	return &ConflictError{
+		TaskID:          task.TaskID,
+		ExpectedVersion: expectedVersion,
+		CurrentVersion:  task.Version,
+		CurrentStatus:   task.Status,
+	}
+}
+
+// TaskUpdate 任务字段级更新
+// 只修改非空字段，存储实现需保证“检查条件 + 修改字段 + 版本号加一”是原子操作，
+// 避免 API 与处理器并发写同一任务时互相覆盖
+type TaskUpdate struct {
+	Status        *TaskStatus
+	ErrorMessage  *string // 指向空字符串时清除错误信息
+	StartedAt     *time.Time
+	KeepStartedAt bool // 为 true 时仅在 started_at 不存在时写入 StartedAt
+	CompletedAt   *time.Time
+	ClearTimes    bool       // 清除 started_at 和 completed_at（重试时使用）
+	MessageID     *string    // 开始处理该任务的队列消息ID
+	MediaInfo     *MediaInfo // 输入文件的媒体信息
+
+	Progress             map[string]string         // 按转码类型更新进度，未列出的类型保持不变
+	ProgressDetails      map[string]ProgressDetail // 按转码类型更新实时进度
+	ResetProgressDetails bool                      // 清空实时进度后再写入 ProgressDetails
+	OutputFiles          map[string]string         // 按转码类型更新输出文件
+	ResetOutputFiles     bool                      // 清空输出文件映射
+	AppendErrors         []ErrorDetail             // 追加错误详情
+	ClearErrorDetails    bool                      // 清空错误详情
+	IncrementRetry       bool                      // retry_count 加一
+	ResetRetryCount      bool                      // retry_count 清零（手动重试、重新投递时使用），优先于 IncrementRetry
+
+	// ExpectVersion 前置条件：任务当前版本必须等于该值，nil 表示不检查
+	ExpectVersion *int64
+	// ExpectStatus 前置条件：任务当前状态必须为其中之一，为空表示不检查
+	ExpectStatus []TaskStatus
+}
+
+// checkCondition 检查前置条件（供非 DynamoDB 的存储实现使用）
+func (u *TaskUpdate) checkCondition(task *TranscodeTask) error {
+	if u.ExpectVersion != nil && task.Version != *u.ExpectVersion {
+		return conflictError(task, *u.ExpectVersion)
+	}
+	if len(u.ExpectStatus) == 0 {
+		return nil
+	}
+	for _, status := range u.ExpectStatus {
+		if task.Status == status {
+			return nil
+		}
+	}
+	return conflictError(task, 0)
+}
+
+// apply 将更新应用到任务对象（供非 DynamoDB 的存储实现使用）
+func (u *TaskUpdate) apply(task *TranscodeTask, now time.Time) {
+	task.UpdatedAt = now
+	task.Version++
+
+	if u.Status != nil {
+		task.Status = *u.Status
+	}
+	if u.ErrorMessage != nil {
+		task.ErrorMessage = *u.ErrorMessage
+	}
+	if u.MessageID != nil {
+		task.MessageID = *u.MessageID
+	}
+	if u.MediaInfo != nil {
+		task.MediaInfo = u.MediaInfo
+	}
+	if u.ClearTimes {
+		task.StartedAt = nil
+		task.CompletedAt = nil
+	}
+	if u.StartedAt != nil && (!u.KeepStartedAt || task.StartedAt == nil) {
+		startedAt := *u.StartedAt
+		task.StartedAt = &startedAt
+	}
+	if u.CompletedAt != nil {
+		completedAt := *u.CompletedAt
+		task.CompletedAt = &completedAt
+	}
+
+	if len(u.Progress) > 0 && task.Progress == nil {
+		task.Progress = make(map[string]string)
+	}
+	for transcodeType, progress := range u.Progress {
+		task.Progress[transcodeType] = progress
+	}
+
+	if u.ResetProgressDetails || task.ProgressDetails == nil {
+		task.ProgressDetails = make(map[string]ProgressDetail)
+	}
+	for transcodeType, detail := range u.ProgressDetails {
+		task.ProgressDetails[transcodeType] = detail
+	}
+
+	if u.ResetOutputFiles || task.OutputFiles == nil {
+		task.OutputFiles = make(map[string]string)
+	}
+	for transcodeType, outputKey := range u.OutputFiles {
+		task.OutputFiles[transcodeType] = outputKey
+	}
+
+	if u.ClearErrorDetails {
+		task.ErrorDetails = nil
+		task.ErrorStages = nil
+	}
+	task.ErrorDetails = append(task.ErrorDetails, u.AppendErrors...)
+	for _, stage := range u.errorStages() {
+		if !containsString(task.ErrorStages, stage) {
+			task.ErrorStages = append(task.ErrorStages, stage)
+		}
+	}
+
+	if u.ResetRetryCount {
+		task.RetryCount = 0
+	} else if u.IncrementRetry {
+		task.RetryCount++
+	}
+}
+
+// errorStages 追加的错误详情涉及的阶段（去重）
+func (u *TaskUpdate) errorStages() []string {
+	var stages []string
+	for _, detail := range u.AppendErrors {
+		if detail.Stage != "" && !containsString(stages, detail.Stage) {
+			stages = append(stages, detail.Stage)
+		}
+	}
+	return stages
+}
+
+// containsString 判断切片是否包含指定字符串
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
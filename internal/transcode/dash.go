@@ -0,0 +1,65 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// createDASHWithLog 按片源规划的码率阶梯编码并打包为 CMAF（fMP4）分段，同时生成 DASH 清单和 HLS 播放列表
+// 两种清单引用同一组分段，只存储一份；outputFile 为输出目录中的 DASH 清单，spec 决定视频、音频编码
+func (p *Processor) createDASHWithLog(ctx context.Context, input *transcodeInput, outputFile string, spec *PresetSpec, onProgress progressFunc) *TranscodeResult {
+	ladder := p.planLadder(ctx, input)
+	log.Printf("创建DASH/CMAF(%d 个档位): %s -> %s", len(ladder), input.file, outputFile)
+	args, err := p.buildDASHArgs(input, outputFile, ladder, spec)
+	if err != nil {
+		return &TranscodeResult{Error: fmt.Errorf("编译预设参数失败: %w", err)}
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	taskName := fmt.Sprintf("DASH/CMAF(%s %d档)", strings.ToUpper(spec.Video.Codec), len(ladder))
+	if p.gpuAvailable.Load() {
+		taskName += " [GPU加速]"
+	}
+	return p.runFFmpegCommandWithLog(ctx, cmd, taskName, onProgress)
+}
+
+// buildDASHArgs 构建 DASH/CMAF 参数：视频各档位组成一个自适应集，音频只编码一路，所有档位共用
+// （spec 未设置音频码率时取阶梯中最高的音频码率）；分段为 fMP4，
+// hls_playlist 使 DASH 封装器同时写出引用同一组分段的 HLS 播放列表
+func (p *Processor) buildDASHArgs(input *transcodeInput, outputFile string, ladder []Rendition, spec *PresetSpec) ([]string, error) {
+	hasAudio := spec.Audio != nil && (input.media == nil || input.media.AudioCodec != "")
+
+	args, err := p.buildLadderArgs(input, ladder, spec.Video)
+	if err != nil {
+		return nil, err
+	}
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		audio := *spec.Audio
+		if audio.Bitrate == 0 {
+			for _, rendition := range ladder {
+				audio.Bitrate = max(audio.Bitrate, rendition.AudioBitrate)
+			}
+		}
+		args = append(args, "-map", "0:a:0")
+		args = append(args, compileAudio(&audio)...)
+		adaptationSets += " id=1,streams=a"
+	}
+
+	args = append(args,
+		"-f", "dash",
+		"-seg_duration", strconv.Itoa(p.packaging.SegmentSeconds),
+		"-dash_segment_type", "mp4",
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", "init_$RepresentationID$.m4s",
+		"-media_seg_name", "chunk_$RepresentationID$_$Number%05d$.m4s",
+		"-hls_playlist", "1",
+		"-hls_master_name", segmentedPlaylists["m3u8"],
+		"-y", outputFile)
+	return args, nil
+}
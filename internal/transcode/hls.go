@@ -0,0 +1,214 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rendition 码率阶梯中的一个档位
+type Rendition struct {
+	Name         string `json:"name" dynamodbav:"name"`                   // 档位名称，用作输出子目录名，如 720p
+	Width        int    `json:"width" dynamodbav:"width"`                 // 最大宽度，按比例缩放到该范围内
+	Height       int    `json:"height" dynamodbav:"height"`               // 最大高度
+	VideoBitrate int    `json:"video_bitrate" dynamodbav:"video_bitrate"` // 视频码率（kbps）
+	AudioBitrate int    `json:"audio_bitrate" dynamodbav:"audio_bitrate"` // 音频码率（kbps）
+}
+
+// DefaultLadder 默认码率阶梯，从高到低；高于片源分辨率的档位在规划时去掉
+var DefaultLadder = []Rendition{
+	{Name: "2160p", Width: 3840, Height: 2160, VideoBitrate: 14000, AudioBitrate: 128},
+	{Name: "1440p", Width: 2560, Height: 1440, VideoBitrate: 8000, AudioBitrate: 128},
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5000, AudioBitrate: 128},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Width: 854, Height: 480, VideoBitrate: 1400, AudioBitrate: 96},
+	{Name: "360p", Width: 640, Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+// DefaultSegmentSeconds 默认分段时长（秒）
+const DefaultSegmentSeconds = 6
+
+// PackagingOptions 分段输出（HLS/DASH）的码率阶梯和分段时长
+type PackagingOptions struct {
+	Ladder         []Rendition
+	SegmentSeconds int
+}
+
+// SetPackagingOptions 设置分段输出的码率阶梯和分段时长，零值字段使用默认值
+// 需在开始处理任务之前调用
+func (p *Processor) SetPackagingOptions(options PackagingOptions) {
+	if len(options.Ladder) == 0 {
+		options.Ladder = DefaultLadder
+	}
+	if options.SegmentSeconds <= 0 {
+		options.SegmentSeconds = DefaultSegmentSeconds
+	}
+	p.packaging = options
+}
+
+// PackagingOptions 获取分段输出的码率阶梯和分段时长
+func (p *Processor) PackagingOptions() PackagingOptions {
+	return p.packaging
+}
+
+// renditionSpec 档位配置格式：宽x高:视频码率[/音频码率]，码率单位 kbps，可带 k 后缀
+var renditionSpec = regexp.MustCompile(`^(\d+)x(\d+):(\d+)k?(?:/(\d+)k?)?$`)
+
+// ParseLadder 解析逗号分隔的码率阶梯，如 "1920x1080:5000k/128k,1280x720:2800k"
+// 档位名称取高度（如 720p），未指定音频码率时为 128k
+func ParseLadder(spec string) ([]Rendition, error) {
+	var ladder []Rendition
+	names := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		match := renditionSpec.FindStringSubmatch(item)
+		if match == nil {
+			return nil, fmt.Errorf("无效的档位配置 %q，格式应为 宽x高:视频码率k[/音频码率k]", item)
+		}
+		rendition := Rendition{AudioBitrate: 128}
+		rendition.Width, _ = strconv.Atoi(match[1])
+		rendition.Height, _ = strconv.Atoi(match[2])
+		rendition.VideoBitrate, _ = strconv.Atoi(match[3])
+		if match[4] != "" {
+			rendition.AudioBitrate, _ = strconv.Atoi(match[4])
+		}
+		if rendition.Width <= 0 || rendition.Height <= 0 || rendition.VideoBitrate <= 0 || rendition.AudioBitrate <= 0 {
+			return nil, fmt.Errorf("无效的档位配置 %q，分辨率和码率必须大于 0", item)
+		}
+		rendition.Name = fmt.Sprintf("%dp", rendition.Height)
+		if names[rendition.Name] {
+			return nil, fmt.Errorf("档位 %s 重复", rendition.Name)
+		}
+		names[rendition.Name] = true
+		ladder = append(ladder, rendition)
+	}
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("码率阶梯不能为空")
+	}
+	return ladder, nil
+}
+
+// DescribeLadder 码率阶梯摘要，用于日志，如 1080p@5000k 720p@2800k
+func DescribeLadder(ladder []Rendition) string {
+	items := make([]string, 0, len(ladder))
+	for _, rendition := range ladder {
+		items = append(items, fmt.Sprintf("%s@%dk", rendition.Name, rendition.VideoBitrate))
+	}
+	return strings.Join(items, " ")
+}
+
+// createHLSWithLog 按片源规划的码率阶梯一次解码、缩放出所有档位并编码为 HLS
+// outputFile 为输出目录中的主播放列表，各档位写入以档位名称命名的子目录；
+// spec 决定视频、音频编码，码率和分辨率由码率阶梯决定
+func (p *Processor) createHLSWithLog(ctx context.Context, input *transcodeInput, outputFile string, spec *PresetSpec, onProgress progressFunc) *TranscodeResult {
+	ladder := p.planLadder(ctx, input)
+	log.Printf("创建HLS(%d 个档位): %s -> %s", len(ladder), input.file, outputFile)
+	args, err := p.buildHLSArgs(input, outputFile, ladder, spec)
+	if err != nil {
+		return &TranscodeResult{Error: fmt.Errorf("编译预设参数失败: %w", err)}
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	taskName := fmt.Sprintf("HLS(%s %d档)", strings.ToUpper(spec.Video.Codec), len(ladder))
+	if p.gpuAvailable.Load() {
+		taskName += " [GPU加速]"
+	}
+	return p.runFFmpegCommandWithLog(ctx, cmd, taskName, onProgress)
+}
+
+// buildHLSArgs 构建 HLS 参数：各档位的视频流和音频流通过 var_stream_map 组成独立的变体，
+// 每个变体写入以档位名称命名的子目录，FFmpeg 在上级目录生成主播放列表。
+// spec 未设置音频码率时各档位使用阶梯中的音频码率
+func (p *Processor) buildHLSArgs(input *transcodeInput, outputFile string, ladder []Rendition, spec *PresetSpec) ([]string, error) {
+	outputDir := filepath.Dir(outputFile)
+	hasAudio := spec.Audio != nil && (input.media == nil || input.media.AudioCodec != "")
+
+	args, err := p.buildLadderArgs(input, ladder, spec.Video)
+	if err != nil {
+		return nil, err
+	}
+	var streamMap []string
+	for i, rendition := range ladder {
+		entry := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			args = append(args, "-map", "0:a:0")
+			if spec.Audio.Bitrate == 0 {
+				args = append(args, fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", rendition.AudioBitrate))
+			}
+			entry += fmt.Sprintf(",a:%d", i)
+		}
+		streamMap = append(streamMap, entry+",name:"+rendition.Name)
+	}
+	if hasAudio {
+		args = append(args, compileAudio(spec.Audio)...)
+	}
+
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(p.packaging.SegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_type", "mpegts",
+		"-hls_segment_filename", filepath.Join(outputDir, "%v", "segment_%05d.ts"),
+		"-master_pl_name", filepath.Base(outputFile),
+		"-var_stream_map", strings.Join(streamMap, " "),
+		"-y", filepath.Join(outputDir, "%v", "index.m3u8"))
+	return args, nil
+}
+
+// buildLadderArgs 构建码率阶梯的输入和视频编码参数（HLS 和 DASH 共用）：
+// 一次解码后 split 出各档位分别缩放、编码，关键帧按分段时长对齐，
+// 使各档位的分段边界一致，播放器可在分段之间无缝切换档位；编码器和速度预设由 video 决定
+func (p *Processor) buildLadderArgs(input *transcodeInput, ladder []Rendition, video *VideoSpec) ([]string, error) {
+	encoder, err := p.platformInfo.EncoderFor(video.Codec)
+	if err != nil {
+		return nil, err
+	}
+	preset := video.Preset
+	if preset == "" {
+		preset = "fast"
+	}
+
+	args := []string{}
+	args = append(args, p.getHWAccelArgs()...)
+	args = append(args, "-i", input.file)
+	args = append(args, "-filter_complex", ladderFilter(ladder))
+
+	for i, rendition := range ladder {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		args = append(args,
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*3/2))
+	}
+
+	args = append(args, "-c:v", encoder)
+	args = append(args, p.getPresetArgs(preset)...)
+	args = append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", p.packaging.SegmentSeconds))
+	if strings.Contains(encoder, "nvenc") {
+		// NVENC 强制关键帧默认不是 IDR，分段无法独立解码
+		args = append(args, "-forced-idr", "1")
+	}
+	return args, nil
+}
+
+// ladderFilter 将视频流 split 为各档位并缩放到规划的分辨率，统一转为 8bit yuv420p
+func ladderFilter(ladder []Rendition) string {
+	var split strings.Builder
+	fmt.Fprintf(&split, "[0:v]split=%d", len(ladder))
+	chains := []string{}
+	for i, rendition := range ladder {
+		fmt.Fprintf(&split, "[s%d]", i)
+		chains = append(chains, fmt.Sprintf(
+			"[s%d]scale=w=%d:h=%d:force_original_aspect_ratio=decrease:force_divisible_by=2,format=yuv420p[v%d]",
+			i, rendition.Width, rendition.Height, i))
+	}
+	return split.String() + ";" + strings.Join(chains, ";")
+}
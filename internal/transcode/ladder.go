@@ -0,0 +1,293 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// 复杂度分析：从输入中均匀抽取几段，缩放到 360p 后用固定 CRF 快速编码，
+// 以得到的码率相对参考码率的比值作为片源复杂度。静态画面（录屏、幻灯片）远低于参考值，
+// 运动剧烈或噪点多的画面高于参考值
+const (
+	complexitySamples       = 4
+	complexitySampleSeconds = 3
+	// referenceComplexityKbps 普通实拍内容在分析参数下的码率
+	referenceComplexityKbps = 500
+	minComplexity           = 0.5
+	maxComplexity           = 1.8
+)
+
+// minPlannedBitrate 规划结果的最低视频码率（kbps）
+const minPlannedBitrate = 100
+
+// titlePlan 单个任务的片源复杂度，各转码类型共用，首次需要时计算
+type titlePlan struct {
+	once       sync.Once
+	complexity float64
+}
+
+// titleComplexity 返回输入的片源复杂度，同一任务只分析一次；无法分析时返回 1（按阶梯原码率）
+func (p *Processor) titleComplexity(ctx context.Context, input *transcodeInput) float64 {
+	input.plan.once.Do(func() {
+		input.plan.complexity = 1
+		if input.media == nil {
+			return
+		}
+		start := time.Now()
+		complexity, err := measureComplexity(ctx, input.file, input.duration)
+		if err != nil {
+			log.Printf("⚠️  片源复杂度分析失败，按阶梯原码率编码: %v", err)
+			return
+		}
+		input.plan.complexity = complexity
+		log.Printf("📈 片源复杂度: %.2f (分析耗时: %v)", complexity, time.Since(start).Round(time.Millisecond))
+	})
+	return input.plan.complexity
+}
+
+// planLadder 按片源规划码率阶梯：去掉高于片源分辨率的档位（不放大），
+// 片源介于两个档位之间时补一个片源分辨率的档位，码率按实际像素数、帧率和复杂度调整
+func (p *Processor) planLadder(ctx context.Context, input *transcodeInput) []Rendition {
+	ladder := p.packaging.Ladder
+	if input.media == nil || input.media.Width <= 0 || input.media.Height <= 0 {
+		return ladder
+	}
+	planned := planLadder(input.media, p.titleComplexity(ctx, input), ladder)
+	log.Printf("📐 码率阶梯规划: %s -> %s", DescribeLadder(ladder), DescribeLadder(planned))
+	return planned
+}
+
+// planRendition 按片源规划单个目标档位（结构化预设和带占位符的原始参数预设使用）
+func (p *Processor) planRendition(ctx context.Context, input *transcodeInput, target Rendition) Rendition {
+	if input.media == nil || input.media.Width <= 0 || input.media.Height <= 0 {
+		return target
+	}
+	planned := planRendition(input.media, p.titleComplexity(ctx, input), target)
+	log.Printf("📐 档位规划: %dx%d@%dk -> %dx%d@%dk", target.Width, target.Height, target.VideoBitrate, planned.Width, planned.Height, planned.VideoBitrate)
+	return planned
+}
+
+// presetTarget 自定义预设的目标档位，未设置时使用码率阶梯中的最高档
+func (p *Processor) presetTarget(preset *TranscodePreset) Rendition {
+	if preset.Target != nil {
+		return *preset.Target
+	}
+	return p.packaging.Ladder[0]
+}
+
+// planSpec 按片源规划结构化参数：启用 PerTitle 的 fit 策略按规划的档位确定宽高和码率，
+// 返回副本，不修改预设本身（内置预设为共享数据）
+func (p *Processor) planSpec(ctx context.Context, input *transcodeInput, spec *PresetSpec) *PresetSpec {
+	if spec.Video == nil || spec.Video.Resolution.Mode != ResolutionFit || !spec.Video.Resolution.PerTitle {
+		return spec
+	}
+	planned := *spec
+	video := *spec.Video
+	planned.Video = &video
+
+	rc := &video.RateControl
+	bitrate := rc.MaxRate
+	if rc.Mode == RateControlBitrate {
+		bitrate = rc.Bitrate
+	}
+	rendition := p.planRendition(ctx, input, Rendition{
+		Width:        video.Resolution.Width,
+		Height:       video.Resolution.Height,
+		VideoBitrate: max(bitrate, 1),
+	})
+	video.Resolution.Width, video.Resolution.Height = rendition.Width, rendition.Height
+	if bitrate > 0 {
+		// 缓冲区和峰值码率按同一比例调整
+		scale := func(rate int) int { return rate * rendition.VideoBitrate / bitrate }
+		rc.Bitrate, rc.MaxRate, rc.BufSize = scale(rc.Bitrate), scale(rc.MaxRate), scale(rc.BufSize)
+	}
+	return &planned
+}
+
+// planLadder 见 (*Processor).planLadder
+func planLadder(media *task.MediaInfo, complexity float64, ladder []Rendition) []Rendition {
+	sourceWidth, sourceHeight := displaySize(media)
+	sourceShort := min(sourceWidth, sourceHeight)
+
+	rungs := append([]Rendition(nil), ladder...)
+	sort.SliceStable(rungs, func(i, j int) bool {
+		return min(rungs[i].Width, rungs[i].Height) > min(rungs[j].Width, rungs[j].Height)
+	})
+
+	var planned []Rendition
+	var above *Rendition // 高于片源的最小档位
+	for i := range rungs {
+		if min(rungs[i].Width, rungs[i].Height) > sourceShort {
+			above = &rungs[i]
+			continue
+		}
+		planned = append(planned, planRendition(media, complexity, rungs[i]))
+	}
+	// 片源比保留的最高档位高出 15% 以上（如 900p 片源只剩 720p），用上一档的码率编码片源分辨率
+	if above != nil && (len(planned) == 0 || sourceShort*100 > min(planned[0].Width, planned[0].Height)*115) {
+		planned = append([]Rendition{planRendition(media, complexity, *above)}, planned...)
+	}
+
+	// 分辨率相同的档位只保留码率最高的一个
+	names := make(map[string]bool)
+	result := planned[:0]
+	for _, rendition := range planned {
+		if !names[rendition.Name] {
+			names[rendition.Name] = true
+			result = append(result, rendition)
+		}
+	}
+	return result
+}
+
+// planRendition 将目标档位按比例适配到片源：竖屏片源交换目标宽高，只缩小不放大，宽高取偶数；
+// 码率按实际像素数与目标像素数之比（0.75 次方）、帧率和复杂度调整
+func planRendition(media *task.MediaInfo, complexity float64, target Rendition) Rendition {
+	sourceWidth, sourceHeight := displaySize(media)
+	boxWidth, boxHeight := target.Width, target.Height
+	if (sourceHeight > sourceWidth) != (boxHeight > boxWidth) {
+		boxWidth, boxHeight = boxHeight, boxWidth
+	}
+
+	scale := math.Min(1, math.Min(float64(boxWidth)/float64(sourceWidth), float64(boxHeight)/float64(sourceHeight)))
+	width := max(2, int(float64(sourceWidth)*scale)/2*2)
+	height := max(2, int(float64(sourceHeight)*scale)/2*2)
+
+	pixelRatio := float64(width*height) / float64(target.Width*target.Height)
+	bitrate := float64(target.VideoBitrate) * math.Pow(pixelRatio, 0.75) * frameRateFactor(media.FrameRate) * complexity
+	bitrate = math.Max(minPlannedBitrate, math.Round(bitrate/10)*10)
+
+	return Rendition{
+		Name:         fmt.Sprintf("%dp", min(width, height)),
+		Width:        width,
+		Height:       height,
+		VideoBitrate: int(bitrate),
+		AudioBitrate: target.AudioBitrate,
+	}
+}
+
+// displaySize 返回按旋转角度校正后的显示宽高（FFmpeg 默认自动旋转）
+func displaySize(media *task.MediaInfo) (int, int) {
+	if media.Rotation == 90 || media.Rotation == 270 {
+		return media.Height, media.Width
+	}
+	return media.Width, media.Height
+}
+
+// frameRateFactor 以 30fps 为基准的码率系数，60fps 约 1.4 倍，24fps 约 0.9 倍
+func frameRateFactor(frameRate float64) float64 {
+	if frameRate <= 0 {
+		return 1
+	}
+	return math.Sqrt(math.Min(2, math.Max(0.5, frameRate/30)))
+}
+
+// fitFilter 按比例缩放到档位范围内的滤镜，片源小于档位时保持原尺寸（不放大、不加黑边）
+func fitFilter(rendition Rendition) string {
+	return fmt.Sprintf("scale=w='min(%d,iw)':h='min(%d,ih)':force_original_aspect_ratio=decrease:force_divisible_by=2",
+		rendition.Width, rendition.Height)
+}
+
+// measureComplexity 复杂度分析，返回 [minComplexity, maxComplexity] 范围内的复杂度
+func measureComplexity(ctx context.Context, inputFile string, duration time.Duration) (float64, error) {
+	var totalBytes int64
+	var totalSeconds float64
+	for _, sample := range complexitySampleWindows(duration) {
+		args := []string{"-hide_banner", "-v", "error",
+			"-ss", strconv.FormatFloat(sample[0], 'f', 3, 64), "-t", strconv.FormatFloat(sample[1], 'f', 3, 64),
+			"-i", inputFile, "-an", "-sn", "-dn",
+			"-vf", "scale=-2:360,format=yuv420p",
+			"-c:v", "libx264", "-preset", "ultrafast", "-crf", "26",
+			"-f", "h264", "-"}
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		counter := &countingWriter{}
+		var stderr strings.Builder
+		cmd.Stdout = counter
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return 0, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		totalBytes += counter.n
+		totalSeconds += sample[1]
+	}
+	if totalSeconds <= 0 || totalBytes == 0 {
+		return 0, fmt.Errorf("分析样本为空")
+	}
+
+	kbps := float64(totalBytes) * 8 / totalSeconds / 1000
+	return math.Min(maxComplexity, math.Max(minComplexity, kbps/referenceComplexityKbps)), nil
+}
+
+// complexitySampleWindows 返回采样段的起始时间和时长（秒）；短视频从头分析一段，时长未知时分析开头
+func complexitySampleWindows(duration time.Duration) [][2]float64 {
+	seconds := duration.Seconds()
+	if seconds <= 0 {
+		return [][2]float64{{0, complexitySamples * complexitySampleSeconds}}
+	}
+	if seconds <= 2*complexitySamples*complexitySampleSeconds {
+		return [][2]float64{{0, math.Min(seconds, complexitySamples*complexitySampleSeconds)}}
+	}
+	windows := make([][2]float64, 0, complexitySamples)
+	for i := 0; i < complexitySamples; i++ {
+		start := seconds*(float64(i)+0.5)/complexitySamples - complexitySampleSeconds/2.0
+		windows = append(windows, [2]float64{start, complexitySampleSeconds})
+	}
+	return windows
+}
+
+// countingWriter 只统计写入的字节数
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+// presetPlaceholders 自定义预设参数中可使用的占位符及其取值，按片源规划的档位替换
+// {scale} 为按比例缩放到档位范围内的滤镜，码率带 k 后缀
+func presetPlaceholders(rendition Rendition) []string {
+	return []string{
+		"{width}", strconv.Itoa(rendition.Width),
+		"{height}", strconv.Itoa(rendition.Height),
+		"{scale}", fitFilter(rendition),
+		"{video_bitrate}", fmt.Sprintf("%dk", rendition.VideoBitrate),
+		"{maxrate}", fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+		"{bufsize}", fmt.Sprintf("%dk", rendition.VideoBitrate*2),
+		"{audio_bitrate}", fmt.Sprintf("%dk", rendition.AudioBitrate),
+	}
+}
+
+// hasPlaceholders 判断预设参数是否使用了档位占位符
+func hasPlaceholders(args []string) bool {
+	placeholders := presetPlaceholders(Rendition{})
+	for _, arg := range args {
+		for i := 0; i < len(placeholders); i += 2 {
+			if strings.Contains(arg, placeholders[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandPresetArgs 替换预设参数中的档位占位符
+func expandPresetArgs(args []string, rendition Rendition) []string {
+	replacer := strings.NewReplacer(presetPlaceholders(rendition)...)
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = replacer.Replace(arg)
+	}
+	return expanded
+}
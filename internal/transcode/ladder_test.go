@@ -0,0 +1,170 @@
+package transcode
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// testLadder 测试用码率阶梯
+var testLadder = []Rendition{
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5000, AudioBitrate: 128},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 3000, AudioBitrate: 128},
+	{Name: "480p", Width: 854, Height: 480, VideoBitrate: 1200, AudioBitrate: 96},
+}
+
+// ladderSummary 档位的名称、宽高和码率，便于比较
+type ladderSummary struct {
+	Name          string
+	Width, Height int
+	VideoBitrate  int
+}
+
+func summarize(ladder []Rendition) []ladderSummary {
+	summary := make([]ladderSummary, 0, len(ladder))
+	for _, rendition := range ladder {
+		summary = append(summary, ladderSummary{rendition.Name, rendition.Width, rendition.Height, rendition.VideoBitrate})
+	}
+	return summary
+}
+
+func TestPlanLadder(t *testing.T) {
+	tests := []struct {
+		name       string
+		media      task.MediaInfo
+		complexity float64
+		want       []ladderSummary
+	}{
+		{
+			name:       "1080p 片源保留全部档位",
+			media:      task.MediaInfo{Width: 1920, Height: 1080, FrameRate: 30},
+			complexity: 1,
+			want:       []ladderSummary{{"1080p", 1920, 1080, 5000}, {"720p", 1280, 720, 3000}, {"480p", 852, 480, 1200}},
+		},
+		{
+			name:       "720p 片源去掉更高的档位",
+			media:      task.MediaInfo{Width: 1280, Height: 720, FrameRate: 30},
+			complexity: 1,
+			want:       []ladderSummary{{"720p", 1280, 720, 3000}, {"480p", 852, 480, 1200}},
+		},
+		{
+			name:       "900p 片源补一个片源分辨率的档位",
+			media:      task.MediaInfo{Width: 1600, Height: 900, FrameRate: 30},
+			complexity: 1,
+			want:       []ladderSummary{{"900p", 1600, 900, 3800}, {"720p", 1280, 720, 3000}, {"480p", 852, 480, 1200}},
+		},
+		{
+			name:       "略高于 720p 的片源不补档位",
+			media:      task.MediaInfo{Width: 1422, Height: 800, FrameRate: 30},
+			complexity: 1,
+			want:       []ladderSummary{{"720p", 1278, 720, 3000}, {"480p", 852, 480, 1200}},
+		},
+		{
+			name:       "低于所有档位的片源按原尺寸编码一个档位",
+			media:      task.MediaInfo{Width: 320, Height: 240, FrameRate: 30},
+			complexity: 1,
+			want:       []ladderSummary{{"240p", 320, 240, 340}},
+		},
+		{
+			name:       "竖屏片源交换档位宽高",
+			media:      task.MediaInfo{Width: 720, Height: 1280, FrameRate: 30},
+			complexity: 1,
+			want:       []ladderSummary{{"720p", 720, 1280, 3000}, {"480p", 480, 852, 1200}},
+		},
+		{
+			name:       "旋转 90 度的片源按显示尺寸规划",
+			media:      task.MediaInfo{Width: 1280, Height: 720, FrameRate: 30, Rotation: 90},
+			complexity: 1,
+			want:       []ladderSummary{{"720p", 720, 1280, 3000}, {"480p", 480, 852, 1200}},
+		},
+		{
+			name:       "60fps 片源提高码率",
+			media:      task.MediaInfo{Width: 1280, Height: 720, FrameRate: 60},
+			complexity: 1,
+			want:       []ladderSummary{{"720p", 1280, 720, 4240}, {"480p", 852, 480, 1690}},
+		},
+		{
+			name:       "低复杂度片源降低码率",
+			media:      task.MediaInfo{Width: 1280, Height: 720, FrameRate: 30},
+			complexity: 0.5,
+			want:       []ladderSummary{{"720p", 1280, 720, 1500}, {"480p", 852, 480, 600}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(planLadder(&tt.media, tt.complexity, testLadder))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planLadder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanLadderDeduplicatesNames(t *testing.T) {
+	// 两个档位在片源上规划出相同的分辨率时只保留第一个（码率较高的）
+	ladder := []Rendition{
+		{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 3000},
+		{Name: "720p-wide", Width: 1366, Height: 720, VideoBitrate: 2000},
+	}
+	media := &task.MediaInfo{Width: 1280, Height: 720, FrameRate: 30}
+	got := planLadder(media, 1, ladder)
+	if len(got) != 1 || got[0].VideoBitrate != 3000 {
+		t.Errorf("planLadder() = %+v, want 只保留 3000k 的 720p", got)
+	}
+}
+
+func TestPlanRenditionMinBitrate(t *testing.T) {
+	media := &task.MediaInfo{Width: 320, Height: 180, FrameRate: 15}
+	got := planRendition(media, minComplexity, Rendition{Width: 1920, Height: 1080, VideoBitrate: 500})
+	if got.VideoBitrate != minPlannedBitrate {
+		t.Errorf("VideoBitrate = %d, want %d", got.VideoBitrate, minPlannedBitrate)
+	}
+	if got.Width != 320 || got.Height != 180 {
+		t.Errorf("不应放大片源: %dx%d", got.Width, got.Height)
+	}
+}
+
+func TestFrameRateFactor(t *testing.T) {
+	tests := []struct {
+		frameRate float64
+		want      float64
+	}{
+		{0, 1},
+		{30, 1},
+		{60, math.Sqrt2},
+		{120, math.Sqrt2}, // 上限 2 倍帧率
+		{24, math.Sqrt(0.8)},
+		{5, math.Sqrt(0.5)}, // 下限 0.5 倍帧率
+	}
+
+	for _, tt := range tests {
+		if got := frameRateFactor(tt.frameRate); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("frameRateFactor(%v) = %v, want %v", tt.frameRate, got, tt.want)
+		}
+	}
+}
+
+func TestComplexitySampleWindows(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     [][2]float64
+	}{
+		{name: "时长未知时分析开头", duration: 0, want: [][2]float64{{0, 12}}},
+		{name: "短视频从头分析", duration: 10 * time.Second, want: [][2]float64{{0, 10}}},
+		{name: "中等时长分析开头 12 秒", duration: 20 * time.Second, want: [][2]float64{{0, 12}}},
+		{name: "长视频均匀抽样", duration: 100 * time.Second, want: [][2]float64{{11, 3}, {36, 3}, {61, 3}, {86, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := complexitySampleWindows(tt.duration); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("complexitySampleWindows(%v) = %v, want %v", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// mergeCost 返回转码类型合并到同一个 FFmpeg 进程时占用的编码会话数，不能合并时返回 false
+// 结构化预设只有一个输入、一个输出文件，输出参数互不影响，可以合并；图片和流复制不占编码会话。
+// HLS/DASH 本身已是一次解码多路输出（按档位数占用会话，见 typeSessions），原始参数可能包含输入选项，都单独执行
+func (p *Processor) mergeCost(transcodeType string) (int, bool) {
+	preset, err := p.lookupPreset(transcodeType)
+	if err != nil || preset.Spec == nil || preset.Spec.Packaged() {
+		return 0, false
+	}
+	return preset.Spec.encodeSessions(), true
+}
+
+// SetMultiOutput 设置是否将可合并的转码类型放到同一个 FFmpeg 进程中，一次解码同时输出多个文件
+// 需在开始处理任务之前调用
+func (p *Processor) SetMultiOutput(enabled bool) {
+	p.multiOutput = enabled
+}
+
+// MultiOutput 是否启用多输出合并转码
+func (p *Processor) MultiOutput() bool {
+	return p.multiOutput
+}
+
+// planEncodeGroups 将待处理的转码类型分组，同一组在一个 FFmpeg 进程中完成
+// 可合并的类型按顺序放入同一组，一组占用的编码会话数不超过处理器的编码会话上限；其他类型各自一组
+func (p *Processor) planEncodeGroups(transcodeTypes []string) [][]string {
+	groups := make([][]string, 0, len(transcodeTypes))
+	var current []string
+	sessions := 0
+	for _, transcodeType := range transcodeTypes {
+		cost, ok := p.mergeCost(transcodeType)
+		if !p.multiOutput || !ok {
+			groups = append(groups, []string{transcodeType})
+			continue
+		}
+		if len(current) > 0 && sessions+cost > p.platformInfo.MaxEncodeSessions {
+			groups = append(groups, current)
+			current, sessions = nil, 0
+		}
+		current = append(current, transcodeType)
+		sessions += cost
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// groupSessions 一组转码类型占用的编码会话数（至少 1 个）
+func (p *Processor) groupSessions(transcodeTypes []string) int {
+	sessions := 0
+	for _, transcodeType := range transcodeTypes {
+		cost, _ := p.mergeCost(transcodeType)
+		sessions += cost
+	}
+	return max(1, sessions)
+}
+
+// typeSessions 单独转码时占用的编码会话数
+// HLS/DASH 在一个 FFmpeg 进程中为规划后的每个档位各打开一个编码器，按档位数占用（不超过会话上限，
+// 否则永远无法占满）；其他类型占用一个
+func (p *Processor) typeSessions(ctx context.Context, input *transcodeInput, transcodeType string) int {
+	preset, err := p.lookupPreset(transcodeType)
+	if err != nil || preset.Spec == nil || !preset.Spec.Packaged() {
+		return 1
+	}
+	rungs := len(p.packaging.Ladder)
+	if input.media != nil && input.media.Width > 0 && input.media.Height > 0 {
+		rungs = len(planLadder(input.media, p.titleComplexity(ctx, input), p.packaging.Ladder))
+	}
+	return max(1, min(rungs, p.platformInfo.MaxEncodeSessions))
+}
+
+// acquireEncodeSlots 占用 n 个编码会话，ctx 取消时释放已占用的会话并返回 false
+// 多会话的占用持有 slotTurn 串行进行，避免两组各占一部分会话后互相等待；
+// 排队和等待会话时都响应 ctx 取消，被中止的任务不会卡在其他任务的等待之后
+func (p *Processor) acquireEncodeSlots(ctx context.Context, n int) bool {
+	select {
+	case p.slotTurn <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	defer func() { <-p.slotTurn }()
+	for i := 0; i < n; i++ {
+		select {
+		case p.encodeSlots <- struct{}{}:
+		case <-ctx.Done():
+			p.releaseEncodeSlots(i)
+			return false
+		}
+	}
+	return true
+}
+
+// releaseEncodeSlots 释放 n 个编码会话
+func (p *Processor) releaseEncodeSlots(n int) {
+	for i := 0; i < n; i++ {
+		<-p.encodeSlots
+	}
+}
+
+// groupOutputArgs 返回可合并的转码类型按片源规划、编译后的输出参数（-i 之后的部分，含输出文件）
+func (p *Processor) groupOutputArgs(ctx context.Context, input *transcodeInput, transcodeType, outputFile string) ([]string, error) {
+	preset, err := p.lookupPreset(transcodeType)
+	if err != nil {
+		return nil, err
+	}
+	if preset.Spec == nil {
+		return nil, fmt.Errorf("%w: %s 没有结构化参数，不能合并转码", ErrInvalidPreset, transcodeType)
+	}
+	return p.platformInfo.CompileSpec(p.planSpec(ctx, input, preset.Spec), outputFile)
+}
+
+// processTranscodeGroup 在一个 FFmpeg 进程中完成一组转码类型：一次解码，各输出有独立的滤镜和编码参数
+// 合并转码失败时逐个重新转码，由单独执行的结果确定每个类型的成败和错误详情；
+// 成功后各类型分别上传、记录输出文件和状态。返回值与 transcodeTypes 一一对应
+func (p *Processor) processTranscodeGroup(ctx context.Context, input *transcodeInput, transcodeTypes []string) []typeOutcome {
+	if len(transcodeTypes) == 1 {
+		return []typeOutcome{p.processTranscodeType(ctx, input, transcodeTypes[0])}
+	}
+
+	taskID := input.taskID
+	outcomes := make([]typeOutcome, len(transcodeTypes))
+	if ctx.Err() != nil || p.taskManager.IsTaskAborted(taskID) {
+		log.Printf("⛔ 任务已被中止，停止处理: %s", taskID)
+		for i := range outcomes {
+			outcomes[i] = typeInterrupted
+		}
+		return outcomes
+	}
+
+	log.Printf("🔄 合并处理转码类型: %s", strings.Join(transcodeTypes, ", "))
+
+	// 准备各类型的输出文件，准备失败的类型不参与合并
+	var types, outputFiles []string
+	var indexes []int
+	for i, transcodeType := range transcodeTypes {
+		outputFile, outcome := p.prepareTranscodeType(input, transcodeType)
+		if outcome != typeCompleted {
+			outcomes[i] = outcome
+			continue
+		}
+		types = append(types, transcodeType)
+		outputFiles = append(outputFiles, outputFile)
+		indexes = append(indexes, i)
+	}
+	if len(types) == 0 {
+		return outcomes
+	}
+
+	// 执行合并转码（占用各输出的编码会话）
+	sessions := p.groupSessions(types)
+	if !p.acquireEncodeSlots(ctx, sessions) {
+		log.Printf("⛔ 等待编码会话时任务被中断 [%s]", strings.Join(types, ", "))
+		for _, i := range indexes {
+			outcomes[i] = typeInterrupted
+		}
+		return outcomes
+	}
+	result := p.processGroupWithLog(ctx, input, types, outputFiles)
+	p.releaseEncodeSlots(sessions)
+
+	if result.Error != nil {
+		for _, outputFile := range outputFiles {
+			removeOutput(outputFile)
+		}
+		if ctx.Err() != nil {
+			log.Printf("⛔ 合并转码被中断 [%s]: %v", strings.Join(types, ", "), context.Cause(ctx))
+			for _, i := range indexes {
+				outcomes[i] = typeInterrupted
+			}
+			return outcomes
+		}
+		log.Printf("⚠️  合并转码失败，逐个重新转码以确定失败的类型 [%s]: %v", strings.Join(types, ", "), result.Error)
+		for n, i := range indexes {
+			outcomes[i] = p.processTranscodeType(ctx, input, types[n])
+		}
+		return outcomes
+	}
+
+	for n, i := range indexes {
+		transcodeType, outputFile := types[n], outputFiles[n]
+		if info, err := os.Stat(outputFile); err != nil || info.Size() == 0 {
+			// FFmpeg 成功退出但没有写出该输出（如缩略图时间点超出视频时长）
+			errMsg := fmt.Sprintf("合并转码未生成输出文件: %s", outputFile)
+			log.Printf("❌ 转码失败 [%s]: %s", transcodeType, errMsg)
+			p.taskManager.AddErrorDetail(taskID, task.ErrorDetail{
+				TranscodeType: transcodeType,
+				Stage:         "transcode",
+				Error:         errMsg,
+				Command:       result.Command,
+				Output:        result.Output,
+			})
+			removeOutput(outputFile)
+			p.markTypeFailed(taskID, transcodeType)
+			outcomes[i] = typeFailed
+			continue
+		}
+		outcomes[i] = p.finishTranscodeType(ctx, input, transcodeType, outputFile)
+	}
+	return outcomes
+}
+
+// processGroupWithLog 执行合并转码，进度同时回报给组内每个类型
+// 失败时（包括 GPU 编码失败）不在这里重试，由 processTranscodeGroup 逐个重新转码
+func (p *Processor) processGroupWithLog(ctx context.Context, input *transcodeInput, transcodeTypes, outputFiles []string) *TranscodeResult {
+	reporters := make([]*progressReporter, len(transcodeTypes))
+	for i, transcodeType := range transcodeTypes {
+		reporters[i] = &progressReporter{
+			taskManager:   p.taskManager,
+			taskID:        input.taskID,
+			transcodeType: transcodeType,
+			duration:      input.duration,
+		}
+	}
+	onProgress := func(progress ffmpegProgress) {
+		for _, reporter := range reporters {
+			reporter.report(progress)
+		}
+	}
+
+	return p.doTranscodeGroupWithLog(ctx, input, transcodeTypes, outputFiles, onProgress)
+}
+
+// doTranscodeGroupWithLog 构建并执行多输出的 FFmpeg 命令：输入参数只出现一次，之后依次是各类型的输出参数
+func (p *Processor) doTranscodeGroupWithLog(ctx context.Context, input *transcodeInput, transcodeTypes, outputFiles []string, onProgress progressFunc) *TranscodeResult {
+	log.Printf("创建合并转码(%s): %s", strings.Join(transcodeTypes, "+"), input.file)
+	args := p.inputArgs(input.file)
+	for i, transcodeType := range transcodeTypes {
+		outputArgs, err := p.groupOutputArgs(ctx, input, transcodeType, outputFiles[i])
+		if err != nil {
+			return &TranscodeResult{Error: fmt.Errorf("编译预设参数失败 [%s]: %w", transcodeType, err)}
+		}
+		args = append(args, outputArgs...)
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	taskName := fmt.Sprintf("合并转码(%s)", strings.Join(transcodeTypes, "+"))
+	if p.gpuAvailable.Load() {
+		taskName += " [GPU加速]"
+	}
+	return p.runFFmpegCommandWithLog(ctx, cmd, taskName, onProgress)
+}
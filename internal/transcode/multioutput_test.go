@@ -0,0 +1,46 @@
+package transcode
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireEncodeSlotsCancelWhileQueued(t *testing.T) {
+	p := &Processor{platformInfo: &PlatformInfo{MaxEncodeSessions: 2}}
+	p.SetConcurrency(0, 0)
+
+	// 会话已被占满，另一组排队等待两个会话
+	if !p.acquireEncodeSlots(context.Background(), 2) {
+		t.Fatal("占用空闲会话失败")
+	}
+	waiting := make(chan bool)
+	go func() { waiting <- p.acquireEncodeSlots(context.Background(), 2) }()
+	time.Sleep(20 * time.Millisecond)
+
+	// 排在等待者之后的任务被中止时应立即返回，而不是等到前面的组拿到会话
+	ctx, cancel := context.WithCancel(context.Background())
+	aborted := make(chan bool)
+	go func() { aborted <- p.acquireEncodeSlots(ctx, 1) }()
+	cancel()
+	select {
+	case ok := <-aborted:
+		if ok {
+			t.Error("已取消的占用不应成功")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("排队中的占用没有响应取消")
+	}
+
+	// 释放后排队的组拿到全部会话
+	p.releaseEncodeSlots(2)
+	select {
+	case ok := <-waiting:
+		if !ok {
+			t.Error("排队的组应占用成功")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("释放会话后排队的组仍在等待")
+	}
+	p.releaseEncodeSlots(2)
+}
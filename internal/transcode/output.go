@@ -0,0 +1,111 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// segmentedPlaylists 分段输出格式的扩展名及其主播放列表文件名
+// 这些格式的输出是一个目录（播放列表 + 分段），整体上传
+var segmentedPlaylists = map[string]string{
+	"m3u8": "master.m3u8",
+	"mpd":  "manifest.mpd",
+}
+
+// segmentContentTypes 系统 mime 表中可能缺失的流媒体类型
+var segmentContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mpd":  "application/dash+xml",
+}
+
+// isSegmentedOutput 判断输出文件是否为分段输出目录中的主播放列表
+func isSegmentedOutput(outputFile string) bool {
+	_, ok := segmentedPlaylists[strings.TrimPrefix(filepath.Ext(outputFile), ".")]
+	return ok
+}
+
+// isEntryPlaylist 判断文件是否为分段输出的入口（主播放列表或 DASH 清单）
+func isEntryPlaylist(path string) bool {
+	for _, name := range segmentedPlaylists {
+		if filepath.Base(path) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentedOutputPrefix 分段输出在输出桶中的 key 前缀：<输出前缀><任务ID>/<转码类型>/
+// 每个任务的分段输出独立存放，避免不同任务的同名分段互相覆盖
+func segmentedOutputPrefix(input *transcodeInput, transcodeType string) string {
+	return input.outputPrefix + input.taskID + "/" + transcodeType + "/"
+}
+
+// removeOutput 删除本地输出（分段输出删除整个目录）
+func removeOutput(outputFile string) {
+	if isSegmentedOutput(outputFile) {
+		os.RemoveAll(filepath.Dir(outputFile))
+		return
+	}
+	os.Remove(outputFile)
+}
+
+// contentTypeFor 根据扩展名返回上传时使用的 Content-Type
+func contentTypeFor(localFile string) string {
+	ext := strings.ToLower(filepath.Ext(localFile))
+	if contentType, ok := segmentContentTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// uploadOutputTree 上传分段输出目录中的所有文件，保持相对路径，完成后删除本地目录
+// 先上传分段，再上传各档位的播放列表，最后上传主播放列表和 DASH 清单，避免播放器读到引用了未上传分段的播放列表
+func (p *Processor) uploadOutputTree(ctx context.Context, dir, keyPrefix string) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("读取输出目录失败: %v", err)
+	}
+
+	uploadOrder := func(path string) int {
+		switch {
+		case !isSegmentedOutput(path):
+			return 0
+		case filepath.Dir(path) != dir || !isEntryPlaylist(path):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return uploadOrder(files[i]) < uploadOrder(files[j])
+	})
+
+	for _, path := range files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if err := p.uploadToStorage(ctx, path, keyPrefix+filepath.ToSlash(rel)); err != nil {
+			return err
+		}
+	}
+
+	os.RemoveAll(dir)
+	return nil
+}
@@ -29,8 +29,19 @@ type PlatformInfo struct {
 	H264Encoder    string   `json:"h264_encoder"`
 	H265Encoder    string   `json:"h265_encoder"`
 	HWAccelArgs    []string `json:"hw_accel_args"`
+	GPUCount       int      `json:"gpu_count,omitempty"`
+	// MaxEncodeSessions 同时运行的编码会话上限（NVENC 消费级显卡有会话数限制）
+	MaxEncodeSessions int `json:"max_encode_sessions"`
 }
 
+// 各平台默认的编码会话上限
+const (
+	nvencSessionsPerGPU  = 3 // 消费级 NVIDIA 显卡驱动限制的并发 NVENC 会话数
+	videoToolboxSessions = 2
+	maxCPUEncodeSessions = 4
+	cpuThreadsPerSession = 4 // CPU 模式下每个编码会话大致占用的核数
+)
+
 // DetectPlatform 检测当前平台和硬件加速能力
 func DetectPlatform() *PlatformInfo {
 	info := &PlatformInfo{
@@ -49,7 +60,7 @@ func DetectPlatform() *PlatformInfo {
 		info.setupCPUMode()
 	}
 
-	log.Printf("✅ 平台检测完成: %s, GPU=%v, 编码器=%s", info.Platform, info.GPUAvailable, info.H265Encoder)
+	log.Printf("✅ 平台检测完成: %s, GPU=%v, 编码器=%s, 编码会话上限=%d", info.Platform, info.GPUAvailable, info.H265Encoder, info.MaxEncodeSessions)
 	return info
 }
 
@@ -71,6 +82,8 @@ func (p *PlatformInfo) detectMacOS() {
 		p.H265Encoder = "hevc_videotoolbox"
 		p.VideoEncoder = p.H265Encoder
 		p.HWAccelArgs = []string{"-hwaccel", "videotoolbox"}
+		p.GPUCount = 1
+		p.MaxEncodeSessions = videoToolboxSessions
 		log.Printf("✅ VideoToolbox 硬件加速可用")
 	} else {
 		p.setupCPUMode()
@@ -88,6 +101,7 @@ func (p *PlatformInfo) detectLinux() {
 		p.H265Encoder = "hevc_nvenc"
 		p.VideoEncoder = p.H265Encoder
 		p.HWAccelArgs = []string{"-hwaccel", "cuda"}
+		p.MaxEncodeSessions = nvencSessionsPerGPU * p.GPUCount
 		log.Printf("✅ NVIDIA NVENC 硬件加速可用")
 	} else {
 		p.setupCPUMode()
@@ -102,6 +116,14 @@ func (p *PlatformInfo) setupCPUMode() {
 	p.H265Encoder = "libx265"
 	p.VideoEncoder = p.H265Encoder
 	p.HWAccelArgs = []string{}
+	p.GPUCount = 0
+	p.MaxEncodeSessions = runtime.NumCPU() / cpuThreadsPerSession
+	if p.MaxEncodeSessions < 1 {
+		p.MaxEncodeSessions = 1
+	}
+	if p.MaxEncodeSessions > maxCPUEncodeSessions {
+		p.MaxEncodeSessions = maxCPUEncodeSessions
+	}
 	log.Printf("⚠️ 使用 CPU 软件编码模式")
 }
 
@@ -143,7 +165,8 @@ func (p *PlatformInfo) checkNvidiaGPU() bool {
 	}
 
 	p.GPUName = strings.TrimSpace(string(output))
-	log.Printf("✅ 检测到 NVIDIA GPU: %s", p.GPUName)
+	p.GPUCount = len(strings.Split(p.GPUName, "\n"))
+	log.Printf("✅ 检测到 NVIDIA GPU: %s (共 %d 块)", p.GPUName, p.GPUCount)
 
 	// 检查 FFmpeg NVENC 支持
 	cmd = exec.Command("ffmpeg", "-encoders")
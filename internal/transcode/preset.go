@@ -18,15 +18,17 @@ import (
 
 // TranscodePreset 转码预设定义
 type TranscodePreset struct {
-	PresetID    string    `json:"preset_id" dynamodbav:"preset_id"`
-	Name        string    `json:"name" dynamodbav:"name"`
-	Description string    `json:"description" dynamodbav:"description"`
-	FFmpegArgs  []string  `json:"ffmpeg_args" dynamodbav:"ffmpeg_args"`
-	OutputExt   string    `json:"output_ext" dynamodbav:"output_ext"`
-	Platform    string    `json:"platform" dynamodbav:"platform"` // all, linux_nvidia, macos_apple
-	IsBuiltin   bool      `json:"is_builtin" dynamodbav:"is_builtin"`
-	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" dynamodbav:"updated_at"`
+	PresetID    string      `json:"preset_id" dynamodbav:"preset_id"`
+	Name        string      `json:"name" dynamodbav:"name"`
+	Description string      `json:"description" dynamodbav:"description"`
+	Spec        *PresetSpec `json:"spec,omitempty" dynamodbav:"spec,omitempty"` // 结构化参数，编译为当前平台的 FFmpeg 参数
+	FFmpegArgs  []string    `json:"ffmpeg_args" dynamodbav:"ffmpeg_args"`       // 原始 FFmpeg 参数，Spec 为空时使用
+	OutputExt   string      `json:"output_ext" dynamodbav:"output_ext"`
+	Platform    string      `json:"platform" dynamodbav:"platform"` // all, linux_nvidia, macos_apple
+	IsBuiltin   bool        `json:"is_builtin" dynamodbav:"is_builtin"`
+	Target      *Rendition  `json:"target,omitempty" dynamodbav:"target,omitempty"` // 档位占位符的规划目标，为空时使用码率阶梯中的最高档
+	CreatedAt   time.Time   `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" dynamodbav:"updated_at"`
 }
 
 // PresetManager 预设管理器
@@ -48,75 +50,190 @@ func NewPresetManager(dynamoClient *dynamodb.Client, tableName string) *PresetMa
 	return pm
 }
 
-// loadBuiltinPresets 加载内置预设
-func (pm *PresetManager) loadBuiltinPresets() {
-	builtins := []*TranscodePreset{
-		{
-			PresetID:    "mp4_standard",
-			Name:        "MP4标清",
-			Description: "848x480 分辨率，H.265编码，适合普通播放",
-			OutputExt:   "mp4",
-			Platform:    "all",
-			IsBuiltin:   true,
+// builtinPresets 内置预设，参数以结构化形式定义，由 PlatformInfo 编译为当前平台的 FFmpeg 参数
+var builtinPresets = []*TranscodePreset{
+	{
+		PresetID:    "mp4_standard",
+		Name:        "MP4标清",
+		Description: "848x480 分辨率，H.265编码，适合普通播放",
+		OutputExt:   "mp4",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "h265",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 23, MaxRate: 800},
+				Resolution:  ResolutionPolicy{Mode: ResolutionFit, Width: 848, Height: 480, PerTitle: true},
+			},
+			Audio:     &AudioSpec{Codec: "mp3", Bitrate: 128, SampleRate: 44100, Channels: 2},
+			Container: ContainerMP4,
 		},
-		{
-			PresetID:    "mp4_smooth",
-			Name:        "MP4流畅",
-			Description: "640x360 分辨率，H.265编码，适合低带宽环境",
-			OutputExt:   "mp4",
-			Platform:    "all",
-			IsBuiltin:   true,
+	},
+	{
+		PresetID:    "mp4_smooth",
+		Name:        "MP4流畅",
+		Description: "640x360 分辨率，H.265编码，适合低带宽环境",
+		OutputExt:   "mp4",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "h265",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 25, MaxRate: 400},
+				Resolution:  ResolutionPolicy{Mode: ResolutionFit, Width: 640, Height: 360, PerTitle: true},
+			},
+			Audio:     &AudioSpec{Codec: "mp3", Bitrate: 128, SampleRate: 44100, Channels: 2},
+			Container: ContainerMP4,
 		},
-		{
-			PresetID:    "hdlbr_h265",
-			Name:        "HDLBR H265全量",
-			Description: "高质量H.265编码，保持原始分辨率",
-			OutputExt:   "mp4",
-			Platform:    "all",
-			IsBuiltin:   true,
+	},
+	{
+		PresetID:    "hdlbr_h265",
+		Name:        "HDLBR H265全量",
+		Description: "高质量H.265编码，保持原始分辨率",
+		OutputExt:   "mp4",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "h265",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 20, MaxRate: 6000},
+				Resolution:  ResolutionPolicy{Mode: ResolutionSource},
+				FPS:         25,
+				GOP:         250,
+			},
+			Audio: &AudioSpec{
+				Codec: "mp3", Bitrate: 128, SampleRate: 44100, Channels: 2,
+				Loudness: &Loudness{Integrated: -17, TruePeak: -1, Range: 11},
+			},
+			Container: ContainerMP4,
 		},
-		{
-			PresetID:    "lcd_h265",
-			Name:        "LCD H265",
-			Description: "LCD显示优化的H.265编码",
-			OutputExt:   "mp4",
-			Platform:    "all",
-			IsBuiltin:   true,
+	},
+	{
+		PresetID:    "lcd_h265",
+		Name:        "LCD H265",
+		Description: "LCD显示优化的H.265编码",
+		OutputExt:   "mp4",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "h265",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 22},
+				Resolution:  ResolutionPolicy{Mode: ResolutionSource},
+				FPS:         25,
+				GOP:         250,
+			},
+			Audio: &AudioSpec{
+				Codec: "mp3", Bitrate: 128, SampleRate: 44100, Channels: 2,
+				Loudness: &Loudness{Integrated: -10},
+			},
+			Container: ContainerMP4,
 		},
-		{
-			PresetID:    "h265_mute",
-			Name:        "H265静音",
-			Description: "H.265编码，移除音频轨道",
-			OutputExt:   "mp4",
-			Platform:    "all",
-			IsBuiltin:   true,
+	},
+	{
+		PresetID:    "h265_mute",
+		Name:        "H265静音",
+		Description: "H.265编码，移除音频轨道",
+		OutputExt:   "mp4",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "h265",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 23, MaxRate: 2867},
+				Resolution:  ResolutionPolicy{Mode: ResolutionSource},
+				FPS:         25,
+				GOP:         250,
+			},
+			Container: ContainerMP4,
 		},
-		{
-			PresetID:    "custom_mute_preview",
-			Name:        "静音预览",
-			Description: "静音预览版本，适合快速预览",
-			OutputExt:   "mp4",
-			Platform:    "all",
-			IsBuiltin:   true,
+	},
+	{
+		PresetID:    "custom_mute_preview",
+		Name:        "静音预览",
+		Description: "静音预览版本，适合快速预览",
+		OutputExt:   "mp4",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "h265",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 23},
+				Resolution:  ResolutionPolicy{Mode: ResolutionSource},
+				FPS:         25,
+				GOP:         250,
+			},
+			Container: ContainerMP4,
 		},
-		{
-			PresetID:    "thumbnail",
-			Name:        "缩略图",
-			Description: "生成视频缩略图，1280x720",
-			OutputExt:   "jpg",
-			Platform:    "all",
-			IsBuiltin:   true,
+	},
+	{
+		PresetID:    "thumbnail",
+		Name:        "缩略图",
+		Description: "生成视频缩略图，1280x720",
+		OutputExt:   "jpg",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video: &VideoSpec{
+				Codec:       "mjpeg",
+				RateControl: RateControl{Mode: RateControlQuality, Quality: 2},
+				Resolution:  ResolutionPolicy{Mode: ResolutionPad, Width: 1280, Height: 720},
+			},
+			Container: ContainerJPG,
+			StartTime: "00:00:04",
+			Frames:    1,
 		},
-	}
+	},
+	{
+		PresetID:    "hls",
+		Name:        "HLS自适应码率",
+		Description: "按码率阶梯输出多档 H.264+AAC，TS 分段 + 主播放列表",
+		OutputExt:   "m3u8",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video:     &VideoSpec{Codec: "h264", Preset: "fast"},
+			Audio:     &AudioSpec{Codec: "aac", SampleRate: 48000, Channels: 2},
+			Container: ContainerHLS,
+		},
+	},
+	{
+		PresetID:    "dash",
+		Name:        "DASH/CMAF自适应码率",
+		Description: "按码率阶梯输出多档 H.264+AAC，CMAF 分段，DASH 清单和 HLS 播放列表共用分段",
+		OutputExt:   "mpd",
+		Platform:    "all",
+		IsBuiltin:   true,
+		Spec: &PresetSpec{
+			Video:     &VideoSpec{Codec: "h264", Preset: "fast"},
+			Audio:     &AudioSpec{Codec: "aac", SampleRate: 48000, Channels: 2},
+			Container: ContainerDASH,
+		},
+	},
+}
 
-	for _, preset := range builtins {
+// loadBuiltinPresets 加载内置预设
+func (pm *PresetManager) loadBuiltinPresets() {
+	for _, preset := range builtinPresets {
 		pm.presets[preset.PresetID] = preset
 	}
-	log.Printf("✅ 加载了 %d 个内置转码预设", len(builtins))
+	log.Printf("✅ 加载了 %d 个内置转码预设", len(builtinPresets))
 }
 
 // SavePreset 保存自定义预设到 DynamoDB
+// 结构化参数无效时返回 ErrInvalidPreset，未指定输出扩展名时按封装格式确定
 func (pm *PresetManager) SavePreset(preset *TranscodePreset) error {
+	if preset.Spec != nil {
+		if err := preset.Spec.Validate(); err != nil {
+			return err
+		}
+		if preset.OutputExt == "" {
+			preset.OutputExt = preset.Spec.OutputExt()
+		}
+	} else if len(preset.FFmpegArgs) == 0 {
+		return fmt.Errorf("%w: 需要设置结构化参数或 FFmpeg 参数", ErrInvalidPreset)
+	}
+
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
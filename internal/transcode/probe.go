@@ -0,0 +1,263 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// ErrUnsupportedInput 输入文件无法转码（损坏、纯音频、无法识别的格式等），属于永久失败
+var ErrUnsupportedInput = errors.New("输入文件不受支持")
+
+// ProbeError ffprobe 无法解析输入文件，Output 为 ffprobe 的错误输出
+type ProbeError struct {
+	Command string
+	Output  string
+	Err     error
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("%v: ffprobe 无法解析文件: %v", ErrUnsupportedInput, e.Err)
+}
+
+// Is 使 errors.Is(err, ErrUnsupportedInput) 成立
+func (e *ProbeError) Is(target error) bool {
+	return target == ErrUnsupportedInput
+}
+
+// ffprobeOutput ffprobe -show_format -show_streams 的 JSON 输出
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []ffprobeStream `json:"streams"`
+}
+
+type ffprobeStream struct {
+	Index            int               `json:"index"`
+	CodecType        string            `json:"codec_type"`
+	CodecName        string            `json:"codec_name"`
+	Profile          string            `json:"profile"`
+	BitRate          string            `json:"bit_rate"`
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	AvgFrameRate     string            `json:"avg_frame_rate"`
+	RFrameRate       string            `json:"r_frame_rate"`
+	PixFmt           string            `json:"pix_fmt"`
+	BitsPerRawSample string            `json:"bits_per_raw_sample"`
+	ColorSpace       string            `json:"color_space"`
+	ColorTransfer    string            `json:"color_transfer"`
+	ColorPrimaries   string            `json:"color_primaries"`
+	ColorRange       string            `json:"color_range"`
+	Channels         int               `json:"channels"`
+	ChannelLayout    string            `json:"channel_layout"`
+	SampleRate       string            `json:"sample_rate"`
+	Tags             map[string]string `json:"tags"`
+	Disposition      map[string]int    `json:"disposition"`
+	SideDataList     []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// probeMedia 使用 ffprobe 探测输入文件的封装、流、编码、时长、分辨率、帧率、HDR 和旋转信息
+// ffprobe 无法解析文件时返回 *ProbeError；ffprobe 未安装时返回的错误匹配 exec.ErrNotFound
+func probeMedia(ctx context.Context, inputFile string) (*task.MediaInfo, error) {
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", inputFile}
+	cmd := exec.CommandContext(ctx, "ffprobe", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) || ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &ProbeError{
+			Command: "ffprobe " + strings.Join(args, " "),
+			Output:  stderr.String(),
+			Err:     err,
+		}
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, &ProbeError{
+			Command: "ffprobe " + strings.Join(args, " "),
+			Output:  string(output),
+			Err:     fmt.Errorf("解析 ffprobe 输出失败: %v", err),
+		}
+	}
+	return probe.mediaInfo(), nil
+}
+
+// mediaInfo 将 ffprobe 输出转换为任务记录中的媒体信息
+func (probe *ffprobeOutput) mediaInfo() *task.MediaInfo {
+	info := &task.MediaInfo{
+		Container: probe.Format.FormatName,
+		Size:      parseInt(probe.Format.Size),
+		BitRate:   parseInt(probe.Format.BitRate),
+		Streams:   make([]task.MediaStream, 0, len(probe.Streams)),
+		ProbedAt:  time.Now(),
+	}
+	if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil && seconds > 0 {
+		info.DurationSeconds = seconds
+	}
+
+	for _, s := range probe.Streams {
+		stream := task.MediaStream{
+			Index:       s.Index,
+			Type:        s.CodecType,
+			Codec:       s.CodecName,
+			Profile:     s.Profile,
+			BitRate:     parseInt(s.BitRate),
+			Language:    s.Tags["language"],
+			AttachedPic: s.Disposition["attached_pic"] == 1,
+		}
+
+		switch s.CodecType {
+		case "video":
+			stream.Width = s.Width
+			stream.Height = s.Height
+			stream.FrameRate = parseFrameRate(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseFrameRate(s.RFrameRate)
+			}
+			stream.PixelFormat = s.PixFmt
+			stream.BitDepth = bitDepth(s.BitsPerRawSample, s.PixFmt)
+			stream.ColorSpace = s.ColorSpace
+			stream.ColorTransfer = s.ColorTransfer
+			stream.ColorPrimaries = s.ColorPrimaries
+			stream.ColorRange = s.ColorRange
+			stream.Rotation = s.rotation()
+
+			if info.VideoCodec == "" && !stream.AttachedPic {
+				info.VideoCodec = stream.Codec
+				info.Width = stream.Width
+				info.Height = stream.Height
+				info.FrameRate = stream.FrameRate
+				info.Rotation = stream.Rotation
+				info.HDR = s.hdrFormat()
+			}
+		case "audio":
+			stream.Channels = s.Channels
+			stream.ChannelLayout = s.ChannelLayout
+			stream.SampleRate = int(parseInt(s.SampleRate))
+			if info.AudioCodec == "" {
+				info.AudioCodec = stream.Codec
+			}
+		}
+		info.Streams = append(info.Streams, stream)
+	}
+	return info
+}
+
+// rotation 返回显示时需要顺时针旋转的角度（0/90/180/270）
+// 新版 ffprobe 在 Display Matrix 中给出逆时针角度，旧版写在 rotate 标签中（顺时针）
+func (s *ffprobeStream) rotation() int {
+	degrees := 0
+	if rotate, err := strconv.Atoi(s.Tags["rotate"]); err == nil {
+		degrees = rotate
+	}
+	for _, sideData := range s.SideDataList {
+		if sideData.SideDataType == "Display Matrix" {
+			degrees = -int(sideData.Rotation)
+		}
+	}
+	return ((degrees % 360) + 360) % 360
+}
+
+// hdrFormat 根据传输特性和 Dolby Vision 配置判断 HDR 格式，SDR 返回空字符串
+func (s *ffprobeStream) hdrFormat() string {
+	for _, sideData := range s.SideDataList {
+		if sideData.SideDataType == "DOVI configuration record" {
+			return "DolbyVision"
+		}
+	}
+	switch s.ColorTransfer {
+	case "smpte2084":
+		return "HDR10"
+	case "arib-std-b67":
+		return "HLG"
+	}
+	return ""
+}
+
+// validateMediaInfo 检查探测结果是否可以转码：必须包含分辨率有效的视频流（封面图不算）
+func validateMediaInfo(info *task.MediaInfo) error {
+	if len(info.Streams) == 0 {
+		return fmt.Errorf("%w: 文件不包含任何媒体流", ErrUnsupportedInput)
+	}
+	if info.VideoCodec == "" {
+		if info.AudioCodec != "" {
+			return fmt.Errorf("%w: 纯音频文件（%s），不包含视频流", ErrUnsupportedInput, info.AudioCodec)
+		}
+		return fmt.Errorf("%w: 文件不包含视频流", ErrUnsupportedInput)
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		return fmt.Errorf("%w: 无法获取视频分辨率（%s）", ErrUnsupportedInput, info.VideoCodec)
+	}
+	return nil
+}
+
+// describeMediaInfo 媒体信息摘要，用于日志
+func describeMediaInfo(info *task.MediaInfo) string {
+	summary := fmt.Sprintf("%s %s %dx%d@%.2ffps %.1fs", info.Container, info.VideoCodec, info.Width, info.Height, info.FrameRate, info.DurationSeconds)
+	if info.AudioCodec != "" {
+		summary += " audio=" + info.AudioCodec
+	}
+	if info.HDR != "" {
+		summary += " " + info.HDR
+	}
+	if info.Rotation != 0 {
+		summary += fmt.Sprintf(" rotate=%d", info.Rotation)
+	}
+	return summary
+}
+
+// parseFrameRate 解析 ffprobe 的分数形式帧率（如 30000/1001）
+func parseFrameRate(value string) float64 {
+	num, den, ok := strings.Cut(value, "/")
+	if !ok {
+		rate, _ := strconv.ParseFloat(value, 64)
+		return rate
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// bitDepth 返回视频位深，bits_per_raw_sample 缺失时根据像素格式推断
+func bitDepth(bitsPerRawSample, pixFmt string) int {
+	if bits, err := strconv.Atoi(bitsPerRawSample); err == nil && bits > 0 {
+		return bits
+	}
+	switch {
+	case pixFmt == "":
+		return 0
+	case strings.Contains(pixFmt, "12"):
+		return 12
+	case strings.Contains(pixFmt, "10"):
+		return 10
+	}
+	return 8
+}
+
+// parseInt 解析 ffprobe 中以字符串表示的整数，无法解析时返回 0
+func parseInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
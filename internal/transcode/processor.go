@@ -2,44 +2,69 @@ package transcode
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-
+	"enhanced_video_transcoder/internal/storage"
 	"enhanced_video_transcoder/internal/task"
 )
 
 type Processor struct {
-	s3Client      *s3.Client
+	store         storage.Storage
 	taskManager   *task.Manager
 	presetManager *PresetManager
 	tempDir       string
 	outputBucket  string
 	debug         bool
-	gpuAvailable  bool
+	gpuAvailable  atomic.Bool
 	platformInfo  *PlatformInfo
+
+	// taskConcurrency 单个任务内并行执行的转码类型数
+	taskConcurrency int
+	// encodeSlots 编码会话信号量，所有任务共享，避免超出 GPU 编码会话上限
+	encodeSlots chan struct{}
+	// slotTurn 占用多个编码会话时的排队令牌（容量 1），用通道而非互斥锁，排队时也能响应 ctx 取消
+	slotTurn chan struct{}
+	// multiOutput 可合并的转码类型是否在同一个 FFmpeg 进程中一次解码、多路输出
+	multiOutput bool
+	// packaging 分段输出（HLS/DASH）的码率阶梯和分段时长
+	packaging PackagingOptions
 }
 
-func NewProcessor(s3Client *s3.Client, taskManager *task.Manager, presetManager *PresetManager, tempDir, outputBucket string, debug bool) *Processor {
+// typeOutcome 单个转码类型的处理结果
+type typeOutcome int
+
+const (
+	typeCompleted typeOutcome = iota
+	typeFailed
+	typeRetryable   // 临时故障（如上传超时），可自动重试
+	typeInterrupted // 任务被中止或处理器关闭，未完成
+)
+
+func NewProcessor(store storage.Storage, taskManager *task.Manager, presetManager *PresetManager, tempDir, outputBucket string, debug bool) *Processor {
 	processor := &Processor{
-		s3Client:      s3Client,
+		store:         store,
 		taskManager:   taskManager,
 		presetManager: presetManager,
 		tempDir:       tempDir,
 		outputBucket:  outputBucket,
 		debug:         debug,
+		multiOutput:   true,
 	}
 
 	// 检测平台和硬件加速能力
 	processor.platformInfo = DetectPlatform()
-	processor.gpuAvailable = processor.platformInfo.GPUAvailable
+	processor.gpuAvailable.Store(processor.platformInfo.GPUAvailable)
+	processor.SetConcurrency(0, 0)
+	processor.SetPackagingOptions(PackagingOptions{})
 
 	// 创建临时目录
 	if err := os.MkdirAll(processor.tempDir, 0755); err != nil {
@@ -49,37 +74,92 @@ func NewProcessor(s3Client *s3.Client, taskManager *task.Manager, presetManager
 	return processor
 }
 
+// SetConcurrency 设置任务内并行度和编码会话上限，参数为 0 时使用平台检测的默认值
+// 需在开始处理任务之前调用
+func (p *Processor) SetConcurrency(taskConcurrency, maxEncodeSessions int) {
+	if maxEncodeSessions > 0 {
+		p.platformInfo.MaxEncodeSessions = maxEncodeSessions
+	}
+	if p.platformInfo.MaxEncodeSessions < 1 {
+		p.platformInfo.MaxEncodeSessions = 1
+	}
+	if taskConcurrency <= 0 {
+		taskConcurrency = p.platformInfo.MaxEncodeSessions
+	}
+	p.taskConcurrency = taskConcurrency
+	p.encodeSlots = make(chan struct{}, p.platformInfo.MaxEncodeSessions)
+	p.slotTurn = make(chan struct{}, 1)
+}
+
+// TaskConcurrency 单个任务内并行执行的转码类型数
+func (p *Processor) TaskConcurrency() int {
+	return p.taskConcurrency
+}
+
 // GetPlatformInfo 获取平台信息
 func (p *Processor) GetPlatformInfo() *PlatformInfo {
 	return p.platformInfo
 }
 
+// abortPollInterval 处理过程中检查任务是否被中止的间隔
+const abortPollInterval = 3 * time.Second
+
 // ProcessTask 处理转码任务
-func (p *Processor) ProcessTask(transcodeTask *task.TranscodeTask) error {
+// ctx 取消时终止正在运行的 FFmpeg 并返回包含取消原因的错误，任务状态保持 processing，
+// 消息重新投递后可继续处理；任务被用户中止时返回 ErrTaskAborted。
+// 遇到临时故障时任务置为 retrying 并返回 *RetryableError，调用方应在 Delay 后重新投递消息；
+// 其他错误为永久失败，任务已标记为 failed
+func (p *Processor) ProcessTask(ctx context.Context, transcodeTask *task.TranscodeTask) error {
 	log.Printf("🎬 开始处理任务: %s", transcodeTask.TaskID)
 
 	// 检查任务是否存在，如果不存在则创建（S3事件触发的任务）
-	_, err := p.taskManager.GetTask(transcodeTask.TaskID)
-	if err != nil {
+	existing, err := p.taskManager.GetTask(transcodeTask.TaskID)
+	if errors.Is(err, task.ErrTaskNotFound) {
 		log.Printf("📝 任务不存在，创建新任务记录: %s", transcodeTask.TaskID)
-		if _, err := p.taskManager.CreateTaskWithID(
-			transcodeTask.TaskID,
-			transcodeTask.InputBucket,
-			transcodeTask.InputKey,
-			transcodeTask.OutputBucket,
-			transcodeTask.TranscodeTypes,
-		); err != nil {
-			return fmt.Errorf("创建任务记录失败: %v", err)
+		existing, err = p.taskManager.CreateTaskFrom(transcodeTask, task.CreatorS3Event)
+		if errors.Is(err, task.ErrTaskExists) {
+			// 同一事件的另一条消息刚创建了任务，由下面的状态检查去重
+			existing, err = p.taskManager.GetTask(transcodeTask.TaskID)
+		} else if err != nil {
+			err = fmt.Errorf("创建任务记录失败: %w", err)
+		}
+	}
+	if err != nil {
+		// 任务存储不可用，无法记录重试次数，消息稍后重新投递
+		return &RetryableError{Err: err, Delay: retryDelay(1)}
+	}
+
+	// 更新任务状态为处理中：已完成（同一对象版本已处理）、已取消或已结束的任务由状态机拒绝，
+	// 正由另一条消息处理的任务（重复投递）也直接跳过
+	if _, err := p.taskManager.StartProcessing(transcodeTask.TaskID, transcodeTask.MessageID); err != nil {
+		if errors.Is(err, task.ErrInvalidTransition) || errors.Is(err, task.ErrDuplicateMessage) {
+			log.Printf("⏭️  任务不需要处理，跳过: %v", err)
+			return nil
 		}
+		return &RetryableError{Err: fmt.Errorf("更新任务状态失败: %w", err), Delay: retryDelay(1)}
 	}
 
-	// 更新任务状态为处理中
-	if err := p.taskManager.UpdateTaskStatus(transcodeTask.TaskID, task.TaskStatusProcessing, ""); err != nil {
-		return fmt.Errorf("更新任务状态失败: %v", err)
+	// 自动重试或消息重新投递时，跳过已完成并已上传的转码类型
+	pendingTypes := make([]string, 0, len(transcodeTask.TranscodeTypes))
+	for _, transcodeType := range transcodeTask.TranscodeTypes {
+		if existing.Progress[transcodeType] == "completed" && existing.OutputFiles[transcodeType] != "" {
+			log.Printf("⏭️  转码类型已完成，跳过: %s", transcodeType)
+			continue
+		}
+		pendingTypes = append(pendingTypes, transcodeType)
 	}
 
+	// 监听中止：任务被中止后取消 ctx，立即终止下载、转码和上传
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go p.watchAbort(ctx, cancel, transcodeTask.TaskID)
+
 	// 下载输入文件
-	inputFile, err := p.downloadFromS3(transcodeTask.InputBucket, transcodeTask.InputKey)
+	inputFile, err := p.downloadFromStorage(ctx, transcodeTask.InputBucket, transcodeTask.InputKey)
+	if err != nil && ctx.Err() != nil {
+		log.Printf("⛔ 下载输入文件时任务被中断: %s", transcodeTask.TaskID)
+		return fmt.Errorf("下载输入文件时任务被中断: %w", context.Cause(ctx))
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("下载输入文件失败: %v", err)
 		p.taskManager.AddErrorDetail(transcodeTask.TaskID, task.ErrorDetail{
@@ -87,96 +167,354 @@ func (p *Processor) ProcessTask(transcodeTask *task.TranscodeTask) error {
 			Error:  errMsg,
 			Output: fmt.Sprintf("Bucket: %s, Key: %s", transcodeTask.InputBucket, transcodeTask.InputKey),
 		})
+		if isTransient(err) {
+			return p.scheduleRetry(transcodeTask.TaskID, errMsg, fmt.Errorf("下载输入文件失败: %w", err))
+		}
 		p.taskManager.UpdateTaskStatus(transcodeTask.TaskID, task.TaskStatusFailed, errMsg)
-		return fmt.Errorf(errMsg)
+		return fmt.Errorf("下载输入文件失败: %w", err)
 	}
 	defer os.Remove(inputFile)
 
-	// 处理每个转码类型
-	hasError := false
-	aborted := false
-	for _, transcodeType := range transcodeTask.TranscodeTypes {
-		// 检查任务是否被中止
-		if p.taskManager.IsTaskAborted(transcodeTask.TaskID) {
-			log.Printf("⛔ 任务已被中止，停止处理: %s", transcodeTask.TaskID)
-			aborted = true
-			break
-		}
-
-		log.Printf("🔄 处理转码类型: %s", transcodeType)
+	// 探测输入文件：记录媒体信息，损坏、纯音频等无法转码的输入在转码前直接失败
+	mediaInfo, err := p.probeInput(ctx, transcodeTask.TaskID, inputFile)
+	if err != nil && ctx.Err() != nil {
+		log.Printf("⛔ 探测输入文件时任务被中断: %s", transcodeTask.TaskID)
+		return fmt.Errorf("探测输入文件时任务被中断: %w", context.Cause(ctx))
+	}
+	if err != nil {
+		p.taskManager.UpdateTaskStatus(transcodeTask.TaskID, task.TaskStatusFailed, err.Error())
+		return err
+	}
 
-		// 更新进度
-		p.taskManager.UpdateTaskProgress(transcodeTask.TaskID, transcodeType, "processing")
+	input := &transcodeInput{
+		taskID:       transcodeTask.TaskID,
+		file:         inputFile,
+		outputPrefix: existing.OutputPrefix,
+		media:        mediaInfo,
+	}
+	// 输入时长用于计算各转码类型的进度百分比和剩余时间
+	if mediaInfo != nil && mediaInfo.DurationSeconds > 0 {
+		input.duration = time.Duration(mediaInfo.DurationSeconds * float64(time.Second))
+	} else {
+		log.Printf("⚠️  获取输入时长失败，进度将不显示百分比")
+	}
 
-		// 生成输出文件名
-		outputFile, err := p.generateOutputFile(inputFile, transcodeType)
-		if err != nil {
-			errMsg := fmt.Sprintf("生成输出文件名失败: %v", err)
-			log.Printf("❌ %s [%s]", errMsg, transcodeType)
-			p.taskManager.AddErrorDetail(transcodeTask.TaskID, task.ErrorDetail{
-				TranscodeType: transcodeType,
-				Stage:         "prepare",
-				Error:         errMsg,
-			})
-			p.taskManager.UpdateTaskProgress(transcodeTask.TaskID, transcodeType, "failed")
-			hasError = true
-			continue
+	// 并行处理各转码类型：可合并的类型分为一组由一个 FFmpeg 进程完成，每个任务最多 taskConcurrency 组同时进行，
+	// 编码阶段另受处理器级编码会话上限约束
+	groups := p.planEncodeGroups(pendingTypes)
+	workers := p.taskConcurrency
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	log.Printf("⚙️  任务 %s 共 %d 个转码类型（待处理 %d，分 %d 组），并行度 %d", transcodeTask.TaskID, len(transcodeTask.TranscodeTypes), len(pendingTypes), len(groups), workers)
+
+	work := make(chan []string)
+	var hasError, hasRetryable, interrupted atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				// 已中断的任务不再开始新的转码类型
+				if interrupted.Load() {
+					continue
+				}
+				for _, outcome := range p.processTranscodeGroup(ctx, input, group) {
+					switch outcome {
+					case typeFailed:
+						hasError.Store(true)
+					case typeRetryable:
+						hasRetryable.Store(true)
+					case typeInterrupted:
+						interrupted.Store(true)
+					}
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		work <- group
+	}
+	close(work)
+	wg.Wait()
+
+	// 更新最终任务状态（已中止的任务由状态机拒绝，不会被覆盖）
+	if interrupted.Load() {
+		if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, ErrTaskAborted) {
+			// 处理器关闭等外部取消，不更新状态，由重新投递的消息继续处理
+			log.Printf("⏸️  任务处理被中断: %s (%v)", transcodeTask.TaskID, cause)
+			return fmt.Errorf("任务处理被中断: %w", cause)
 		}
+		// 任务被中止，不更新状态（已经被 API 设置为 aborted）
+		log.Printf("⛔ 任务已中止: %s", transcodeTask.TaskID)
+		return ErrTaskAborted
+	}
 
-		// 执行转码
-		if err := p.processTranscodeWithLog(transcodeTask.TaskID, inputFile, outputFile, transcodeType); err != nil {
-			log.Printf("❌ 转码失败 [%s]: %v", transcodeType, err)
-			p.taskManager.UpdateTaskProgress(transcodeTask.TaskID, transcodeType, "failed")
-			hasError = true
-			continue
+	// 只有临时故障时自动重试；存在永久失败的类型时重试也无法完成，直接标记失败
+	if hasRetryable.Load() && !hasError.Load() {
+		return p.scheduleRetry(transcodeTask.TaskID, "部分转码任务遇到临时故障", errors.New("部分转码任务遇到临时故障"))
+	}
+
+	finalStatus := task.TaskStatusCompleted
+	finalMessage := ""
+	if hasError.Load() || hasRetryable.Load() {
+		finalStatus = task.TaskStatusFailed
+		finalMessage = "部分转码任务失败"
+	}
+	if err := p.taskManager.UpdateTaskStatus(transcodeTask.TaskID, finalStatus, finalMessage); err != nil {
+		if errors.Is(err, task.ErrInvalidTransition) {
+			log.Printf("⛔ 任务已中止: %s", transcodeTask.TaskID)
+			return ErrTaskAborted
 		}
+		// 已完成的类型在重新投递时会被跳过，只需再次写入最终状态
+		return &RetryableError{Err: fmt.Errorf("更新任务状态失败: %w", err), Delay: retryDelay(1)}
+	}
 
-		// 再次检查任务是否被中止（转码完成后）
-		if p.taskManager.IsTaskAborted(transcodeTask.TaskID) {
-			log.Printf("⛔ 任务已被中止，停止处理: %s", transcodeTask.TaskID)
-			aborted = true
-			// 删除已生成的输出文件
-			os.Remove(outputFile)
-			break
+	if finalStatus == task.TaskStatusFailed {
+		return fmt.Errorf("部分转码任务失败")
+	}
+	log.Printf("🎉 任务完成: %s", transcodeTask.TaskID)
+	return nil
+}
+
+// scheduleRetry 任务遇到临时故障时安排自动重试，返回带退避时间的 *RetryableError；
+// 重试次数已用完时将任务标记为失败并返回永久错误
+func (p *Processor) scheduleRetry(taskID, reason string, cause error) error {
+	updated, err := p.taskManager.ScheduleRetry(taskID, reason)
+	switch {
+	case errors.Is(err, task.ErrRetriesExhausted):
+		errMsg := fmt.Sprintf("%s（已达到最大重试次数）", reason)
+		log.Printf("❌ 任务重试次数已用完，标记为失败: %s", taskID)
+		p.taskManager.UpdateTaskStatus(taskID, task.TaskStatusFailed, errMsg)
+		return fmt.Errorf("%w: %w", task.ErrRetriesExhausted, cause)
+	case errors.Is(err, task.ErrConditionFailed):
+		// 任务已被中止等，不再重试
+		log.Printf("⛔ 任务状态已变化，不再重试: %v", err)
+		return ErrTaskAborted
+	case err != nil:
+		// 任务存储不可用，无法记录重试次数，消息稍后重新投递
+		return &RetryableError{Err: cause, Delay: retryDelay(1)}
+	}
+
+	delay := retryDelay(updated.RetryCount)
+	log.Printf("🔁 任务遇到临时故障，%v 后第 %d/%d 次重试: %s (%v)", delay, updated.RetryCount, updated.MaxRetries, taskID, cause)
+	return &RetryableError{Err: cause, Attempt: updated.RetryCount, Delay: delay}
+}
+
+// watchAbort 定期检查任务是否被中止，中止后以 ErrTaskAborted 取消 ctx
+func (p *Processor) watchAbort(ctx context.Context, cancel context.CancelCauseFunc, taskID string) {
+	ticker := time.NewTicker(abortPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if p.taskManager.IsTaskAborted(taskID) {
+				log.Printf("⛔ 检测到任务被中止，终止正在进行的处理: %s", taskID)
+				cancel(ErrTaskAborted)
+				return
+			}
 		}
+	}
+}
 
-		// 上传到S3
-		outputKey := filepath.Base(outputFile)
-		if err := p.uploadToS3(outputFile, outputKey); err != nil {
-			errMsg := fmt.Sprintf("上传失败: %v", err)
-			log.Printf("❌ %s [%s]", errMsg, transcodeType)
-			p.taskManager.AddErrorDetail(transcodeTask.TaskID, task.ErrorDetail{
-				TranscodeType: transcodeType,
-				Stage:         "upload",
-				Error:         errMsg,
-				Output:        fmt.Sprintf("OutputKey: %s", outputKey),
-			})
-			p.taskManager.UpdateTaskProgress(transcodeTask.TaskID, transcodeType, "failed")
-			hasError = true
-			continue
+// probeInput 探测输入文件并记录到任务，不支持的输入记录 probe 阶段的错误详情并返回匹配 ErrUnsupportedInput 的错误
+// 处理器所在机器没有安装 ffprobe 时跳过探测，返回 nil 媒体信息
+func (p *Processor) probeInput(ctx context.Context, taskID, inputFile string) (*task.MediaInfo, error) {
+	mediaInfo, err := probeMedia(ctx, inputFile)
+	if errors.Is(err, exec.ErrNotFound) {
+		log.Printf("⚠️  未找到 ffprobe，跳过输入文件探测")
+		return nil, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		detail := task.ErrorDetail{
+			Stage: "probe",
+			Error: err.Error(),
+		}
+		var probeErr *ProbeError
+		if errors.As(err, &probeErr) {
+			detail.Command = probeErr.Command
+			detail.Output = probeErr.Output
 		}
+		p.taskManager.AddErrorDetail(taskID, detail)
+		return nil, err
+	}
 
-		// 记录输出文件
-		p.taskManager.AddOutputFile(transcodeTask.TaskID, transcodeType, outputKey)
-		p.taskManager.UpdateTaskProgress(transcodeTask.TaskID, transcodeType, "completed")
+	log.Printf("🔍 输入文件: %s", describeMediaInfo(mediaInfo))
+	if err := p.taskManager.SetMediaInfo(taskID, mediaInfo); err != nil {
+		log.Printf("⚠️  保存媒体信息失败: %v", err)
+	}
 
-		log.Printf("✅ 转码完成 [%s]", transcodeType)
+	if err := validateMediaInfo(mediaInfo); err != nil {
+		p.taskManager.AddErrorDetail(taskID, task.ErrorDetail{
+			Stage:  "probe",
+			Error:  err.Error(),
+			Output: describeMediaInfo(mediaInfo),
+		})
+		return nil, err
 	}
+	return mediaInfo, nil
+}
 
-	// 更新最终任务状态
-	if aborted {
-		// 任务被中止，不更新状态（已经被 API 设置为 failed）
-		log.Printf("⛔ 任务已中止: %s", transcodeTask.TaskID)
-		return fmt.Errorf("任务已被用户中止")
-	} else if hasError {
-		p.taskManager.UpdateTaskStatus(transcodeTask.TaskID, task.TaskStatusFailed, "部分转码任务失败")
-		return fmt.Errorf("部分转码任务失败")
+// transcodeInput 任务的输入文件及各转码类型共用的信息
+type transcodeInput struct {
+	taskID       string
+	file         string          // 本地输入文件
+	outputPrefix string          // 输出文件 key 前缀，为空时上传到输出桶根目录
+	media        *task.MediaInfo // 探测结果，未安装 ffprobe 时为 nil
+	duration     time.Duration   // 输入时长，0 表示未知
+	plan         titlePlan       // 片源复杂度，按片源规划档位时计算
+}
+
+// processTranscodeType 处理单个转码类型：转码、上传并记录进度和错误详情
+// 可在多个协程中并发调用，任务记录的更新由 task.Manager 的条件更新保证不互相覆盖；
+// ctx 被取消（任务中止或处理器关闭）时终止转码、删除临时输出并返回 typeInterrupted
+func (p *Processor) processTranscodeType(ctx context.Context, input *transcodeInput, transcodeType string) typeOutcome {
+	taskID := input.taskID
+	// 检查任务是否被中止
+	if ctx.Err() != nil || p.taskManager.IsTaskAborted(taskID) {
+		log.Printf("⛔ 任务已被中止，停止处理: %s", taskID)
+		return typeInterrupted
+	}
+
+	log.Printf("🔄 处理转码类型: %s", transcodeType)
+
+	outputFile, outcome := p.prepareTranscodeType(input, transcodeType)
+	if outcome != typeCompleted {
+		return outcome
+	}
+
+	// 执行转码（占用该类型的编码会话，HLS/DASH 每个档位一个）
+	sessions := p.typeSessions(ctx, input, transcodeType)
+	if !p.acquireEncodeSlots(ctx, sessions) {
+		log.Printf("⛔ 等待编码会话时任务被中断 [%s]", transcodeType)
+		return typeInterrupted
+	}
+	err := p.processTranscodeWithLog(ctx, input, outputFile, transcodeType)
+	p.releaseEncodeSlots(sessions)
+	if err != nil && ctx.Err() != nil {
+		log.Printf("⛔ 转码被中断 [%s]: %v", transcodeType, context.Cause(ctx))
+		// 删除未完成的输出文件
+		removeOutput(outputFile)
+		return typeInterrupted
+	}
+	if err != nil {
+		log.Printf("❌ 转码失败 [%s]: %v", transcodeType, err)
+		removeOutput(outputFile)
+		p.markTypeFailed(taskID, transcodeType)
+		return typeFailed
+	}
+
+	return p.finishTranscodeType(ctx, input, transcodeType, outputFile)
+}
+
+// prepareTranscodeType 将转码类型标记为处理中并生成输出文件路径，失败时记录 prepare 阶段的错误详情
+// 准备成功时返回 typeCompleted，否则返回该类型的处理结果
+func (p *Processor) prepareTranscodeType(input *transcodeInput, transcodeType string) (string, typeOutcome) {
+	taskID := input.taskID
+	// 更新进度
+	if err := p.taskManager.UpdateTaskProgress(taskID, transcodeType, "processing"); err != nil {
+		log.Printf("❌ 更新转码进度失败 [%s]: %v", transcodeType, err)
+		return "", progressFailure(err)
+	}
+
+	// 生成输出文件名
+	outputFile, err := p.generateOutputFile(input.file, transcodeType)
+	if err != nil {
+		errMsg := fmt.Sprintf("生成输出文件名失败: %v", err)
+		log.Printf("❌ %s [%s]", errMsg, transcodeType)
+		p.taskManager.AddErrorDetail(taskID, task.ErrorDetail{
+			TranscodeType: transcodeType,
+			Stage:         "prepare",
+			Error:         errMsg,
+		})
+		p.markTypeFailed(taskID, transcodeType)
+		return "", typeFailed
+	}
+	return outputFile, typeCompleted
+}
+
+// markTypeFailed 将转码类型标记为失败
+// 写入失败时只记录日志：该类型的结果已经是失败，任务最终状态同样会是失败或重试
+func (p *Processor) markTypeFailed(taskID, transcodeType string) {
+	if err := p.taskManager.UpdateTaskProgress(taskID, transcodeType, "failed"); err != nil {
+		log.Printf("⚠️  标记转码类型失败状态失败 [%s]: %v", transcodeType, err)
+	}
+}
+
+// progressFailure 转码类型的进度或输出文件未能写入时的处理结果
+// 任务已不在处理中（被中止或取消）时视为中断，其他存储错误视为临时故障，重试时重新处理该类型
+func progressFailure(err error) typeOutcome {
+	if errors.Is(err, task.ErrConditionFailed) {
+		return typeInterrupted
+	}
+	return typeRetryable
+}
+
+// finishTranscodeType 上传转码成功的输出并记录输出文件和完成状态
+func (p *Processor) finishTranscodeType(ctx context.Context, input *transcodeInput, transcodeType, outputFile string) typeOutcome {
+	taskID := input.taskID
+	// 再次检查任务是否被中止（转码完成后）
+	if p.taskManager.IsTaskAborted(taskID) {
+		log.Printf("⛔ 任务已被中止，停止处理: %s", taskID)
+		// 删除已生成的输出文件
+		removeOutput(outputFile)
+		return typeInterrupted
+	}
+
+	// 上传到输出存储：单个文件上传到输出前缀下，分段输出（HLS/DASH）整个目录上传到任务专属的前缀下，
+	// 输出文件记录为主播放列表
+	var err error
+	outputKey := input.outputPrefix + filepath.Base(outputFile)
+	if isSegmentedOutput(outputFile) {
+		keyPrefix := segmentedOutputPrefix(input, transcodeType)
+		outputKey = keyPrefix + filepath.Base(outputFile)
+		err = p.uploadOutputTree(ctx, filepath.Dir(outputFile), keyPrefix)
 	} else {
-		p.taskManager.UpdateTaskStatus(transcodeTask.TaskID, task.TaskStatusCompleted, "")
-		log.Printf("🎉 任务完成: %s", transcodeTask.TaskID)
+		err = p.uploadToStorage(ctx, outputFile, outputKey)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("⛔ 上传被中断 [%s]: %v", transcodeType, context.Cause(ctx))
+			removeOutput(outputFile)
+			return typeInterrupted
+		}
+		errMsg := fmt.Sprintf("上传失败: %v", err)
+		log.Printf("❌ %s [%s]", errMsg, transcodeType)
+		p.taskManager.AddErrorDetail(taskID, task.ErrorDetail{
+			TranscodeType: transcodeType,
+			Stage:         "upload",
+			Error:         errMsg,
+			Output:        fmt.Sprintf("OutputKey: %s", outputKey),
+		})
+		removeOutput(outputFile)
+		// 临时故障的类型同样标记为 failed，安排重试时会重置为 pending
+		p.markTypeFailed(taskID, transcodeType)
+		if isTransient(err) {
+			return typeRetryable
+		}
+		return typeFailed
 	}
 
-	return nil
+	// 记录输出文件：未能记录时不能算作完成，否则任务完成后缺少该类型的输出
+	if err := p.taskManager.AddOutputFile(taskID, transcodeType, outputKey); err != nil {
+		log.Printf("❌ 记录输出文件失败 [%s]: %v", transcodeType, err)
+		removeOutput(outputFile)
+		return progressFailure(err)
+	}
+	if err := p.taskManager.UpdateTaskProgress(taskID, transcodeType, "completed"); err != nil {
+		log.Printf("❌ 更新转码进度失败 [%s]: %v", transcodeType, err)
+		removeOutput(outputFile)
+		return progressFailure(err)
+	}
+
+	log.Printf("✅ 转码完成 [%s]", transcodeType)
+	return typeCompleted
 }
 
 // TestTranscode 测试转码（用于 LLM 生成的参数测试）
@@ -185,6 +523,15 @@ func (p *Processor) TestTranscode(inputFile string, ffmpegArgs []string, outputE
 	baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
 	outputFile := filepath.Join(p.tempDir, fmt.Sprintf("%s_test_%d.%s", baseName, time.Now().Unix(), outputExt))
 
+	// 档位占位符按测试文件的分辨率替换（不做复杂度分析）
+	if hasPlaceholders(ffmpegArgs) {
+		target := p.presetTarget(&TranscodePreset{})
+		if media, err := probeMedia(context.Background(), inputFile); err == nil && media.Width > 0 && media.Height > 0 {
+			target = planRendition(media, 1, target)
+		}
+		ffmpegArgs = expandPresetArgs(ffmpegArgs, target)
+	}
+
 	// 分离输入参数（需要放在 -i 之前）和输出参数（放在 -i 之后）
 	inputArgs, outputArgs := separateFFmpegArgs(ffmpegArgs)
 
@@ -213,7 +560,7 @@ func (p *Processor) TestTranscode(inputFile string, ffmpegArgs []string, outputE
 	args = append(args, "-y", outputFile)
 
 	cmd := exec.Command("ffmpeg", args...)
-	result := p.runFFmpegCommandWithLog(cmd, "测试转码")
+	result := p.runFFmpegCommandWithLog(context.Background(), cmd, "测试转码", nil)
 
 	// 清理测试输出文件
 	if result.Error == nil {
@@ -255,6 +602,15 @@ func separateFFmpegArgs(args []string) (inputArgs, outputArgs []string) {
 func (p *Processor) ProcessCustomPreset(inputFile, outputFile string, preset *TranscodePreset) error {
 	log.Printf("🔄 使用自定义预设转码: %s -> %s (预设: %s)", inputFile, outputFile, preset.Name)
 
+	if preset.Spec != nil {
+		outputArgs, err := p.platformInfo.CompileSpec(preset.Spec, outputFile)
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command("ffmpeg", append(p.inputArgs(inputFile), outputArgs...)...)
+		return p.runFFmpegCommand(cmd, fmt.Sprintf("自定义预设: %s", preset.Name))
+	}
+
 	// 分离输入参数和输出参数
 	inputArgs, outputArgs := separateFFmpegArgs(preset.FFmpegArgs)
 
@@ -283,22 +639,19 @@ func (p *Processor) ProcessCustomPreset(inputFile, outputFile string, preset *Tr
 	return p.runFFmpegCommand(cmd, fmt.Sprintf("自定义预设: %s", preset.Name))
 }
 
-// downloadFromS3 从S3下载文件
-func (p *Processor) downloadFromS3(bucket, key string) (string, error) {
-	log.Printf("📥 从S3下载文件: s3://%s/%s", bucket, key)
+// downloadFromStorage 从对象存储下载文件
+func (p *Processor) downloadFromStorage(ctx context.Context, bucket, key string) (string, error) {
+	log.Printf("📥 从存储下载文件 [%s]: %s/%s", p.store.Backend(), bucket, key)
 
 	// 生成本地文件路径
 	localFile := filepath.Join(p.tempDir, fmt.Sprintf("input_%d_%s", time.Now().Unix(), filepath.Base(key)))
 
 	// 下载文件
-	result, err := p.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+	body, _, err := p.store.Get(ctx, bucket, key)
 	if err != nil {
-		return "", fmt.Errorf("从S3获取对象失败: %v", err)
+		return "", fmt.Errorf("获取对象失败: %w", err)
 	}
-	defer result.Body.Close()
+	defer body.Close()
 
 	// 创建本地文件
 	file, err := os.Create(localFile)
@@ -308,8 +661,9 @@ func (p *Processor) downloadFromS3(bucket, key string) (string, error) {
 	defer file.Close()
 
 	// 复制内容
-	if _, err := file.ReadFrom(result.Body); err != nil {
-		return "", fmt.Errorf("写入本地文件失败: %v", err)
+	if _, err := file.ReadFrom(body); err != nil {
+		os.Remove(localFile)
+		return "", fmt.Errorf("写入本地文件失败: %w", err)
 	}
 
 	log.Printf("✅ 文件下载完成: %s", localFile)
@@ -323,32 +677,48 @@ func (p *Processor) generateOutputFile(inputFile, transcodeType string) (string,
 
 	// 确定输出扩展名
 	outputExt := "mp4" // 默认扩展名
-	if transcodeType == "thumbnail" {
-		outputExt = "jpg"
-	} else if p.presetManager != nil {
-		// 尝试从自定义预设获取输出扩展名
-		if preset, err := p.presetManager.GetPreset(transcodeType); err == nil && preset.OutputExt != "" {
+	if preset, err := p.lookupPreset(transcodeType); err == nil {
+		if preset.OutputExt != "" {
 			outputExt = preset.OutputExt
+		} else if preset.Spec != nil {
+			outputExt = preset.Spec.OutputExt()
 		}
 	}
 
-	outputFile := filepath.Join(p.tempDir, fmt.Sprintf("%s_%s_%d.%s", baseName, transcodeType, timestamp, outputExt))
+	outputName := fmt.Sprintf("%s_%s_%d", baseName, transcodeType, timestamp)
+	if playlist, ok := segmentedPlaylists[outputExt]; ok {
+		// 分段输出写入独立目录，目录中为主播放列表和各档位的播放列表、分段
+		outputDir := filepath.Join(p.tempDir, outputName)
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return "", fmt.Errorf("创建输出目录失败: %v", err)
+		}
+		return filepath.Join(outputDir, playlist), nil
+	}
+
+	outputFile := filepath.Join(p.tempDir, outputName+"."+outputExt)
 	return outputFile, nil
 }
 
-// processTranscodeWithLog 处理转码并记录详细日志
-func (p *Processor) processTranscodeWithLog(taskID, inputFile, outputFile, transcodeType string) error {
-	result := p.doTranscodeWithLog(inputFile, outputFile, transcodeType)
+// processTranscodeWithLog 处理转码并记录详细日志，进度百分比按输入时长计算（时长未知时为 0）
+func (p *Processor) processTranscodeWithLog(ctx context.Context, input *transcodeInput, outputFile, transcodeType string) error {
+	taskID := input.taskID
+	reporter := &progressReporter{
+		taskManager:   p.taskManager,
+		taskID:        taskID,
+		transcodeType: transcodeType,
+		duration:      input.duration,
+	}
+	result := p.doTranscodeWithLog(ctx, input, outputFile, transcodeType, reporter.report)
 
 	// 如果GPU模式失败，尝试CPU回退
-	if result.Error != nil && p.gpuAvailable && strings.Contains(result.Error.Error(), "GPU编码失败") {
+	if result.Error != nil && ctx.Err() == nil && p.gpuAvailable.Load() && strings.Contains(result.Error.Error(), "GPU编码失败") {
 		log.Printf("🔄 GPU失败，切换到CPU模式重试...")
-		p.gpuAvailable = false
-		result = p.doTranscodeWithLog(inputFile, outputFile, transcodeType)
+		p.gpuAvailable.Store(false)
+		result = p.doTranscodeWithLog(ctx, input, outputFile, transcodeType, reporter.report)
 	}
 
-	// 如果失败，记录详细错误信息
-	if result.Error != nil {
+	// 如果失败，记录详细错误信息（被取消的转码不算失败）
+	if result.Error != nil && ctx.Err() == nil {
 		p.taskManager.AddErrorDetail(taskID, task.ErrorDetail{
 			TranscodeType: transcodeType,
 			Stage:         "transcode",
@@ -361,40 +731,66 @@ func (p *Processor) processTranscodeWithLog(taskID, inputFile, outputFile, trans
 	return result.Error
 }
 
-// doTranscodeWithLog 执行转码并返回详细结果
-func (p *Processor) doTranscodeWithLog(inputFile, outputFile, transcodeType string) *TranscodeResult {
-	switch transcodeType {
-	case "mp4_standard":
-		return p.createMp4StandardWithLog(inputFile, outputFile)
-	case "mp4_smooth":
-		return p.createMp4SmoothWithLog(inputFile, outputFile)
-	case "hdlbr_h265":
-		return p.createHdlbrH265WithLog(inputFile, outputFile)
-	case "lcd_h265":
-		return p.createLcdH265WithLog(inputFile, outputFile)
-	case "h265_mute":
-		return p.createH265MuteTranscodeWithLog(inputFile, outputFile)
-	case "custom_mute_preview":
-		return p.createCustomMutePreviewWithLog(inputFile, outputFile)
-	case "thumbnail":
-		return p.createThumbnailWithLog(inputFile, outputFile)
-	default:
-		// 尝试作为自定义预设处理
-		if p.presetManager != nil {
-			if preset, err := p.presetManager.GetPreset(transcodeType); err == nil {
-				return p.processCustomPresetWithLog(inputFile, outputFile, preset)
-			}
+// lookupPreset 查找转码类型对应的预设
+func (p *Processor) lookupPreset(transcodeType string) (*TranscodePreset, error) {
+	if p.presetManager != nil {
+		return p.presetManager.GetPreset(transcodeType)
+	}
+	for _, preset := range builtinPresets {
+		if preset.PresetID == transcodeType {
+			return preset, nil
 		}
+	}
+	return nil, fmt.Errorf("预设不存在: %s", transcodeType)
+}
+
+// doTranscodeWithLog 执行转码并返回详细结果
+// 结构化预设由 PlatformInfo 编译参数，HLS/DASH 按码率阶梯打包，其余预设使用原始 FFmpeg 参数
+func (p *Processor) doTranscodeWithLog(ctx context.Context, input *transcodeInput, outputFile, transcodeType string, onProgress progressFunc) *TranscodeResult {
+	preset, err := p.lookupPreset(transcodeType)
+	if err != nil {
 		return &TranscodeResult{Error: fmt.Errorf("未知的转码类型: %s", transcodeType)}
 	}
+	switch {
+	case preset.Spec == nil:
+		return p.processCustomPresetWithLog(ctx, input, outputFile, preset, onProgress)
+	case preset.Spec.Container == ContainerHLS:
+		return p.createHLSWithLog(ctx, input, outputFile, preset.Spec, onProgress)
+	case preset.Spec.Container == ContainerDASH:
+		return p.createDASHWithLog(ctx, input, outputFile, preset.Spec, onProgress)
+	default:
+		return p.processSpecPresetWithLog(ctx, input, outputFile, preset, onProgress)
+	}
+}
+
+// processSpecPresetWithLog 按片源规划结构化参数，编译为当前平台的 FFmpeg 参数后执行
+func (p *Processor) processSpecPresetWithLog(ctx context.Context, input *transcodeInput, outputFile string, preset *TranscodePreset, onProgress progressFunc) *TranscodeResult {
+	log.Printf("创建%s: %s -> %s", preset.Name, input.file, outputFile)
+	outputArgs, err := p.platformInfo.CompileSpec(p.planSpec(ctx, input, preset.Spec), outputFile)
+	if err != nil {
+		return &TranscodeResult{Error: fmt.Errorf("编译预设参数失败 [%s]: %w", preset.PresetID, err)}
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(p.inputArgs(input.file), outputArgs...)...)
+	taskName := preset.Name
+	if p.gpuAvailable.Load() {
+		taskName += " [GPU加速]"
+	}
+	return p.runFFmpegCommandWithLog(ctx, cmd, taskName, onProgress)
 }
 
-// processCustomPresetWithLog 处理自定义预设转码并返回详细日志
-func (p *Processor) processCustomPresetWithLog(inputFile, outputFile string, preset *TranscodePreset) *TranscodeResult {
+// processCustomPresetWithLog 使用预设的原始 FFmpeg 参数转码并返回详细日志
+// 预设参数中的档位占位符按片源规划的档位替换，未设置目标档位时使用码率阶梯中的最高档
+func (p *Processor) processCustomPresetWithLog(ctx context.Context, input *transcodeInput, outputFile string, preset *TranscodePreset, onProgress progressFunc) *TranscodeResult {
+	inputFile := input.file
 	log.Printf("🔄 使用自定义预设转码: %s -> %s (预设: %s)", inputFile, outputFile, preset.Name)
 
+	ffmpegArgs := preset.FFmpegArgs
+	if hasPlaceholders(ffmpegArgs) {
+		ffmpegArgs = expandPresetArgs(ffmpegArgs, p.planRendition(ctx, input, p.presetTarget(preset)))
+	}
+
 	// 分离输入参数和输出参数
-	inputArgs, outputArgs := separateFFmpegArgs(preset.FFmpegArgs)
+	inputArgs, outputArgs := separateFFmpegArgs(ffmpegArgs)
 
 	// 构建命令参数
 	args := []string{}
@@ -417,13 +813,13 @@ func (p *Processor) processCustomPresetWithLog(inputFile, outputFile string, pre
 	args = append(args, outputArgs...)
 	args = append(args, "-y", outputFile)
 
-	cmd := exec.Command("ffmpeg", args...)
-	return p.runFFmpegCommandWithLog(cmd, fmt.Sprintf("自定义预设: %s", preset.Name))
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	return p.runFFmpegCommandWithLog(ctx, cmd, fmt.Sprintf("自定义预设: %s", preset.Name), onProgress)
 }
 
-// uploadToS3 上传文件到S3
-func (p *Processor) uploadToS3(localFile, s3Key string) error {
-	log.Printf("📤 上传文件到S3: %s -> s3://%s/%s", localFile, p.outputBucket, s3Key)
+// uploadToStorage 上传文件到输出存储
+func (p *Processor) uploadToStorage(ctx context.Context, localFile, key string) error {
+	log.Printf("📤 上传文件到存储 [%s]: %s -> %s/%s", p.store.Backend(), localFile, p.outputBucket, key)
 
 	// 检查本地文件是否存在
 	if _, err := os.Stat(localFile); os.IsNotExist(err) {
@@ -445,18 +841,13 @@ func (p *Processor) uploadToS3(localFile, s3Key string) error {
 
 	log.Printf("📊 上传文件大小: %.2f MB", float64(fileInfo.Size())/1024/1024)
 
-	// 上传到S3
-	_, err = p.s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(p.outputBucket),
-		Key:    aws.String(s3Key),
-		Body:   file,
-	})
-
-	if err != nil {
-		return fmt.Errorf("S3上传失败: %v", err)
+	// 上传到存储
+	contentType := contentTypeFor(localFile)
+	if err := p.store.Put(ctx, p.outputBucket, key, file, fileInfo.Size(), contentType); err != nil {
+		return err
 	}
 
-	log.Printf("✅ 文件上传完成: s3://%s/%s", p.outputBucket, s3Key)
+	log.Printf("✅ 文件上传完成: %s/%s", p.outputBucket, key)
 
 	// 删除本地临时文件
 	if err := os.Remove(localFile); err != nil {
@@ -464,4 +855,4 @@ func (p *Processor) uploadToS3(localFile, s3Key string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package transcode
+
+import "os/exec"
+
+// configureProcessGroup 非 Unix 平台没有进程组，上下文取消时只终止 FFmpeg 进程本身
+func configureProcessGroup(cmd *exec.Cmd) {
+	if cmd.Cancel != nil {
+		cmd.WaitDelay = processKillWaitDelay
+	}
+}
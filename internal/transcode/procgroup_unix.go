@@ -0,0 +1,21 @@
+//go:build unix
+
+package transcode
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup 让 FFmpeg 在独立进程组中运行，
+// 上下文取消时向整个进程组发送 SIGKILL，避免残留子进程继续占用 GPU
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// 只有 exec.CommandContext 创建的命令才有 Cancel
+	if cmd.Cancel != nil {
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		cmd.WaitDelay = processKillWaitDelay
+	}
+}
@@ -0,0 +1,126 @@
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"enhanced_video_transcoder/internal/task"
+)
+
+// progressReportInterval 实时进度写入任务存储的最小间隔，避免频繁更新 DynamoDB
+const progressReportInterval = 5 * time.Second
+
+// ffmpegProgress FFmpeg -progress 输出的一次进度快照
+type ffmpegProgress struct {
+	Frame   int64
+	FPS     float64
+	Speed   float64       // 相对实时的倍数，未知时为 0
+	OutTime time.Duration // 已处理的媒体时长
+	Done    bool          // progress=end
+}
+
+// progressFunc 进度回调，每收到一次完整快照调用一次
+type progressFunc func(ffmpegProgress)
+
+// withProgressArgs 在命令参数前插入 -progress 输出选项
+// 进度以 key=value 形式写到 stdout，-nostats 去掉 stderr 中的统计行
+func withProgressArgs(cmd *exec.Cmd) {
+	cmd.Args = append([]string{cmd.Args[0], "-progress", "pipe:1", "-nostats"}, cmd.Args[1:]...)
+}
+
+// runWithProgress 运行命令并解析 stdout 中的进度，返回 stderr 输出
+func runWithProgress(cmd *exec.Cmd, onProgress progressFunc) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	parseProgress(stdout, onProgress)
+	err = cmd.Wait()
+	return stderr.Bytes(), err
+}
+
+// parseProgress 解析 FFmpeg -progress 输出，每个 progress= 行结束一个快照
+func parseProgress(r io.Reader, onProgress progressFunc) {
+	var current ffmpegProgress
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "frame":
+			current.Frame, _ = strconv.ParseInt(value, 10, 64)
+		case "fps":
+			current.FPS, _ = strconv.ParseFloat(value, 64)
+		case "speed":
+			current.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64)
+		case "out_time_us", "out_time_ms":
+			// out_time_ms 实际单位也是微秒（FFmpeg 历史遗留）
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				current.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "progress":
+			current.Done = value == "end"
+			onProgress(current)
+		}
+	}
+	// 读取完所有输出，保证 cmd.Wait 前管道已清空
+	io.Copy(io.Discard, r)
+}
+
+// progressReporter 将 FFmpeg 进度换算为百分比和剩余时间，并按间隔写入任务
+type progressReporter struct {
+	taskManager   *task.Manager
+	taskID        string
+	transcodeType string
+	duration      time.Duration // 输入时长，0 表示未知
+	lastReport    time.Time
+}
+
+// report 处理一次进度快照，距离上次写入不足间隔时跳过（结束快照总是写入）
+func (r *progressReporter) report(progress ffmpegProgress) {
+	if !progress.Done && time.Since(r.lastReport) < progressReportInterval {
+		return
+	}
+	r.lastReport = time.Now()
+
+	detail := task.ProgressDetail{
+		FPS:        progress.FPS,
+		Speed:      progress.Speed,
+		ETASeconds: -1,
+	}
+	switch {
+	case progress.Done:
+		detail.Percent = 100
+		detail.ETASeconds = 0
+	case r.duration > 0:
+		detail.Percent = float64(progress.OutTime) / float64(r.duration) * 100
+		if detail.Percent > 99.9 {
+			detail.Percent = 99.9
+		}
+		if progress.Speed > 0 {
+			remaining := (r.duration - progress.OutTime).Seconds() / progress.Speed
+			if remaining < 0 {
+				remaining = 0
+			}
+			detail.ETASeconds = int64(remaining + 0.5)
+		}
+	}
+	detail.Percent = float64(int64(detail.Percent*10)) / 10
+
+	if err := r.taskManager.UpdateProgressDetail(r.taskID, r.transcodeType, detail); err != nil {
+		log.Printf("⚠️  更新实时进度失败 [%s]: %v", r.transcodeType, err)
+	}
+}
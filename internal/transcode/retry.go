@@ -0,0 +1,66 @@
+package transcode
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	"enhanced_video_transcoder/internal/storage"
+)
+
+// 自动重试的退避时间：第 n 次重试等待 retryBaseDelay * 2^(n-1)，最长 retryMaxDelay
+const (
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 15 * time.Minute
+)
+
+// RetryableError 任务遇到临时故障（S3 超时、DynamoDB 限流等），应在 Delay 后重新投递消息
+// Attempt 为即将进行的第几次重试，0 表示任务存储不可用、未能记录重试次数
+type RetryableError struct {
+	Err     error
+	Attempt int
+	Delay   time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	if e.Attempt > 0 {
+		return fmt.Sprintf("临时故障，%v 后第 %d 次重试: %v", e.Delay, e.Attempt, e.Err)
+	}
+	return fmt.Sprintf("临时故障，%v 后重试: %v", e.Delay, e.Err)
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// retryDelay 第 attempt 次重试前的退避时间
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// isTransient 判断错误是否为临时故障（重试可能成功）
+// 网络错误、超时、AWS 限流和 5xx 视为临时故障；对象不存在、FFmpeg 失败等视为永久失败
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	// SDK 自身重试用尽，说明服务持续不可用
+	var maxAttempts *retry.MaxAttemptsError
+	if errors.As(err, &maxAttempts) {
+		return true
+	}
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return true
+	}
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
@@ -0,0 +1,382 @@
+package transcode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPreset 预设的结构化参数无效
+var ErrInvalidPreset = errors.New("无效的转码预设")
+
+// 封装格式
+const (
+	ContainerMP4  = "mp4"
+	ContainerMOV  = "mov"
+	ContainerMKV  = "mkv"
+	ContainerWebM = "webm"
+	ContainerJPG  = "jpg"
+	ContainerPNG  = "png"
+	ContainerMP3  = "mp3"
+	// ContainerHLS 和 ContainerDASH 按码率阶梯打包为分段输出，码率和分辨率由阶梯决定
+	ContainerHLS  = "hls"
+	ContainerDASH = "dash"
+)
+
+// 码率控制模式
+const (
+	RateControlQuality = "quality" // 恒定质量，可用 MaxRate 限制峰值码率
+	RateControlBitrate = "bitrate" // 目标平均码率
+)
+
+// 分辨率策略
+const (
+	ResolutionSource = "source" // 保持原分辨率
+	ResolutionFit    = "fit"    // 按比例缩小到范围内，不放大、不加黑边
+	ResolutionPad    = "pad"    // 按比例缩放并加黑边到固定尺寸
+)
+
+// PresetSpec 结构化的转码参数，由 PlatformInfo 编译为当前平台的 FFmpeg 输出参数
+type PresetSpec struct {
+	Video     *VideoSpec `json:"video,omitempty" dynamodbav:"video,omitempty"`           // 为空时不输出视频
+	Audio     *AudioSpec `json:"audio,omitempty" dynamodbav:"audio,omitempty"`           // 为空时不输出音频
+	Container string     `json:"container" dynamodbav:"container"`                       // mp4 / mov / mkv / webm / jpg / png / mp3 / hls / dash
+	StartTime string     `json:"start_time,omitempty" dynamodbav:"start_time,omitempty"` // 输出的起始时间，如 00:00:04
+	Frames    int        `json:"frames,omitempty" dynamodbav:"frames,omitempty"`         // 只输出指定帧数，缩略图为 1
+}
+
+// VideoSpec 视频编码参数
+type VideoSpec struct {
+	Codec       string           `json:"codec" dynamodbav:"codec"`                         // h264 / h265 / mjpeg / png / copy，按平台选择编码器
+	Preset      string           `json:"preset,omitempty" dynamodbav:"preset,omitempty"`   // 编码速度预设，默认 fast
+	RateControl RateControl      `json:"rate_control" dynamodbav:"rate_control"`           // 码率控制
+	Resolution  ResolutionPolicy `json:"resolution" dynamodbav:"resolution"`               // 分辨率策略
+	FPS         float64          `json:"fps,omitempty" dynamodbav:"fps,omitempty"`         // 输出帧率，0 保持原帧率
+	GOP         int              `json:"gop,omitempty" dynamodbav:"gop,omitempty"`         // 关键帧间隔（帧），0 使用编码器默认值
+	Filters     []string         `json:"filters,omitempty" dynamodbav:"filters,omitempty"` // 缩放之后追加的视频滤镜
+}
+
+// RateControl 码率控制，码率单位 kbps
+type RateControl struct {
+	Mode    string `json:"mode" dynamodbav:"mode"`                             // quality / bitrate
+	Quality int    `json:"quality,omitempty" dynamodbav:"quality,omitempty"`   // CRF 风格的质量值（越小越好），按平台转换为 -crf / -cq / -q:v
+	Bitrate int    `json:"bitrate,omitempty" dynamodbav:"bitrate,omitempty"`   // 目标码率（bitrate 模式）
+	MaxRate int    `json:"max_rate,omitempty" dynamodbav:"max_rate,omitempty"` // 峰值码率，0 不限制
+	BufSize int    `json:"buf_size,omitempty" dynamodbav:"buf_size,omitempty"` // 码率控制缓冲区，0 时为峰值码率的 2 倍
+}
+
+// ResolutionPolicy 分辨率策略
+type ResolutionPolicy struct {
+	Mode   string `json:"mode" dynamodbav:"mode"`                         // source / fit / pad
+	Width  int    `json:"width,omitempty" dynamodbav:"width,omitempty"`   // fit / pad 的目标宽度
+	Height int    `json:"height,omitempty" dynamodbav:"height,omitempty"` // fit / pad 的目标高度
+	// PerTitle 按片源规划分辨率和码率（仅 fit）：竖屏片源交换宽高，码率按片源像素数、帧率和复杂度调整
+	PerTitle bool `json:"per_title,omitempty" dynamodbav:"per_title,omitempty"`
+}
+
+// AudioSpec 音频编码参数
+type AudioSpec struct {
+	Codec      string    `json:"codec" dynamodbav:"codec"`                                 // aac / mp3 / opus / copy
+	Bitrate    int       `json:"bitrate,omitempty" dynamodbav:"bitrate,omitempty"`         // kbps
+	SampleRate int       `json:"sample_rate,omitempty" dynamodbav:"sample_rate,omitempty"` // Hz
+	Channels   int       `json:"channels,omitempty" dynamodbav:"channels,omitempty"`
+	Loudness   *Loudness `json:"loudness,omitempty" dynamodbav:"loudness,omitempty"` // 响度标准化（loudnorm）
+}
+
+// Loudness 响度标准化目标，0 表示使用 loudnorm 的默认值
+type Loudness struct {
+	Integrated float64 `json:"integrated,omitempty" dynamodbav:"integrated,omitempty"` // 综合响度 LUFS
+	TruePeak   float64 `json:"true_peak,omitempty" dynamodbav:"true_peak,omitempty"`   // 真峰值上限 dBTP
+	Range      float64 `json:"range,omitempty" dynamodbav:"range,omitempty"`           // 响度范围 LU
+}
+
+// containerArgs 各封装格式的输出参数
+var containerArgs = map[string][]string{
+	ContainerMP4:  {"-movflags", "+faststart", "-f", "mp4"},
+	ContainerMOV:  {"-movflags", "+faststart", "-f", "mov"},
+	ContainerMKV:  {"-f", "matroska"},
+	ContainerWebM: {"-f", "webm"},
+	ContainerJPG:  {},
+	ContainerPNG:  {},
+	ContainerMP3:  {"-f", "mp3"},
+}
+
+// containerExts 封装格式对应的输出文件扩展名
+var containerExts = map[string]string{
+	ContainerMKV:  "mkv",
+	ContainerHLS:  "m3u8",
+	ContainerDASH: "mpd",
+}
+
+// audioEncoders 音频编码对应的 FFmpeg 编码器
+var audioEncoders = map[string]string{
+	"aac":  "aac",
+	"mp3":  "libmp3lame",
+	"opus": "libopus",
+	"copy": "copy",
+}
+
+// imageCodecs 图片编码，不使用硬件编码器和编码速度预设，质量值直接作为 -q:v
+var imageCodecs = map[string]bool{
+	"mjpeg": true,
+	"png":   true,
+}
+
+// Packaged 是否按码率阶梯打包为分段输出（HLS/DASH）
+func (s *PresetSpec) Packaged() bool {
+	return s.Container == ContainerHLS || s.Container == ContainerDASH
+}
+
+// OutputExt 输出文件扩展名
+func (s *PresetSpec) OutputExt() string {
+	if ext, ok := containerExts[s.Container]; ok {
+		return ext
+	}
+	return s.Container
+}
+
+// encodeSessions 单路输出占用的编码会话数，图片、流复制和纯音频输出不占会话
+func (s *PresetSpec) encodeSessions() int {
+	if s.Video == nil || s.Video.Codec == "copy" || imageCodecs[s.Video.Codec] {
+		return 0
+	}
+	return 1
+}
+
+// Validate 检查结构化参数是否完整、取值是否受支持
+func (s *PresetSpec) Validate() error {
+	_, known := containerArgs[s.Container]
+	if !known && !s.Packaged() {
+		return fmt.Errorf("%w: 不支持的封装格式 %q", ErrInvalidPreset, s.Container)
+	}
+	if s.Video == nil && s.Audio == nil {
+		return fmt.Errorf("%w: 视频和音频参数不能都为空", ErrInvalidPreset)
+	}
+
+	image := s.Container == ContainerJPG || s.Container == ContainerPNG
+	switch {
+	case image && (s.Video == nil || !imageCodecs[s.Video.Codec]):
+		return fmt.Errorf("%w: 图片输出的视频编码必须是 mjpeg 或 png", ErrInvalidPreset)
+	case image && s.Audio != nil:
+		return fmt.Errorf("%w: 图片输出不能包含音频", ErrInvalidPreset)
+	case s.Packaged() && (s.Video == nil || (s.Video.Codec != "h264" && s.Video.Codec != "h265")):
+		return fmt.Errorf("%w: HLS/DASH 的视频编码必须是 h264 或 h265", ErrInvalidPreset)
+	}
+
+	if v := s.Video; v != nil {
+		switch v.Codec {
+		case "h264", "h265", "copy":
+		case "mjpeg", "png":
+			if !image {
+				return fmt.Errorf("%w: %s 编码只能用于图片输出", ErrInvalidPreset, v.Codec)
+			}
+		default:
+			return fmt.Errorf("%w: 不支持的视频编码 %q", ErrInvalidPreset, v.Codec)
+		}
+
+		switch v.RateControl.Mode {
+		case RateControlQuality:
+			if v.Codec != "copy" && !s.Packaged() && v.RateControl.Quality <= 0 {
+				return fmt.Errorf("%w: quality 模式需要设置大于 0 的 quality", ErrInvalidPreset)
+			}
+		case RateControlBitrate:
+			if v.RateControl.Bitrate <= 0 {
+				return fmt.Errorf("%w: bitrate 模式需要设置大于 0 的 bitrate", ErrInvalidPreset)
+			}
+		case "":
+			if v.Codec != "copy" && !s.Packaged() {
+				return fmt.Errorf("%w: 缺少码率控制模式", ErrInvalidPreset)
+			}
+		default:
+			return fmt.Errorf("%w: 不支持的码率控制模式 %q", ErrInvalidPreset, v.RateControl.Mode)
+		}
+		if v.RateControl.MaxRate < 0 || v.RateControl.BufSize < 0 {
+			return fmt.Errorf("%w: 码率不能为负数", ErrInvalidPreset)
+		}
+
+		switch v.Resolution.Mode {
+		case "", ResolutionSource:
+		case ResolutionFit, ResolutionPad:
+			if v.Resolution.Width <= 0 || v.Resolution.Height <= 0 {
+				return fmt.Errorf("%w: %s 策略需要设置目标宽高", ErrInvalidPreset, v.Resolution.Mode)
+			}
+		default:
+			return fmt.Errorf("%w: 不支持的分辨率策略 %q", ErrInvalidPreset, v.Resolution.Mode)
+		}
+		if v.Codec == "copy" && (v.Resolution.Mode == ResolutionFit || v.Resolution.Mode == ResolutionPad || v.FPS > 0 || len(v.Filters) > 0) {
+			return fmt.Errorf("%w: 视频流复制不能缩放、改帧率或使用滤镜", ErrInvalidPreset)
+		}
+		if v.FPS < 0 || v.GOP < 0 {
+			return fmt.Errorf("%w: 帧率和关键帧间隔不能为负数", ErrInvalidPreset)
+		}
+	}
+
+	if a := s.Audio; a != nil {
+		if _, ok := audioEncoders[a.Codec]; !ok {
+			return fmt.Errorf("%w: 不支持的音频编码 %q", ErrInvalidPreset, a.Codec)
+		}
+		if a.Bitrate < 0 || a.SampleRate < 0 || a.Channels < 0 {
+			return fmt.Errorf("%w: 音频参数不能为负数", ErrInvalidPreset)
+		}
+		if a.Codec == "copy" && a.Loudness != nil {
+			return fmt.Errorf("%w: 音频流复制不能做响度标准化", ErrInvalidPreset)
+		}
+		if l := a.Loudness; l != nil {
+			switch {
+			case l.Integrated != 0 && (l.Integrated < -70 || l.Integrated > -5):
+				return fmt.Errorf("%w: 综合响度 integrated 应在 -70 到 -5 LUFS 之间", ErrInvalidPreset)
+			case l.TruePeak != 0 && (l.TruePeak < -9 || l.TruePeak > 0):
+				return fmt.Errorf("%w: 真峰值 true_peak 应在 -9 到 0 dBTP 之间", ErrInvalidPreset)
+			case l.Range != 0 && (l.Range < 1 || l.Range > 50):
+				return fmt.Errorf("%w: 响度范围 range 应在 1 到 50 LU 之间", ErrInvalidPreset)
+			}
+		}
+	}
+	return nil
+}
+
+// EncoderFor 返回视频编码在当前平台使用的 FFmpeg 编码器
+func (p *PlatformInfo) EncoderFor(codec string) (string, error) {
+	switch codec {
+	case "h264":
+		return p.H264Encoder, nil
+	case "h265", "hevc":
+		return p.H265Encoder, nil
+	case "mjpeg", "png", "copy":
+		return codec, nil
+	}
+	return "", fmt.Errorf("%w: 不支持的视频编码 %q", ErrInvalidPreset, codec)
+}
+
+// CompileSpec 将结构化参数编译为当前平台的 FFmpeg 输出参数（-i 之后的部分，含输出文件）
+// 不处理 HLS/DASH，它们由打包流程按码率阶梯生成参数
+func (p *PlatformInfo) CompileSpec(spec *PresetSpec, outputFile string) ([]string, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if spec.Packaged() {
+		return nil, fmt.Errorf("%w: %s 需要按码率阶梯打包", ErrInvalidPreset, spec.Container)
+	}
+
+	args := []string{}
+	if spec.StartTime != "" {
+		args = append(args, "-ss", spec.StartTime)
+	}
+
+	if v := spec.Video; v != nil {
+		videoArgs, err := p.compileVideo(v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, videoArgs...)
+	} else {
+		args = append(args, "-vn")
+	}
+	if spec.Frames > 0 {
+		args = append(args, "-frames:v", strconv.Itoa(spec.Frames))
+	}
+
+	if a := spec.Audio; a != nil {
+		args = append(args, compileAudio(a)...)
+	} else if spec.Video != nil && !imageCodecs[spec.Video.Codec] {
+		args = append(args, "-an")
+	}
+
+	args = append(args, containerArgs[spec.Container]...)
+	args = append(args, "-y", outputFile)
+	return args, nil
+}
+
+// compileVideo 编译视频参数：编码器、速度预设、码率控制、帧率、关键帧间隔和滤镜
+func (p *PlatformInfo) compileVideo(v *VideoSpec) ([]string, error) {
+	encoder, err := p.EncoderFor(v.Codec)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-c:v", encoder}
+	if encoder == "copy" {
+		return args, nil
+	}
+
+	rc := v.RateControl
+	if imageCodecs[v.Codec] {
+		if rc.Quality > 0 {
+			args = append(args, "-q:v", strconv.Itoa(rc.Quality))
+		}
+	} else {
+		preset := v.Preset
+		if preset == "" {
+			preset = "fast"
+		}
+		args = append(args, p.GetPresetParam(preset)...)
+		switch rc.Mode {
+		case RateControlQuality:
+			args = append(args, p.GetQualityParam(rc.Quality)...)
+		case RateControlBitrate:
+			args = append(args, "-b:v", fmt.Sprintf("%dk", rc.Bitrate))
+		}
+		if rc.MaxRate > 0 {
+			bufSize := rc.BufSize
+			if bufSize == 0 {
+				bufSize = rc.MaxRate * 2
+			}
+			args = append(args, "-maxrate", fmt.Sprintf("%dk", rc.MaxRate), "-bufsize", fmt.Sprintf("%dk", bufSize))
+		}
+	}
+
+	if v.FPS > 0 {
+		args = append(args, "-r", strconv.FormatFloat(v.FPS, 'f', -1, 64))
+	}
+	if v.GOP > 0 {
+		args = append(args, "-g", strconv.Itoa(v.GOP))
+	}
+
+	var filters []string
+	switch v.Resolution.Mode {
+	case ResolutionFit:
+		filters = append(filters, fitFilter(Rendition{Width: v.Resolution.Width, Height: v.Resolution.Height}))
+	case ResolutionPad:
+		filters = append(filters, p.GetScaleFilter(v.Resolution.Width, v.Resolution.Height))
+	}
+	filters = append(filters, v.Filters...)
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+	return args, nil
+}
+
+// compileAudio 编译音频参数
+func compileAudio(a *AudioSpec) []string {
+	args := []string{"-c:a", audioEncoders[a.Codec]}
+	if a.Codec == "copy" {
+		return args
+	}
+	if a.Bitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", a.Bitrate))
+	}
+	if a.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(a.SampleRate))
+	}
+	if a.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(a.Channels))
+	}
+	if l := a.Loudness; l != nil {
+		var params []string
+		if l.Integrated != 0 {
+			params = append(params, "I="+strconv.FormatFloat(l.Integrated, 'f', -1, 64))
+		}
+		if l.TruePeak != 0 {
+			params = append(params, "TP="+strconv.FormatFloat(l.TruePeak, 'f', -1, 64))
+		}
+		if l.Range != 0 {
+			params = append(params, "LRA="+strconv.FormatFloat(l.Range, 'f', -1, 64))
+		}
+		filter := "loudnorm"
+		if len(params) > 0 {
+			filter += "=" + strings.Join(params, ":")
+		}
+		args = append(args, "-af", filter)
+	}
+	return args
+}
@@ -0,0 +1,198 @@
+package transcode
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// cpuPlatform 和 nvidiaPlatform 测试用平台，不依赖本机硬件
+var (
+	cpuPlatform    = &PlatformInfo{Platform: PlatformCPU, H264Encoder: "libx264", H265Encoder: "libx265"}
+	nvidiaPlatform = &PlatformInfo{Platform: PlatformLinuxNvidia, H264Encoder: "h264_nvenc", H265Encoder: "hevc_nvenc"}
+)
+
+func TestCompileSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform *PlatformInfo
+		spec     PresetSpec
+		want     []string
+	}{
+		{
+			name:     "CPU 恒定质量 + 按比例缩放",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerMP4,
+				Video: &VideoSpec{
+					Codec:       "h264",
+					RateControl: RateControl{Mode: RateControlQuality, Quality: 23, MaxRate: 3000},
+					Resolution:  ResolutionPolicy{Mode: ResolutionFit, Width: 1280, Height: 720},
+				},
+				Audio: &AudioSpec{Codec: "aac", Bitrate: 128},
+			},
+			want: []string{
+				"-c:v", "libx264", "-preset", "fast", "-crf", "23", "-maxrate", "3000k", "-bufsize", "6000k",
+				"-vf", "scale=w='min(1280,iw)':h='min(720,ih)':force_original_aspect_ratio=decrease:force_divisible_by=2",
+				"-c:a", "aac", "-b:a", "128k",
+				"-movflags", "+faststart", "-f", "mp4", "-y", "out.mp4",
+			},
+		},
+		{
+			name:     "NVENC 质量参数使用 -cq",
+			platform: nvidiaPlatform,
+			spec: PresetSpec{
+				Container: ContainerMKV,
+				Video:     &VideoSpec{Codec: "h265", Preset: "p4", RateControl: RateControl{Mode: RateControlQuality, Quality: 28}, FPS: 29.97, GOP: 60},
+			},
+			want: []string{"-c:v", "hevc_nvenc", "-preset", "p4", "-cq", "28", "-r", "29.97", "-g", "60", "-an", "-f", "matroska", "-y", "out.mp4"},
+		},
+		{
+			name:     "目标码率 + 加黑边",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerMP4,
+				Video: &VideoSpec{
+					Codec:       "h264",
+					RateControl: RateControl{Mode: RateControlBitrate, Bitrate: 2000, MaxRate: 2500, BufSize: 4000},
+					Resolution:  ResolutionPolicy{Mode: ResolutionPad, Width: 640, Height: 360},
+					Filters:     []string{"hqdn3d"},
+				},
+			},
+			want: []string{
+				"-c:v", "libx264", "-preset", "fast", "-b:v", "2000k", "-maxrate", "2500k", "-bufsize", "4000k",
+				"-vf", "scale=640:360:force_original_aspect_ratio=decrease,pad=640:360:(ow-iw)/2:(oh-ih)/2:black,hqdn3d",
+				"-an", "-movflags", "+faststart", "-f", "mp4", "-y", "out.mp4",
+			},
+		},
+		{
+			name:     "缩略图",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerJPG,
+				StartTime: "00:00:04",
+				Frames:    1,
+				Video:     &VideoSpec{Codec: "mjpeg", RateControl: RateControl{Mode: RateControlQuality, Quality: 2}},
+			},
+			want: []string{"-ss", "00:00:04", "-c:v", "mjpeg", "-q:v", "2", "-frames:v", "1", "-y", "out.mp4"},
+		},
+		{
+			name:     "纯音频 + 完整响度目标",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerMP3,
+				Audio:     &AudioSpec{Codec: "mp3", Bitrate: 192, SampleRate: 44100, Channels: 2, Loudness: &Loudness{Integrated: -16, TruePeak: -1.5, Range: 11}},
+			},
+			want: []string{"-vn", "-c:a", "libmp3lame", "-b:a", "192k", "-ar", "44100", "-ac", "2", "-af", "loudnorm=I=-16:TP=-1.5:LRA=11", "-f", "mp3", "-y", "out.mp4"},
+		},
+		{
+			name:     "未设置的响度目标不输出",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerMP3,
+				Audio:     &AudioSpec{Codec: "mp3", Loudness: &Loudness{Integrated: -23}},
+			},
+			want: []string{"-vn", "-c:a", "libmp3lame", "-af", "loudnorm=I=-23", "-f", "mp3", "-y", "out.mp4"},
+		},
+		{
+			name:     "响度目标全部为空时使用 loudnorm 默认值",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerMP3,
+				Audio:     &AudioSpec{Codec: "mp3", Loudness: &Loudness{}},
+			},
+			want: []string{"-vn", "-c:a", "libmp3lame", "-af", "loudnorm", "-f", "mp3", "-y", "out.mp4"},
+		},
+		{
+			name:     "流复制",
+			platform: cpuPlatform,
+			spec: PresetSpec{
+				Container: ContainerMOV,
+				Video:     &VideoSpec{Codec: "copy"},
+				Audio:     &AudioSpec{Codec: "copy", Bitrate: 128},
+			},
+			want: []string{"-c:v", "copy", "-c:a", "copy", "-movflags", "+faststart", "-f", "mov", "-y", "out.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.platform.CompileSpec(&tt.spec, "out.mp4")
+			if err != nil {
+				t.Fatalf("CompileSpec() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompileSpec() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSpecRejectsPackaged(t *testing.T) {
+	spec := &PresetSpec{Container: ContainerHLS, Video: &VideoSpec{Codec: "h264"}}
+	if _, err := cpuPlatform.CompileSpec(spec, "out.m3u8"); !errors.Is(err, ErrInvalidPreset) {
+		t.Errorf("HLS 应由打包流程处理，CompileSpec() error = %v", err)
+	}
+}
+
+func TestPresetSpecValidate(t *testing.T) {
+	h264 := func() *VideoSpec {
+		return &VideoSpec{Codec: "h264", RateControl: RateControl{Mode: RateControlQuality, Quality: 23}}
+	}
+	withVideo := func(modify func(v *VideoSpec)) *VideoSpec {
+		v := h264()
+		modify(v)
+		return v
+	}
+	withLoudness := func(l Loudness) *AudioSpec {
+		return &AudioSpec{Codec: "aac", Loudness: &l}
+	}
+
+	tests := []struct {
+		name    string
+		spec    PresetSpec
+		wantErr bool
+	}{
+		{name: "合法的 MP4", spec: PresetSpec{Container: ContainerMP4, Video: h264(), Audio: &AudioSpec{Codec: "aac"}}},
+		{name: "HLS 不需要码率控制", spec: PresetSpec{Container: ContainerHLS, Video: &VideoSpec{Codec: "h265"}}},
+		{name: "未知封装格式", spec: PresetSpec{Container: "avi", Video: h264()}, wantErr: true},
+		{name: "视频和音频都为空", spec: PresetSpec{Container: ContainerMP4}, wantErr: true},
+		{name: "图片输出使用 h264", spec: PresetSpec{Container: ContainerJPG, Video: h264()}, wantErr: true},
+		{name: "图片输出包含音频", spec: PresetSpec{Container: ContainerPNG, Video: &VideoSpec{Codec: "png"}, Audio: &AudioSpec{Codec: "aac"}}, wantErr: true},
+		{name: "mjpeg 用于视频输出", spec: PresetSpec{Container: ContainerMP4, Video: &VideoSpec{Codec: "mjpeg"}}, wantErr: true},
+		{name: "DASH 使用流复制", spec: PresetSpec{Container: ContainerDASH, Video: &VideoSpec{Codec: "copy"}}, wantErr: true},
+		{name: "未知视频编码", spec: PresetSpec{Container: ContainerMP4, Video: &VideoSpec{Codec: "vp9"}}, wantErr: true},
+		{name: "quality 模式缺少质量值", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.RateControl.Quality = 0 })}, wantErr: true},
+		{name: "bitrate 模式缺少码率", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.RateControl = RateControl{Mode: RateControlBitrate} })}, wantErr: true},
+		{name: "缺少码率控制模式", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.RateControl.Mode = "" })}, wantErr: true},
+		{name: "未知码率控制模式", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.RateControl.Mode = "cbr" })}, wantErr: true},
+		{name: "峰值码率为负数", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.RateControl.MaxRate = -1 })}, wantErr: true},
+		{name: "fit 缺少宽高", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.Resolution.Mode = ResolutionFit })}, wantErr: true},
+		{name: "未知分辨率策略", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.Resolution.Mode = "crop" })}, wantErr: true},
+		{name: "流复制不能改帧率", spec: PresetSpec{Container: ContainerMP4, Video: &VideoSpec{Codec: "copy", FPS: 30}}, wantErr: true},
+		{name: "关键帧间隔为负数", spec: PresetSpec{Container: ContainerMP4, Video: withVideo(func(v *VideoSpec) { v.GOP = -1 })}, wantErr: true},
+		{name: "未知音频编码", spec: PresetSpec{Container: ContainerMP4, Audio: &AudioSpec{Codec: "flac"}}, wantErr: true},
+		{name: "音频参数为负数", spec: PresetSpec{Container: ContainerMP4, Audio: &AudioSpec{Codec: "aac", Channels: -1}}, wantErr: true},
+		{name: "音频流复制不能做响度标准化", spec: PresetSpec{Container: ContainerMP4, Audio: &AudioSpec{Codec: "copy", Loudness: &Loudness{}}}, wantErr: true},
+		{name: "响度范围边界内", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{Integrated: -70, TruePeak: -9, Range: 50})}},
+		{name: "响度范围另一侧边界", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{Integrated: -5, TruePeak: -0.1, Range: 1})}},
+		{name: "综合响度过低", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{Integrated: -71})}, wantErr: true},
+		{name: "综合响度为正数", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{Integrated: 3})}, wantErr: true},
+		{name: "真峰值为正数", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{TruePeak: 1})}, wantErr: true},
+		{name: "真峰值过低", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{TruePeak: -10})}, wantErr: true},
+		{name: "响度范围过小", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{Range: 0.5})}, wantErr: true},
+		{name: "响度范围过大", spec: PresetSpec{Container: ContainerMP4, Audio: withLoudness(Loudness{Range: 51})}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if tt.wantErr && !errors.Is(err, ErrInvalidPreset) {
+				t.Errorf("Validate() error = %v, want ErrInvalidPreset", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}